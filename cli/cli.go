@@ -0,0 +1,234 @@
+// Package cli implements the hastebin command line
+//
+// Wrapper binaries may register additional storage backends and key generators
+// with storage.Register and keygenerator.Register before calling Main:
+//
+//	import (
+//		"github.com/armbian/ansi-hastebin/cli"
+//		_ "example.com/hastebin-private-backend"
+//	)
+//
+//	func main() {
+//		cli.Main()
+//	}
+package cli
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/armbian/ansi-hastebin/config"
+	"github.com/armbian/ansi-hastebin/internal/archive"
+	"github.com/armbian/ansi-hastebin/internal/server"
+	"github.com/armbian/ansi-hastebin/keygenerator"
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func handleConfig(location string) (*config.Config, storage.Storage, keygenerator.KeyGenerator) {
+	cfg := config.NewConfig(location)
+	pasteStorage, err := storage.New(cfg.Storage.Type, cfg.Storage.Decode, storage.Options{
+		Expiration: time.Duration(cfg.Expiration) * time.Second,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Str("storage_type", cfg.Storage.Type).Msg("Failed to create storage")
+	}
+
+	// Documents of storage profiles are told apart by key prefix
+	if len(cfg.Profiles) > 0 {
+		var routes []storage.PrefixRoute
+		for name, profile := range cfg.Profiles {
+			expiration := profile.Expiration
+			if expiration == 0 {
+				expiration = cfg.Expiration
+			}
+
+			profileStorage, err := storage.New(profile.Storage.Type, profile.Storage.Decode, storage.Options{
+				Expiration: time.Duration(expiration) * time.Second,
+			})
+			if err != nil {
+				log.Fatal().Err(err).Str("profile", name).Str("storage_type", profile.Storage.Type).Msg("Failed to create storage")
+			}
+
+			routes = append(routes, storage.PrefixRoute{Prefix: profile.Prefix, Storage: profileStorage})
+		}
+
+		pasteStorage = storage.NewPrefixStorage(pasteStorage, routes)
+	}
+
+	// Set static documents from config
+	for _, doc := range cfg.Documents {
+		file, err := os.OpenFile(doc.Path, os.O_RDONLY, 0644)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", doc.Path).Msg("Failed to open document")
+		}
+
+		content, err := io.ReadAll(file)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", doc.Path).Msg("Failed to read document")
+		}
+		file.Close()
+
+		if err := pasteStorage.Set(doc.Key, string(content), false); err != nil {
+			log.Fatal().Err(err).Str("key", doc.Key).Msg("Failed to set document")
+		}
+	}
+
+	keyGenerator, err := keygenerator.New(cfg.KeyGenerator, cfg.DecodeKeyGenerator)
+	if err != nil {
+		log.Fatal().Err(err).Str("key_generator", cfg.KeyGenerator).Msg("Failed to create key generator")
+	}
+
+	// Adjust logger
+	logLevel, err := zerolog.ParseLevel(cfg.Logging.Level)
+	if err != nil {
+		log.Fatal().Err(err).Str("level", cfg.Logging.Level).Msg("Failed to parse log level")
+	}
+	log.Logger = log.Level(logLevel)
+
+	if cfg.Logging.Colorize {
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
+	}
+
+	return cfg, pasteStorage, keyGenerator
+}
+
+// Main parses command line arguments and runs the requested command
+func Main() {
+	// Parse command line arguments
+	var configFile string
+	flag.StringVar(&configFile, "config", "config.yaml", "Configuration file")
+	flag.Parse()
+
+	switch command := flag.Arg(0); command {
+	case "", "serve":
+		serve(configFile)
+	case "export":
+		exportDocuments(configFile, flag.Args()[1:])
+	case "import":
+		importDocuments(configFile, flag.Args()[1:])
+	case "rebalance":
+		rebalance(configFile, flag.Args()[1:])
+	default:
+		log.Fatal().Str("command", command).Msg("Unknown command")
+	}
+}
+
+func serve(configFile string) {
+	cfg, pasteStorage, keyGenerator := handleConfig(configFile)
+
+	// Keep uploads on local disk while the storage is unavailable
+	if cfg.Spool.Path != "" {
+		pasteStorage = storage.NewSpoolStorage(pasteStorage, storage.SpoolOptions{
+			Path:           cfg.Spool.Path,
+			MaxSize:        cfg.Spool.MaxSize,
+			ReplayInterval: time.Duration(cfg.Spool.ReplayInterval) * time.Second,
+		})
+	}
+
+	srv := server.NewServer(cfg, pasteStorage, keyGenerator)
+	srv.RegisterRoutes()
+
+	// Start the server in a separate goroutine
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for signal to stop the server
+	stopCh := make(chan os.Signal, 1)
+	signal.Notify(stopCh, syscall.SIGTERM, syscall.SIGINT)
+	<-stopCh
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	srv.Shutdown(ctx)
+}
+
+// Dumps every document from the configured storage into an archive
+func exportDocuments(configFile string, args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.StringVar(&configFile, "config", configFile, "Configuration file")
+	out := flags.String("out", "", "Archive file to write")
+	flags.Parse(args)
+
+	if *out == "" {
+		log.Fatal().Msg("Output archive is required, use --out")
+	}
+
+	_, pasteStorage, _ := handleConfig(configFile)
+	defer pasteStorage.Close()
+
+	file, err := os.Create(*out)
+	if err != nil {
+		log.Fatal().Err(err).Str("path", *out).Msg("Failed to create archive")
+	}
+
+	count, err := archive.Export(pasteStorage, file)
+	if err != nil {
+		file.Close()
+		log.Fatal().Err(err).Str("path", *out).Msg("Failed to export documents")
+	}
+
+	if err := file.Close(); err != nil {
+		log.Fatal().Err(err).Str("path", *out).Msg("Failed to write archive")
+	}
+
+	log.Info().Int("count", count).Str("path", *out).Msg("Exported documents")
+}
+
+// Restores every document from an archive into the configured storage
+func importDocuments(configFile string, args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.StringVar(&configFile, "config", configFile, "Configuration file")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatal().Msg("Exactly one archive to import is required")
+	}
+	in := flags.Arg(0)
+
+	_, pasteStorage, _ := handleConfig(configFile)
+	defer pasteStorage.Close()
+
+	file, err := os.Open(in)
+	if err != nil {
+		log.Fatal().Err(err).Str("path", in).Msg("Failed to open archive")
+	}
+	defer file.Close()
+
+	count, err := archive.Import(pasteStorage, file)
+	if err != nil {
+		log.Fatal().Err(err).Str("path", in).Int("count", count).Msg("Failed to import documents")
+	}
+
+	log.Info().Int("count", count).Str("path", in).Msg("Imported documents")
+}
+
+// Moves documents of sharded storage to the nodes owning them
+func rebalance(configFile string, args []string) {
+	flags := flag.NewFlagSet("rebalance", flag.ExitOnError)
+	flags.StringVar(&configFile, "config", configFile, "Configuration file")
+	flags.Parse(args)
+
+	_, pasteStorage, _ := handleConfig(configFile)
+	defer pasteStorage.Close()
+
+	sharded, ok := pasteStorage.(*storage.ShardedStorage)
+	if !ok {
+		log.Fatal().Msg("Rebalance requires sharded storage")
+	}
+
+	moved, err := sharded.Rebalance()
+	if err != nil {
+		log.Fatal().Err(err).Int("moved", moved).Msg("Failed to rebalance documents")
+	}
+
+	log.Info().Int("moved", moved).Msg("Rebalanced documents")
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// expirationStorage records the expiration it was created with
+type expirationStorage struct {
+	storage.Storage
+	expiration time.Duration
+}
+
+func init() {
+	storage.Register("cli-expiration-test", func(cfg struct{}, opts storage.Options) (storage.Storage, error) {
+		return &expirationStorage{expiration: opts.Expiration}, nil
+	})
+}
+
+func TestHandleConfig_Expiration(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(location, []byte(`
+expiration: 3600
+storage:
+  type: cli-expiration-test
+profiles:
+  short:
+    prefix: s
+    expiration: 60
+    storage:
+      type: cli-expiration-test
+  default:
+    prefix: d
+    storage:
+      type: cli-expiration-test
+`), 0600))
+
+	_, store, _ := handleConfig(location)
+	prefixed := store.(*storage.PrefixStorage)
+
+	// Expiration is configured in seconds
+	require.Equal(t, time.Hour, prefixed.Storage("key").(*expirationStorage).expiration)
+	require.Equal(t, time.Minute, prefixed.Storage("skey").(*expirationStorage).expiration)
+	require.Equal(t, time.Hour, prefixed.Storage("dkey").(*expirationStorage).expiration)
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -28,9 +30,81 @@ type RateLimitingConfig struct {
 	Window int `yaml:"window"`
 }
 
+type PasswordAttemptsConfig struct {
+	// Limit is the maximum number of failed password attempts per document within the window
+	Limit int `yaml:"limit"`
+
+	// Window is the time window to limit failed password attempts in seconds
+	Window int `yaml:"window"`
+}
+
+type VanityKeysConfig struct {
+	// Tokens are bearer tokens of clients allowed to choose keys of their documents
+	// Empty list disables vanity keys.
+	Tokens []string `yaml:"tokens"`
+
+	// MinLength is the minimum length of chosen keys
+	MinLength int `yaml:"min_length"`
+
+	// MaxLength is the maximum length of chosen keys
+	MaxLength int `yaml:"max_length"`
+
+	// Reserved are keys which can't be chosen
+	// Keys of static documents and names served by other routes are always reserved.
+	Reserved []string `yaml:"reserved"`
+}
+
+type SafeTerminalConfig struct {
+	// Disable is a flag to serve raw documents to terminal clients byte for byte
+	Disable bool `yaml:"disable"`
+
+	// UserAgents are substrings of user agents of terminal clients, matched case-insensitively
+	// Raw documents served to them keep only SGR escape sequences.
+	UserAgents []string `yaml:"user_agents"`
+}
+
+type StreamingConfig struct {
+	// IdleTimeout is the time in seconds a live paste is kept open without receiving data
+	IdleTimeout int `yaml:"idle_timeout"`
+
+	// MaxDuration is the time in seconds after which a live paste is sealed even if data keeps coming
+	MaxDuration int `yaml:"max_duration"`
+}
+
+type CustomExpirationConfig struct {
+	// Min is the shortest expiration uploaders may choose in seconds, shorter ones are raised to it
+	Min int `yaml:"min"`
+
+	// Max is the longest expiration uploaders may choose in seconds, longer ones are lowered to it
+	// 0 means the top level expiration unless Allowed is set. Documents which never expire are
+	// only allowed without maximum or when Allowed lists 0.
+	Max int `yaml:"max"`
+
+	// Allowed lists the only expirations uploaders may choose in seconds, 0 stands for no expiration
+	// Empty list allows any expiration between Min and Max.
+	Allowed []int `yaml:"allowed"`
+}
+
+type SpoolConfig struct {
+	// Path is the directory to keep documents in while the storage backend is unavailable
+	// Empty value disables the spool, uploads then fail while the storage backend is down.
+	Path string `yaml:"path"`
+
+	// MaxSize is the maximum total size of spooled documents in bytes
+	MaxSize int64 `yaml:"max_size"`
+
+	// ReplayInterval is the number of seconds between attempts to write spooled documents into the storage backend
+	ReplayInterval int `yaml:"replay_interval"`
+}
+
 type StorageConfig struct {
+	// Name is the name of the node in "sharded" storage
+	// Keys are assigned to nodes by their names, so it must not change once data is stored.
+	Name string `yaml:"name"`
+
 	// Type is the storage backend to use
-	// Available storage backends are: "redis", "file", "memcached", "mongodb", "s3", "postgres"
+	// Available storage backends are: "redis", "file", "memcached", "mongodb", "s3", "postgres", "gcs", "mysql", "webdav", "git", "sharded"
+	// and any backend registered with storage.Register.
 	Type string `yaml:"type"`
 
 	// Host is the hostname or IP address of the storage backend
@@ -56,10 +130,95 @@ type StorageConfig struct {
 	AWSRegion string `yaml:"aws_region"`
 
 	// FilePath is the file path to use for the "file" storage backend
-	// This property is only used for the "file" storage backend
+	// This property is only used for the "file" and "git" storage backends, for "git" it is the bare repository path
 	FilePath string `yaml:"file_path"`
+
+	// Endpoint is the API endpoint URL of the storage backend
+	// This property is used for the "gcs", "s3" and "webdav" storage backends, empty value means the default endpoint.
+	// For "s3" it takes precedence over host and port, for "webdav" it is the URL of the collection to store documents in.
+	Endpoint string `yaml:"endpoint"`
+
+	// TLS is a flag to connect to the storage backend over TLS
+	// This property is only used for the "s3" storage backend when endpoint is built from host and port
+	TLS bool `yaml:"tls"`
+
+	// TLSCAFile is the path to a PEM file with additional certificate authorities to trust
+	// This property is only used for the "webdav" storage backend
+	TLSCAFile string `yaml:"tls_ca_file"`
+
+	// TLSSkipVerify is a flag to disable verification of the storage backend certificate
+	// This property is only used for the "webdav" storage backend
+	TLSSkipVerify bool `yaml:"tls_skip_verify"`
+
+	// PathStyle is a flag to use path-style bucket addressing instead of virtual-hosted one
+	// This property is only used for the "s3" storage backend, it is always enabled when host is set
+	PathStyle bool `yaml:"path_style"`
+
+	// Prefix is the prefix prepended to every object key
+	// This property is only used for the "s3" storage backend
+	Prefix string `yaml:"prefix"`
+
+	// ServerSideEncryption is the server-side encryption algorithm ("AES256" or "aws:kms")
+	// This property is only used for the "s3" storage backend
+	ServerSideEncryption string `yaml:"server_side_encryption"`
+
+	// SSEKMSKeyID is the KMS key ID used for "aws:kms" server-side encryption
+	// This property is only used for the "s3" storage backend
+	SSEKMSKeyID string `yaml:"sse_kms_key_id"`
+
+	// Nodes is the list of storage backends to spread documents across
+	// This property is only used for the "sharded" storage backend
+	Nodes []StorageConfig `yaml:"nodes"`
+
+	// CredentialsFile is the path to the service account credentials file
+	// This property is only used for the "gcs" storage backend, empty value means default credentials
+	CredentialsFile string `yaml:"credentials_file"`
+
+	// raw is the storage block as written in the configuration file
+	raw *yaml.Node
 }
 
+// UnmarshalYAML keeps the raw storage block, so backends can decode their own options from it
+func (c *StorageConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain StorageConfig
+	if err := node.Decode((*plain)(c)); err != nil {
+		return err
+	}
+
+	c.raw = node
+	return nil
+}
+
+// Decode decodes the storage block into v, which is the typed configuration of the backend
+// Known properties take their final values, including environment overrides and defaults.
+// Nodes of "sharded" storage are decoded as written in the configuration file.
+func (c StorageConfig) Decode(v any) error {
+	known := c
+	known.Nodes = nil
+
+	return decodeOverlay(c.raw, known, v, "nodes")
+}
+
+type ProfileConfig struct {
+	// Prefix is prepended to keys of documents stored with the profile
+	// Reads find the profile of a document by its key prefix, so prefixes must be unique.
+	Prefix string `yaml:"prefix"`
+
+	// Expiration is the maximum lifetime of documents stored with the profile in seconds
+	// 0 means the top level expiration is used.
+	Expiration int `yaml:"expiration"`
+
+	// MaxLength is the maximum length of documents uploaded with the profile
+	// 0 means the top level maximum length is used.
+	MaxLength int `yaml:"max_length"`
+
+	// Storage is the storage backend of the profile
+	Storage StorageConfig `yaml:"storage"`
+}
+
+// ProfileRoutes are names of upload routes which may be mapped to profiles
+var ProfileRoutes = []string{"documents", "log"}
+
 type DocumentConfig struct {
 	// Key is the key of the document
 	Key string `yaml:"key"`
@@ -88,30 +247,117 @@ type Config struct {
 	// StaticMaxAge is the maximum age of static assets
 	StaticMaxAge int `yaml:"static_max_age"`
 
-	// Expiration is the maximum lifetime of paste entry
+	// Expiration is the maximum lifetime of paste entry in seconds
 	// 0 means there will be no expiration.
-	// "file" and "s3" storages don't support expiration control.
+	// "file" storage doesn't support expiration control.
 	Expiration int `yaml:"expiration"`
 
+	// CustomExpiration limits expiration chosen by uploaders of single documents
+	// Documents uploaded without one use Expiration.
+	CustomExpiration CustomExpirationConfig `yaml:"custom_expiration"`
+
 	// RecompressStaticAssets is a flag to recompress static assets by default
 	RecompressStaticAssets bool `yaml:"recompress_static_assets"`
 
 	// KeyGenerator is the key generator to use
-	// Available key generators are: "random", "phonetic"
+	// Available key generators are: "random", "phonetic" and any key generator registered with keygenerator.Register
 	KeyGenerator string `yaml:"key_generator"`
 
 	// Storage is the storage backend to use
-	// Available storage backends are: "redis", "file", "memcached", "mongodb", "s3", "postgres"
+	// Available storage backends are: "redis", "file", "memcached", "mongodb", "s3", "postgres", "gcs", "mysql", "webdav", "git", "sharded"
 	Storage StorageConfig `yaml:"storage"`
 
+	// Profiles are named storage policies which routes may use instead of the top level storage
+	Profiles map[string]ProfileConfig `yaml:"profiles"`
+
+	// Routes maps upload routes to names of profiles
+	// Available routes are: "documents" (POST /documents) and "log" (PUT /log), unmapped routes use the top level storage.
+	Routes map[string]string `yaml:"routes"`
+
+	// Spool is the configuration of the local spool used during storage outages
+	Spool SpoolConfig `yaml:"spool"`
+
 	// Logging is the logging configuration
 	Logging LoggingConfig `yaml:"logging"`
 
 	// RateLimiting is the rate limiting configuration
 	RateLimiting RateLimitingConfig `yaml:"rate_limiting"`
 
+	// PasswordAttempts limits guessing passwords of documents protected by them
+	PasswordAttempts PasswordAttemptsConfig `yaml:"password_attempts"`
+
+	// VanityKeys allows authenticated clients to choose keys of their documents
+	VanityKeys VanityKeysConfig `yaml:"vanity_keys"`
+
+	// SafeTerminal strips escape sequences which may harm terminals from raw documents served to them
+	SafeTerminal SafeTerminalConfig `yaml:"safe_terminal"`
+
+	// Streaming limits live pastes uploaded through PUT /stream, they use the policy of the "log" route
+	Streaming StreamingConfig `yaml:"streaming"`
+
 	// Documents is the list of documents to load statically
 	Documents []DocumentConfig `yaml:"documents"`
+
+	// raw is the configuration file as written
+	raw *yaml.Node
+}
+
+// UnmarshalYAML keeps the raw configuration, so key generators can decode their own options from it
+func (c *Config) UnmarshalYAML(node *yaml.Node) error {
+	type plain Config
+	if err := node.Decode((*plain)(c)); err != nil {
+		return err
+	}
+
+	c.raw = node
+	return nil
+}
+
+// DecodeKeyGenerator decodes the top level configuration into v, which is the typed configuration of the key generator
+// Known key generator properties take their final values, including environment overrides.
+func (c *Config) DecodeKeyGenerator(v any) error {
+	known := map[string]any{
+		"key_generator": c.KeyGenerator,
+		"key_length":    c.KeyLength,
+		"key_space":     c.KeySpace,
+	}
+
+	return decodeOverlay(c.raw, known, v)
+}
+
+// decodeOverlay decodes raw mapping into v, with values of known replacing the ones from raw
+// Keys listed in skip are never taken from known.
+func decodeOverlay(raw *yaml.Node, known any, v any, skip ...string) error {
+	var overlay yaml.Node
+	if err := overlay.Encode(known); err != nil {
+		return err
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if raw != nil && raw.Kind == yaml.MappingNode {
+		merged.Content = append(merged.Content, raw.Content...)
+	}
+
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+		if slices.Contains(skip, key.Value) {
+			continue
+		}
+
+		replaced := false
+		for j := 0; j+1 < len(merged.Content); j += 2 {
+			if merged.Content[j].Value == key.Value {
+				merged.Content[j+1] = value
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			merged.Content = append(merged.Content, key, value)
+		}
+	}
+
+	return merged.Decode(v)
 }
 
 var DefaultConfig = &Config{
@@ -126,9 +372,28 @@ var DefaultConfig = &Config{
 		Type:     "file",
 		FilePath: "data",
 	},
+	Spool: SpoolConfig{
+		MaxSize:        100 << 20,
+		ReplayInterval: 10,
+	},
 	Logging: LoggingConfig{
 		Level: "info",
 	},
+	PasswordAttempts: PasswordAttemptsConfig{
+		Limit:  5,
+		Window: 60,
+	},
+	VanityKeys: VanityKeysConfig{
+		MinLength: 3,
+		MaxLength: 64,
+	},
+	SafeTerminal: SafeTerminalConfig{
+		UserAgents: []string{"curl/", "wget/"},
+	},
+	Streaming: StreamingConfig{
+		IdleTimeout: 300,
+		MaxDuration: 21600,
+	},
 	Documents: []DocumentConfig{
 		{
 			Key:  "about",
@@ -241,6 +506,74 @@ func NewConfig(configFile string) *Config {
 		cfg.Storage.FilePath = storageFilePath
 	}
 
+	if storageEndpoint := os.Getenv("STORAGE_ENDPOINT"); storageEndpoint != "" {
+		cfg.Storage.Endpoint = storageEndpoint
+	}
+
+	if storageCredentialsFile := os.Getenv("STORAGE_CREDENTIALS_FILE"); storageCredentialsFile != "" {
+		cfg.Storage.CredentialsFile = storageCredentialsFile
+	}
+
+	if storageTLS := os.Getenv("STORAGE_TLS"); storageTLS != "" {
+		storageTLSBool, err := strconv.ParseBool(storageTLS)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to parse STORAGE_TLS environment variable")
+		}
+		cfg.Storage.TLS = storageTLSBool
+	}
+
+	if storageTLSCAFile := os.Getenv("STORAGE_TLS_CA_FILE"); storageTLSCAFile != "" {
+		cfg.Storage.TLSCAFile = storageTLSCAFile
+	}
+
+	if storageTLSSkipVerify := os.Getenv("STORAGE_TLS_SKIP_VERIFY"); storageTLSSkipVerify != "" {
+		storageTLSSkipVerifyBool, err := strconv.ParseBool(storageTLSSkipVerify)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to parse STORAGE_TLS_SKIP_VERIFY environment variable")
+		}
+		cfg.Storage.TLSSkipVerify = storageTLSSkipVerifyBool
+	}
+
+	if storagePathStyle := os.Getenv("STORAGE_PATH_STYLE"); storagePathStyle != "" {
+		storagePathStyleBool, err := strconv.ParseBool(storagePathStyle)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to parse STORAGE_PATH_STYLE environment variable")
+		}
+		cfg.Storage.PathStyle = storagePathStyleBool
+	}
+
+	if storagePrefix := os.Getenv("STORAGE_PREFIX"); storagePrefix != "" {
+		cfg.Storage.Prefix = storagePrefix
+	}
+
+	if storageSSE := os.Getenv("STORAGE_SERVER_SIDE_ENCRYPTION"); storageSSE != "" {
+		cfg.Storage.ServerSideEncryption = storageSSE
+	}
+
+	if storageSSEKMSKeyID := os.Getenv("STORAGE_SSE_KMS_KEY_ID"); storageSSEKMSKeyID != "" {
+		cfg.Storage.SSEKMSKeyID = storageSSEKMSKeyID
+	}
+
+	if spoolPath := os.Getenv("SPOOL_PATH"); spoolPath != "" {
+		cfg.Spool.Path = spoolPath
+	}
+
+	if spoolMaxSize := os.Getenv("SPOOL_MAX_SIZE"); spoolMaxSize != "" {
+		spoolMaxSizeInt, err := strconv.ParseInt(spoolMaxSize, 10, 64)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to parse SPOOL_MAX_SIZE environment variable")
+		}
+		cfg.Spool.MaxSize = spoolMaxSizeInt
+	}
+
+	if spoolReplayInterval := os.Getenv("SPOOL_REPLAY_INTERVAL"); spoolReplayInterval != "" {
+		spoolReplayIntervalInt, err := strconv.Atoi(spoolReplayInterval)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to parse SPOOL_REPLAY_INTERVAL environment variable")
+		}
+		cfg.Spool.ReplayInterval = spoolReplayIntervalInt
+	}
+
 	if loggingLevel := os.Getenv("LOGGING_LEVEL"); loggingLevel != "" {
 		cfg.Logging.Level = loggingLevel
 	}
@@ -326,9 +659,80 @@ func NewConfig(configFile string) *Config {
 		cfg.Storage.FilePath = DefaultConfig.Storage.FilePath
 	}
 
+	if cfg.Spool.MaxSize == 0 {
+		cfg.Spool.MaxSize = DefaultConfig.Spool.MaxSize
+	}
+
+	if cfg.Spool.ReplayInterval == 0 {
+		cfg.Spool.ReplayInterval = DefaultConfig.Spool.ReplayInterval
+	}
+
 	if cfg.Logging.Level == "" {
 		cfg.Logging.Level = DefaultConfig.Logging.Level
 	}
 
+	if cfg.PasswordAttempts.Limit == 0 {
+		cfg.PasswordAttempts.Limit = DefaultConfig.PasswordAttempts.Limit
+	}
+
+	if cfg.PasswordAttempts.Window == 0 {
+		cfg.PasswordAttempts.Window = DefaultConfig.PasswordAttempts.Window
+	}
+
+	if cfg.VanityKeys.MinLength == 0 {
+		cfg.VanityKeys.MinLength = DefaultConfig.VanityKeys.MinLength
+	}
+
+	if cfg.VanityKeys.MaxLength == 0 {
+		cfg.VanityKeys.MaxLength = DefaultConfig.VanityKeys.MaxLength
+	}
+
+	if len(cfg.SafeTerminal.UserAgents) == 0 {
+		cfg.SafeTerminal.UserAgents = DefaultConfig.SafeTerminal.UserAgents
+	}
+
+	if cfg.Streaming.IdleTimeout == 0 {
+		cfg.Streaming.IdleTimeout = DefaultConfig.Streaming.IdleTimeout
+	}
+
+	if cfg.Streaming.MaxDuration == 0 {
+		cfg.Streaming.MaxDuration = DefaultConfig.Streaming.MaxDuration
+	}
+
+	if err := cfg.validateProfiles(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid storage profiles")
+	}
+
 	return cfg
 }
+
+// Checks that profiles are distinguishable by prefix and routes refer to existing profiles
+func (c *Config) validateProfiles() error {
+	prefixes := map[string]string{}
+	for name, profile := range c.Profiles {
+		if profile.Prefix == "" {
+			return fmt.Errorf("profile %q has no prefix", name)
+		}
+
+		if profile.Storage.Type == "" {
+			return fmt.Errorf("profile %q has no storage type", name)
+		}
+
+		if other, ok := prefixes[profile.Prefix]; ok {
+			return fmt.Errorf("profiles %q and %q share prefix %q", other, name, profile.Prefix)
+		}
+		prefixes[profile.Prefix] = name
+	}
+
+	for route, name := range c.Routes {
+		if !slices.Contains(ProfileRoutes, route) {
+			return fmt.Errorf("unknown route %q", route)
+		}
+
+		if _, ok := c.Profiles[name]; !ok {
+			return fmt.Errorf("route %q refers to unknown profile %q", route, name)
+		}
+	}
+
+	return nil
+}
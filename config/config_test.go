@@ -17,6 +17,13 @@ func TestNewConfig_DefaultValues(t *testing.T) {
 	require.Equal(t, "file", cfg.Storage.Type)
 	require.Equal(t, "data", cfg.Storage.FilePath)
 	require.Equal(t, "info", cfg.Logging.Level)
+	require.Equal(t, 5, cfg.PasswordAttempts.Limit)
+	require.Equal(t, 60, cfg.PasswordAttempts.Window)
+	require.Equal(t, 3, cfg.VanityKeys.MinLength)
+	require.Equal(t, 64, cfg.VanityKeys.MaxLength)
+	require.Equal(t, []string{"curl/", "wget/"}, cfg.SafeTerminal.UserAgents)
+	require.Equal(t, 300, cfg.Streaming.IdleTimeout)
+	require.Equal(t, 21600, cfg.Streaming.MaxDuration)
 }
 
 func TestNewConfig_OverrideWithEnvVars(t *testing.T) {
@@ -80,3 +87,199 @@ logging:
 	require.Equal(t, 27017, cfg.Storage.Port)
 	require.Equal(t, "warn", cfg.Logging.Level)
 }
+
+func TestNewConfig_ShardedNodes(t *testing.T) {
+	yamlContent := `
+storage:
+  type: "sharded"
+  nodes:
+    - name: "first"
+      type: "redis"
+      host: "redis-1"
+      port: 6379
+    - name: "second"
+      type: "file"
+      file_path: "/data/second"
+`
+
+	tmpFile, err := os.CreateTemp("", "config_test_*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write([]byte(yamlContent))
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	cfg := NewConfig(tmpFile.Name())
+
+	require.Equal(t, "sharded", cfg.Storage.Type)
+	require.Len(t, cfg.Storage.Nodes, 2)
+	require.Equal(t, "first", cfg.Storage.Nodes[0].Name)
+	require.Equal(t, "redis-1", cfg.Storage.Nodes[0].Host)
+	require.Equal(t, 6379, cfg.Storage.Nodes[0].Port)
+	require.Equal(t, "second", cfg.Storage.Nodes[1].Name)
+	require.Equal(t, "/data/second", cfg.Storage.Nodes[1].FilePath)
+}
+
+func TestStorageConfig_Decode(t *testing.T) {
+	yamlContent := `
+key_space: "abc"
+custom_option: "from file"
+storage:
+  type: "private"
+  host: "file-host"
+  port: 1234
+  custom_option: "from file"
+  nodes:
+    - type: "file"
+`
+
+	tmpFile, err := os.CreateTemp("", "config_test_*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write([]byte(yamlContent))
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	t.Setenv("STORAGE_HOST", "env-host")
+	t.Setenv("KEY_GENERATOR", "private")
+
+	cfg := NewConfig(tmpFile.Name())
+
+	var storageCfg struct {
+		Host         string `yaml:"host"`
+		Port         int    `yaml:"port"`
+		FilePath     string `yaml:"file_path"`
+		CustomOption string `yaml:"custom_option"`
+		Nodes        []struct {
+			Type     string `yaml:"type"`
+			FilePath string `yaml:"file_path"`
+		} `yaml:"nodes"`
+	}
+	require.NoError(t, cfg.Storage.Decode(&storageCfg))
+
+	require.Equal(t, "env-host", storageCfg.Host)
+	require.Equal(t, 1234, storageCfg.Port)
+	require.Equal(t, "data", storageCfg.FilePath)
+	require.Equal(t, "from file", storageCfg.CustomOption)
+	require.Len(t, storageCfg.Nodes, 1)
+	require.Equal(t, "file", storageCfg.Nodes[0].Type)
+	require.Empty(t, storageCfg.Nodes[0].FilePath)
+
+	var keyGeneratorCfg struct {
+		KeyGenerator string `yaml:"key_generator"`
+		KeySpace     string `yaml:"key_space"`
+		CustomOption string `yaml:"custom_option"`
+	}
+	require.NoError(t, cfg.DecodeKeyGenerator(&keyGeneratorCfg))
+
+	require.Equal(t, "private", keyGeneratorCfg.KeyGenerator)
+	require.Equal(t, "abc", keyGeneratorCfg.KeySpace)
+	require.Equal(t, "from file", keyGeneratorCfg.CustomOption)
+
+	// Configuration without file decodes known properties only
+	var defaultCfg struct {
+		FilePath string `yaml:"file_path"`
+	}
+	require.NoError(t, NewConfig("nonexistent.yaml").Storage.Decode(&defaultCfg))
+	require.Equal(t, "data", defaultCfg.FilePath)
+}
+
+func TestNewConfig_Profiles(t *testing.T) {
+	yamlContent := `
+expiration: 604800
+storage:
+  type: "redis"
+profiles:
+  logs:
+    prefix: "l"
+    expiration: 7776000
+    max_length: 10000000
+    storage:
+      type: "s3"
+      bucket: "logs"
+routes:
+  log: "logs"
+`
+
+	tmpFile, err := os.CreateTemp("", "config_test_*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write([]byte(yamlContent))
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	cfg := NewConfig(tmpFile.Name())
+
+	require.Len(t, cfg.Profiles, 1)
+	profile := cfg.Profiles["logs"]
+	require.Equal(t, "l", profile.Prefix)
+	require.Equal(t, 7776000, profile.Expiration)
+	require.Equal(t, 10000000, profile.MaxLength)
+	require.Equal(t, "s3", profile.Storage.Type)
+	require.Equal(t, "logs", cfg.Routes["log"])
+
+	var storageCfg struct {
+		Bucket string `yaml:"bucket"`
+	}
+	require.NoError(t, profile.Storage.Decode(&storageCfg))
+	require.Equal(t, "logs", storageCfg.Bucket)
+}
+
+func TestConfig_ValidateProfiles(t *testing.T) {
+	storage := StorageConfig{Type: "file"}
+
+	tests := []struct {
+		name     string
+		profiles map[string]ProfileConfig
+		routes   map[string]string
+		err      string
+	}{
+		{
+			name:     "valid",
+			profiles: map[string]ProfileConfig{"logs": {Prefix: "l", Storage: storage}, "web": {Prefix: "w", Storage: storage}},
+			routes:   map[string]string{"log": "logs", "documents": "web"},
+		},
+		{
+			name:     "missing prefix",
+			profiles: map[string]ProfileConfig{"logs": {Storage: storage}},
+			err:      `profile "logs" has no prefix`,
+		},
+		{
+			name:     "missing storage type",
+			profiles: map[string]ProfileConfig{"logs": {Prefix: "l"}},
+			err:      `profile "logs" has no storage type`,
+		},
+		{
+			name:     "shared prefix",
+			profiles: map[string]ProfileConfig{"logs": {Prefix: "l", Storage: storage}, "web": {Prefix: "l", Storage: storage}},
+			err:      `share prefix "l"`,
+		},
+		{
+			name:     "unknown route",
+			profiles: map[string]ProfileConfig{"logs": {Prefix: "l", Storage: storage}},
+			routes:   map[string]string{"upload": "logs"},
+			err:      `unknown route "upload"`,
+		},
+		{
+			name:   "unknown profile",
+			routes: map[string]string{"log": "logs"},
+			err:    `route "log" refers to unknown profile "logs"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &Config{Profiles: test.profiles, Routes: test.routes}
+
+			err := cfg.validateProfiles()
+			if test.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/armbian/ansi-hastebin/internal/ansi"
+)
+
+// Modes of handling ANSI escape sequences of raw documents
+const (
+	// ANSIKeep serves documents byte for byte
+	ANSIKeep = "keep"
+
+	// ANSIStrip removes escape sequences and applies carriage return overwrites
+	ANSIStrip = "strip"
+
+	// ANSISafe keeps SGR colors and removes other escape sequences, which may harm terminals
+	ANSISafe = "safe"
+)
+
+// DefaultSafeTerminalAgents are user agents of terminal clients getting documents sanitized by default
+var DefaultSafeTerminalAgents = []string{"curl/", "wget/"}
+
+var errInvalidANSIMode = errors.New("invalid ANSI mode")
+
+// Returns mode requested through "ansi" query parameter
+// Clients which aren't terminals, recognized by accepting plain text or HTML, get documents
+// stripped by default. Terminal clients recognized by their user agent get them sanitized.
+func (h *DocumentHandler) requestedANSIMode(r *http.Request) (string, error) {
+	switch mode := r.URL.Query().Get("ansi"); mode {
+	case ANSIKeep, ANSIStrip, ANSISafe:
+		return mode, nil
+	case "":
+	default:
+		return "", errInvalidANSIMode
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && (mediaType == "text/plain" || mediaType == "text/html") {
+			return ANSIStrip, nil
+		}
+	}
+
+	userAgent := strings.ToLower(r.UserAgent())
+	for _, agent := range h.SafeTerminalAgents {
+		if strings.Contains(userAgent, strings.ToLower(agent)) {
+			return ANSISafe, nil
+		}
+	}
+
+	return ANSIKeep, nil
+}
+
+// Applies the mode to the document
+func applyANSIMode(mode string, data string) string {
+	switch mode {
+	case ANSIStrip:
+		return ansi.Strip(data)
+	case ANSISafe:
+		return ansi.Sanitize(data)
+	default:
+		return data
+	}
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestedANSIMode(t *testing.T) {
+	tests := []struct {
+		query    string
+		accept   string
+		expected string
+		err      bool
+	}{
+		{expected: ANSIKeep},
+		{accept: "*/*", expected: ANSIKeep},
+		{accept: "text/plain", expected: ANSIStrip},
+		{accept: "text/html,application/xhtml+xml;q=0.9,*/*;q=0.8", expected: ANSIStrip},
+		{query: "ansi=keep", accept: "text/plain", expected: ANSIKeep},
+		{query: "ansi=strip", expected: ANSIStrip},
+		{query: "ansi=safe", expected: ANSISafe},
+		{query: "ansi=colors", err: true},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/raw/test123?"+test.query, nil)
+		req.Header.Set("Accept", test.accept)
+
+		mode, err := setupHandler().requestedANSIMode(req)
+		if test.err {
+			require.Error(t, err, test.query)
+			continue
+		}
+
+		require.NoError(t, err)
+		require.Equal(t, test.expected, mode, test.query+" "+test.accept)
+	}
+}
+
+func TestHandleRawGet_ANSI(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	handler.Store.Set("test123", "\x1b[32mOK\x1b[0m\n 10%\r100%\n", false)
+
+	resp := sendRequest(router, http.MethodGet, "/raw/test123", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "\x1b[32mOK\x1b[0m\n 10%\r100%\n", resp.Body.String())
+	require.Equal(t, "Accept, User-Agent", resp.Header().Get("Vary"))
+
+	resp = sendRequest(router, http.MethodGet, "/raw/test123?ansi=strip", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "OK\n100%\n", resp.Body.String())
+
+	req := httptest.NewRequest(http.MethodGet, "/raw/test123", nil)
+	req.Header.Set("Accept", "text/plain")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, "OK\n100%\n", rec.Body.String())
+
+	resp = sendRequest(router, http.MethodGet, "/raw/test123?ansi=invalid", nil)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestHandleRawGet_SafeTerminal(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	handler.Store.Set("test123", "\x1b]52;c;cm0gLXJmIH4K\x07\x1b[31mred\x1b[0m\n", false)
+
+	for userAgent, expected := range map[string]string{
+		"curl/8.5.0":               "\x1b[31mred\x1b[0m\n",
+		"Wget/1.21.4":              "\x1b[31mred\x1b[0m\n",
+		"armbianmonitor (python)":  "\x1b]52;c;cm0gLXJmIH4K\x07\x1b[31mred\x1b[0m\n",
+		"Mozilla/5.0 (X11; Linux)": "\x1b]52;c;cm0gLXJmIH4K\x07\x1b[31mred\x1b[0m\n",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/raw/test123", nil)
+		req.Header.Set("User-Agent", userAgent)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, expected, rec.Body.String(), userAgent)
+	}
+
+	// Terminal clients may still ask for documents byte for byte
+	req := httptest.NewRequest(http.MethodGet, "/raw/test123?ansi=keep", nil)
+	req.Header.Set("User-Agent", "curl/8.5.0")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Contains(t, rec.Body.String(), "\x1b]52")
+
+	// The filter is disabled without user agents
+	handler.SafeTerminalAgents = nil
+	req = httptest.NewRequest(http.MethodGet, "/raw/test123", nil)
+	req.Header.Set("User-Agent", "curl/8.5.0")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Contains(t, rec.Body.String(), "\x1b]52")
+}
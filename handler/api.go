@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/armbian/ansi-hastebin/internal/highlight"
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// maxJSONOverhead is the room left for JSON escaping and other fields of API requests
+const maxJSONOverhead = 64 << 10
+
+// CreateRequest is the body of POST /api/v1/documents
+type CreateRequest struct {
+	// Key is the key chosen for the document, empty means a generated one
+	// Choosing keys requires a client token passed as a bearer token.
+	Key string `json:"key"`
+
+	Content string `json:"content"`
+	Title   string `json:"title"`
+
+	// Language is the language to highlight the document as, empty means a detected one
+	// Filename is only a hint for detecting the language.
+	Language string `json:"language"`
+	Filename string `json:"filename"`
+
+	// ExpiresIn is the lifetime of the document in seconds, 0 means the storage-wide expiration
+	// Reads extend the lifetime by the same amount, within limits set by the operator.
+	ExpiresIn int `json:"expires_in"`
+
+	// Visibility is either "public" or "unlisted", empty means "public"
+	Visibility string `json:"visibility"`
+
+	// MaxViews is the number of reads after which the document is removed, 0 means unlimited
+	// BurnAfterReading is the same as MaxViews of 1.
+	MaxViews         int  `json:"max_views"`
+	BurnAfterReading bool `json:"burn_after_reading"`
+
+	// Password is required to read the document, only its hash is stored
+	Password string `json:"password"`
+}
+
+// CreateResponse is the response of POST /api/v1/documents
+type CreateResponse struct {
+	Key    string `json:"key"`
+	URL    string `json:"url"`
+	RawURL string `json:"raw_url"`
+
+	// ExpiresAt is the expiration unless the document is read before, it is omitted
+	// for documents following the storage-wide expiration or never expiring
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Token authorizes management of the document, only its hash is stored
+	Token string `json:"token"`
+}
+
+// Handle creating a document with options
+func (h *DocumentHandler) HandleAPICreate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	h.limitJSONBody(w, r)
+
+	var req CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, `{"message": "Document exceeds maximum length."}`, http.StatusBadRequest)
+			return
+		}
+
+		http.Error(w, `{"message": "Malformed request body."}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Content == "" {
+		http.Error(w, `{"message": "Content is required."}`, http.StatusBadRequest)
+		return
+	}
+
+	key, err := h.vanityKey(r, req.Key)
+	if err != nil {
+		keyError(w, err)
+		return
+	}
+
+	if req.ExpiresIn < 0 {
+		expirationError(w, errInvalidExpiration)
+		return
+	}
+
+	var expiration *time.Duration
+	if req.ExpiresIn > 0 {
+		var err error
+		if expiration, err = h.limitExpiration(time.Duration(req.ExpiresIn) * time.Second); err != nil {
+			expirationError(w, err)
+			return
+		}
+	}
+
+	switch req.Visibility {
+	case "":
+		req.Visibility = VisibilityPublic
+	case VisibilityPublic, VisibilityUnlisted:
+	default:
+		http.Error(w, `{"message": "Invalid visibility."}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.MaxViews < 0 || (req.BurnAfterReading && req.MaxViews > 1) {
+		viewsError(w, errInvalidViews)
+		return
+	} else if req.BurnAfterReading {
+		req.MaxViews = 1
+	}
+
+	if _, ok := h.Store.(storage.ViewConsumer); req.MaxViews > 0 && !ok {
+		viewsError(w, errViewsUnsupported)
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate management token")
+		http.Error(w, `{"message": "Error adding document."}`, http.StatusInternalServerError)
+		return
+	}
+
+	// Known languages are stored by their names, so aliases and extensions work too
+	if language := highlight.Lookup(req.Language); language != "" {
+		req.Language = language
+	}
+
+	meta := &Metadata{
+		Title:            req.Title,
+		Language:         req.Language,
+		Visibility:       req.Visibility,
+		BurnAfterReading: req.BurnAfterReading,
+		MaxViews:         req.MaxViews,
+		TokenHash:        hashToken(token),
+		CreatedAt:        time.Now().UTC(),
+	}
+
+	if req.Password != "" {
+		if meta.PasswordHash, err = hashPassword(req.Password); err != nil {
+			log.Error().Err(err).Msg("Failed to hash document password")
+			http.Error(w, `{"message": "Error adding document."}`, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	key, err = h.create(RouteDocuments, key, req.Filename, req.Content, expiration, meta)
+	if err != nil {
+		createError(w, err)
+		return
+	}
+
+	log.Info().Str("key", key).Msg("Added document through API")
+
+	resp := CreateResponse{
+		Key:    key,
+		URL:    fmt.Sprintf("https://%s/%s", r.Host, key),
+		RawURL: fmt.Sprintf("https://%s/raw/%s", r.Host, key),
+		Token:  token,
+	}
+
+	if expiration != nil && *expiration > 0 {
+		expiresAt := meta.CreatedAt.Add(*expiration)
+		resp.ExpiresAt = &expiresAt
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Handle deleting a document, the management token is passed as a bearer token
+func (h *DocumentHandler) HandleAPIDelete(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Revisions are deleted with their document only
+	key, ok := documentKey(chi.URLParam(r, "id"))
+	if !ok {
+		http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
+		return
+	}
+
+	meta, err := h.loadMetadata(key)
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Msg("Failed to load document metadata")
+		http.Error(w, `{"message": "Error deleting document."}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	if !meta.Authorize(bearerToken(r)) {
+		http.Error(w, `{"message": "Invalid management token."}`, http.StatusUnauthorized)
+		return
+	}
+
+	if err := errors.Join(h.deleteRevisions(key, meta), h.delete(key)); err != nil {
+		log.Error().Err(err).Str("key", key).Msg("Failed to delete document")
+		http.Error(w, `{"message": "Error deleting document."}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	log.Info().Str("key", key).Msg("Deleted document")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Limits the JSON body of an API request carrying a document, JSON escaping may grow content
+// up to six times
+func (h *DocumentHandler) limitJSONBody(w http.ResponseWriter, r *http.Request) {
+	if maxLength := h.policy(RouteDocuments).MaxLength; maxLength > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(maxLength)*6+maxJSONOverhead)
+	}
+}
+
+// Returns the bearer token of the request
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleAPICreate(t *testing.T) {
+	store := &entryMockStorage{mockStorage: &mockStorage{data: make(map[string]string)}, entries: map[string]storage.Entry{}}
+	handler := NewDocumentHandler(6, 1024, store, &mockKeyGenerator{fixedKey: "test123"})
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	body := bytes.NewBufferString(`{"content": "test content", "language": "bash", "title": "boot log", "expires_in": 3600, "visibility": "unlisted"}`)
+	resp := sendRequest(router, http.MethodPost, "/api/v1/documents", body)
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	var created CreateResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	require.Equal(t, "test123", created.Key)
+	require.Equal(t, "https://example.com/test123", created.URL)
+	require.Equal(t, "https://example.com/raw/test123", created.RawURL)
+	require.NotEmpty(t, created.Token)
+	require.NotNil(t, created.ExpiresAt)
+	require.WithinDuration(t, time.Now().Add(time.Hour), *created.ExpiresAt, time.Minute)
+
+	meta, err := handler.loadMetadata("test123")
+	require.NoError(t, err)
+	require.Equal(t, "boot log", meta.Title)
+	require.Equal(t, "bash", meta.Language)
+	require.Equal(t, VisibilityUnlisted, meta.Visibility)
+	require.True(t, meta.Authorize(created.Token))
+	require.NotContains(t, meta.TokenHash, created.Token)
+
+	resp = sendRequest(router, http.MethodGet, "/documents/test123", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var document map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&document))
+	require.Equal(t, "test content", document["data"])
+	require.Equal(t, "boot log", document["title"])
+	require.Equal(t, "bash", document["language"])
+}
+
+func TestHandleAPICreate_Invalid(t *testing.T) {
+	handler := NewDocumentHandler(6, 10, &mockStorage{data: make(map[string]string)}, &mockKeyGenerator{fixedKey: "test123"})
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	for _, body := range []string{
+		`not json`,
+		`{"content": ""}`,
+		`{"content": "test", "expires_in": -1}`,
+		`{"content": "test", "visibility": "secret"}`,
+		`{"content": "this content is too long"}`,
+	} {
+		resp := sendRequest(router, http.MethodPost, "/api/v1/documents", bytes.NewBufferString(body))
+		require.Equal(t, http.StatusBadRequest, resp.Code, body)
+	}
+}
+
+func TestHandleAPICreate_Expiration(t *testing.T) {
+	store := &entryMockStorage{mockStorage: &mockStorage{data: make(map[string]string)}, entries: map[string]storage.Entry{}}
+	handler := NewDocumentHandler(6, 1024, store, &mockKeyGenerator{fixedKey: "test123"})
+	handler.Expiration = ExpirationLimits{Max: 24 * time.Hour}
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/api/v1/documents", bytes.NewBufferString(`{"content": "test content", "expires_in": 604800}`))
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	var created CreateResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	require.NotNil(t, created.ExpiresAt)
+	require.WithinDuration(t, time.Now().Add(24*time.Hour), *created.ExpiresAt, time.Minute)
+
+	// Metadata expires together with the document
+	require.Equal(t, 24*time.Hour, store.entries["test123"].TTL)
+	require.Equal(t, 24*time.Hour, store.entries["test123"+metadataSuffix].TTL)
+}
+
+func TestHandleAPICreate_BurnAfterReading(t *testing.T) {
+	store := newViewMockStorage()
+	handler := NewDocumentHandler(6, 1024, store, &mockKeyGenerator{fixedKey: "test123"})
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/api/v1/documents", bytes.NewBufferString(`{"content": "secret", "burn_after_reading": true}`))
+	require.Equal(t, http.StatusCreated, resp.Code)
+	require.Equal(t, 1, store.entries["test123"].Views)
+
+	// HEAD doesn't burn the document
+	resp = sendRequest(router, http.MethodHead, "/raw/test123", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	resp = sendRequest(router, http.MethodGet, "/raw/test123", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "secret", resp.Body.String())
+
+	resp = sendRequest(router, http.MethodGet, "/raw/test123", nil)
+	require.Equal(t, http.StatusNotFound, resp.Code)
+
+	// Metadata is burned together with the document
+	require.NotContains(t, store.data, "test123"+metadataSuffix)
+}
+
+func TestHandleAPICreate_MaxViews(t *testing.T) {
+	handler := NewDocumentHandler(6, 1024, newViewMockStorage(), &mockKeyGenerator{fixedKey: "test123"})
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/api/v1/documents", bytes.NewBufferString(`{"content": "secret", "max_views": 2}`))
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	resp = sendRequest(router, http.MethodGet, "/documents/test123", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	resp = sendRequest(router, http.MethodHead, "/documents/test123", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	resp = sendRequest(router, http.MethodGet, "/raw/test123", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	for _, path := range []string{"/documents/test123", "/raw/test123"} {
+		resp = sendRequest(router, http.MethodGet, path, nil)
+		require.Equal(t, http.StatusNotFound, resp.Code, path)
+	}
+}
+
+func TestHandleAPICreate_ViewsInvalid(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	for _, body := range []string{
+		`{"content": "secret", "max_views": -1}`,
+		`{"content": "secret", "max_views": 2, "burn_after_reading": true}`,
+		// The mock storage can't limit views
+		`{"content": "secret", "burn_after_reading": true}`,
+	} {
+		resp := sendRequest(router, http.MethodPost, "/api/v1/documents", bytes.NewBufferString(body))
+		require.Equal(t, http.StatusBadRequest, resp.Code, body)
+	}
+}
+
+func TestHandleAPIDelete(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/api/v1/documents", bytes.NewBufferString(`{"content": "test content"}`))
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	var created CreateResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+
+	for _, authorization := range []string{"", "Bearer wrong", created.Token} {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/documents/test123", nil)
+		req.Header.Set("Authorization", authorization)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/documents/test123", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	resp = sendRequest(router, http.MethodGet, "/documents/test123", nil)
+	require.Equal(t, http.StatusNotFound, resp.Code)
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/armbian/ansi-hastebin/internal/diff"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultDiffContext is the number of unchanged lines shown around changes
+const defaultDiffContext = 3
+
+var errInvalidDiffOptions = errors.New("invalid diff options")
+
+// DiffResponse is the JSON response of GET /diff/{a}/{b}
+type DiffResponse struct {
+	A     string      `json:"a"`
+	B     string      `json:"b"`
+	Hunks []diff.Hunk `json:"hunks"`
+}
+
+// diffPage is served to browsers and requests for the HTML format
+var diffPage = template.Must(template.New("diff").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.A}} → {{.B}}</title>
+<style>
+body { background: #002b36; color: #93a1a1; font-family: monospace; }
+a { color: #268bd2; }
+pre { margin: 0; }
+.hunk { color: #6c71c4; margin-top: 1em; }
+.delete { color: #dc322f; }
+.insert { color: #859900; }
+</style>
+</head>
+<body>
+<p><a href="/{{.A}}">{{.A}}</a> → <a href="/{{.B}}">{{.B}}</a></p>
+{{range .Hunks}}<pre class="hunk">@@ -{{.OldStart}},{{.OldLines}} +{{.NewStart}},{{.NewLines}} @@</pre>
+{{range .Lines}}<pre class="{{.Op}}">{{if eq .Op.String "delete"}}-{{else if eq .Op.String "insert"}}+{{else}} {{end}}{{.Text}}</pre>
+{{end}}{{else}}<p>Documents are identical.</p>
+{{end}}</body>
+</html>
+`))
+
+// Returns diff options requested through "context" and "ignore" query parameters
+// Ignore takes a comma separated list of "timestamps" and "ansi".
+func requestedDiffOptions(r *http.Request) (diff.Options, error) {
+	opts := diff.Options{Context: defaultDiffContext}
+
+	if value := r.URL.Query().Get("context"); value != "" {
+		context, err := strconv.Atoi(value)
+		if err != nil || context < 0 {
+			return opts, errInvalidDiffOptions
+		}
+
+		opts.Context = context
+	}
+
+	for _, ignore := range strings.Split(r.URL.Query().Get("ignore"), ",") {
+		switch strings.TrimSpace(ignore) {
+		case "":
+		case "timestamps":
+			opts.IgnoreTimestamps = true
+		case "ansi":
+			opts.IgnoreANSI = true
+		default:
+			return opts, errInvalidDiffOptions
+		}
+	}
+
+	return opts, nil
+}
+
+// Returns format of the diff requested through "format" query parameter or Accept header
+func requestedDiffFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "text/html"):
+		return "html"
+	case strings.Contains(accept, "application/json"):
+		return "json"
+	default:
+		return "text"
+	}
+}
+
+// Handle comparing two documents or revisions of them
+// Reading documents for a diff takes views of documents limited by them.
+func (h *DocumentHandler) HandleDiff(w http.ResponseWriter, r *http.Request) {
+	opts, err := requestedDiffOptions(r)
+	if err != nil {
+		http.Error(w, `{"message": "Invalid diff options."}`, http.StatusBadRequest)
+		return
+	}
+
+	format := requestedDiffFormat(r)
+	if format != "text" && format != "json" && format != "html" {
+		http.Error(w, `{"message": "Invalid diff format."}`, http.StatusBadRequest)
+		return
+	}
+
+	ids := []string{chi.URLParam(r, "a"), chi.URLParam(r, "b")}
+	documents := make([]string, len(ids))
+	for i, id := range ids {
+		key, revision, err := parseKey(id)
+		if err != nil {
+			http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
+			return
+		}
+
+		data, _, err := h.load(key, revision, requestPassword(r), true)
+		if h.passwordError(w, r, key, err, false) {
+			log.Info().Err(err).Str("key", key).Msg("Compared document is protected by password")
+			return
+		}
+
+		if data == "" || err != nil {
+			log.Info().Str("key", key).Msg("Compared document not found")
+			http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
+			return
+		}
+
+		// Extensions only select highlighting of the document
+		ids[i] = strings.Split(id, ".")[0]
+		documents[i] = data
+	}
+
+	hunks := diff.Compare(documents[0], documents[1], opts)
+	log.Info().Str("a", ids[0]).Str("b", ids[1]).Int("hunks", len(hunks)).Msg("Compared documents")
+
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DiffResponse{A: ids[0], B: ids[1], Hunks: hunks})
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		diffPage.Execute(w, DiffResponse{A: ids[0], B: ids[1], Hunks: hunks})
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+		w.Write([]byte(diff.Unified(ids[0], ids[1], hunks)))
+	}
+}
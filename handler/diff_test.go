@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleDiff(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	handler.Store.Set("working", "[    1.000000] boot\n[    1.100000] usb ok\n[    1.200000] done\n", false)
+	handler.Store.Set("broken", "[    2.000000] boot\n[    2.100000] usb failed\n[    2.200000] done\n", false)
+
+	resp := sendRequest(router, http.MethodGet, "/diff/working/broken.txt?ignore=timestamps", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "text/plain; charset=UTF-8", resp.Header().Get("Content-Type"))
+	require.Equal(t, `--- working
++++ broken
+@@ -1,3 +1,3 @@
+ [    1.000000] boot
+-[    1.100000] usb ok
++[    2.100000] usb failed
+ [    1.200000] done
+`, resp.Body.String())
+
+	resp = sendRequest(router, http.MethodGet, "/diff/working/broken?ignore=timestamps&context=0&format=json", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var result DiffResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal(t, "working", result.A)
+	require.Len(t, result.Hunks, 1)
+	require.Equal(t, 2, result.Hunks[0].OldStart)
+	require.Len(t, result.Hunks[0].Lines, 2)
+
+	req := httptest.NewRequest(http.MethodGet, "/diff/working/broken", nil)
+	req.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `<pre class="insert">+[    2.100000] usb failed</pre>`)
+}
+
+func TestHandleDiff_Revisions(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/api/v1/documents", bytes.NewBufferString(`{"content": "one\n"}`))
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	var created CreateResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	require.Equal(t, http.StatusCreated, sendRevision(router, "test123", created.Token, "two\n").Code)
+
+	resp = sendRequest(router, http.MethodGet, "/diff/test123@1/test123", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "--- test123@1\n+++ test123\n@@ -1 +1 @@\n-one\n+two\n", resp.Body.String())
+}
+
+func TestHandleDiff_Errors(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	handler.Store.Set("first", "test\n", false)
+
+	for path, code := range map[string]int{
+		"/diff/first/missing":            http.StatusNotFound,
+		"/diff/first@x/first":            http.StatusNotFound,
+		"/diff/first/first?context=-1":   http.StatusBadRequest,
+		"/diff/first/first?ignore=words": http.StatusBadRequest,
+		"/diff/first/first?format=pdf":   http.StatusBadRequest,
+		"/diff/first/first":              http.StatusOK,
+	} {
+		resp := sendRequest(router, http.MethodGet, path, nil)
+		require.Equal(t, code, resp.Code, path)
+	}
+}
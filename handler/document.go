@@ -1,14 +1,20 @@
 package handler
 
 import (
+	"cmp"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/armbian/ansi-hastebin/internal/keygenerator"
-	"github.com/armbian/ansi-hastebin/internal/storage"
+	"github.com/armbian/ansi-hastebin/internal/highlight"
+	"github.com/armbian/ansi-hastebin/keygenerator"
+	"github.com/armbian/ansi-hastebin/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -27,12 +33,85 @@ var (
 	})
 )
 
+var (
+	errTooLong           = errors.New("document exceeds maximum length")
+	errDeleteUnsupported = errors.New("storage doesn't support delete")
+)
+
+// documentResponse is the body of GET /documents/{id}
+type documentResponse struct {
+	Data     string `json:"data"`
+	Key      string `json:"key"`
+	Title    string `json:"title,omitempty"`
+	Language string `json:"language,omitempty"`
+
+	// Revision is the number of the returned revision, omitted for documents never revised
+	Revision int `json:"revision,omitempty"`
+
+	// Live is set for documents still being streamed, they can be followed until they are sealed
+	Live bool `json:"live,omitempty"`
+}
+
+// Names of upload routes which policies are assigned to
+const (
+	RouteDocuments = "documents"
+	RouteLog       = "log"
+)
+
+// Policy adjusts how documents uploaded through a route are stored
+type Policy struct {
+	// Prefix is prepended to generated keys, the store selects the storage backend by it
+	Prefix string
+
+	// MaxLength is the maximum length of uploaded documents, 0 means the handler's one
+	MaxLength int
+
+	// Expiration is the storage-wide expiration of the route's storage, 0 means the handler's one
+	// Documents limited by views are stored with it explicitly.
+	Expiration time.Duration
+}
+
 // DocumentHandler manages document operations
 type DocumentHandler struct {
 	KeyLength    int
 	MaxLength    int
 	Store        storage.Storage
 	KeyGenerator keygenerator.KeyGenerator
+
+	// Policies are policies of upload routes, routes without one use the defaults
+	Policies map[string]Policy
+
+	// Prefixes are key prefixes of all storage profiles, including ones without a route
+	// Keys of other routes must not start with them, or they would be stored in their profiles.
+	Prefixes []string
+
+	// Expiration limits expiration chosen by uploaders
+	// Without maximum and allowed expirations, StorageExpiration is the maximum.
+	Expiration ExpirationLimits
+
+	// StorageExpiration is the storage-wide expiration, 0 means documents never expire
+	StorageExpiration time.Duration
+
+	// Attempts limits failed attempts to guess passwords of documents
+	Attempts *AttemptLimiter
+
+	// Vanity allows authenticated clients to choose keys of their documents
+	Vanity VanityKeys
+
+	// SafeTerminalAgents are substrings of user agents of terminal clients, matched case-insensitively
+	// Raw documents served to them keep only SGR escape sequences unless requested otherwise.
+	SafeTerminalAgents []string
+
+	// StreamIdleTimeout and StreamMaxDuration limit how long live pastes are kept open
+	StreamIdleTimeout time.Duration
+	StreamMaxDuration time.Duration
+
+	// streams are live pastes uploaded through this instance
+	streams streams
+
+	// revising serializes revisions of a key by hashes of keys, so concurrent revisions
+	// never take the same number. Revisions through other instances aren't serialized.
+	revising [reviseGuardStripes]sync.Mutex
 }
 
 func NewDocumentHandler(keyLength, maxLength int, store storage.Storage, keyGenerator keygenerator.KeyGenerator) *DocumentHandler {
@@ -41,6 +120,11 @@ func NewDocumentHandler(keyLength, maxLength int, store storage.Storage, keyGene
 		MaxLength:    maxLength,
 		Store:        store,
 		KeyGenerator: keyGenerator,
+		Attempts:     NewAttemptLimiter(5, time.Minute),
+
+		SafeTerminalAgents: DefaultSafeTerminalAgents,
+		StreamIdleTimeout:  DefaultStreamIdleTimeout,
+		StreamMaxDuration:  DefaultStreamMaxDuration,
 	}
 }
 
@@ -48,6 +132,11 @@ func NewDocumentHandler(keyLength, maxLength int, store storage.Storage, keyGene
 func (h *DocumentHandler) RegisterRoutes(r chi.Router) {
 	r.Get("/raw/{id}", h.HandleRawGet)
 	r.Head("/raw/{id}", h.HandleRawGet)
+	r.Post("/raw/{id}", h.HandleRawGet)
+
+	r.Get("/html/{id}", h.HandleHTMLGet)
+	r.Head("/html/{id}", h.HandleHTMLGet)
+	r.Get("/languages", h.HandleLanguages)
 
 	r.Post("/log", h.HandlePutLog)
 	r.Put("/log", h.HandlePutLog)
@@ -56,14 +145,35 @@ func (h *DocumentHandler) RegisterRoutes(r chi.Router) {
 
 	r.Get("/documents/{id}", h.HandleGet)
 	r.Head("/documents/{id}", h.HandleGet)
+	r.Get("/documents/{id}/revisions", h.HandleRevisions)
+	r.Get("/documents/{id}/follow", h.HandleFollow)
+
+	r.Put("/stream", h.HandleStream)
+
+	r.Get("/diff/{a}/{b}", h.HandleDiff)
+
+	r.Post("/api/v1/documents", h.HandleAPICreate)
+	r.Delete("/api/v1/documents/{id}", h.HandleAPIDelete)
+	r.Post("/api/v1/documents/{id}/revisions", h.HandleAPIRevise)
 }
 
 // Handle retrieving a document
 func (h *DocumentHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
-	key := strings.Split(chi.URLParam(r, "id"), ".")[0]
-	data, err := h.Store.Get(key, false)
+	key, revision, err := parseKey(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Info().Str("key", key).Msg("Document not found")
+		http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
+		return
+	}
 
-	if data != "" && err == nil {
+	data, meta, err := h.load(key, revision, requestPassword(r), takesView(r))
+	if h.passwordError(w, r, key, err, false) {
+		log.Info().Err(err).Str("key", key).Msg("Document is protected by password")
+		return
+	}
+
+	// Live documents are empty until their first data arrives
+	if (data != "" || meta.Live) && err == nil {
 		log.Info().Str("key", key).Msg("Retrieved document")
 		w.Header().Set("Content-Type", "application/json")
 		if r.Method == http.MethodHead {
@@ -72,7 +182,12 @@ func (h *DocumentHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
 		}
 
 		pasteRead.Inc()
-		json.NewEncoder(w).Encode(map[string]string{"data": data, "key": key})
+		resp := documentResponse{Data: data, Key: key, Title: meta.Title, Language: meta.Language, Live: meta.Live}
+		if len(meta.Revisions) > 0 {
+			resp.Revision = cmp.Or(revision, meta.Latest())
+		}
+
+		json.NewEncoder(w).Encode(resp)
 	} else {
 		log.Info().Str("key", key).Msg("Document not found")
 		http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
@@ -81,19 +196,49 @@ func (h *DocumentHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
 
 // Handle retrieving raw document
 func (h *DocumentHandler) HandleRawGet(w http.ResponseWriter, r *http.Request) {
-	key := strings.Split(chi.URLParam(r, "id"), ".")[0]
-	data, err := h.Store.Get(key, false)
+	id := chi.URLParam(r, "id")
+	key, revision, err := parseKey(id)
+	if err != nil {
+		log.Info().Str("key", key).Msg("Raw document not found")
+		http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
+		return
+	}
+
+	mode, err := h.requestedANSIMode(r)
+	if err != nil {
+		http.Error(w, `{"message": "Invalid ANSI mode."}`, http.StatusBadRequest)
+		return
+	}
+
+	lines, ranged, err := requestedLines(r)
+	if err != nil {
+		http.Error(w, `{"message": "Invalid line range."}`, http.StatusBadRequest)
+		return
+	}
 
-	if data != "" && err == nil {
+	w.Header().Set("Accept-Ranges", rangeUnit)
+	if lines != nil {
+		h.serveRawLines(w, r, id, key, revision, mode, *lines, ranged)
+		return
+	}
+
+	data, meta, err := h.load(key, revision, requestPassword(r), takesView(r))
+	if h.passwordError(w, r, id, err, true) {
+		log.Info().Err(err).Str("key", key).Msg("Raw document is protected by password")
+		return
+	}
+
+	if (data != "" || meta.Live) && err == nil {
 		log.Info().Str("key", key).Msg("Retrieved raw document")
 		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+		w.Header().Set("Vary", "Accept, User-Agent")
 		if r.Method == http.MethodHead {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
 
 		pasteRead.Inc()
-		w.Write([]byte(data))
+		w.Write([]byte(applyANSIMode(mode, data)))
 	} else {
 		log.Info().Str("key", key).Msg("Raw document not found")
 		http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
@@ -103,23 +248,41 @@ func (h *DocumentHandler) HandleRawGet(w http.ResponseWriter, r *http.Request) {
 // Handle adding a new document (POST)
 func (h *DocumentHandler) HandlePost(w http.ResponseWriter, r *http.Request) {
 	var buffer strings.Builder
-	if err := h.readBody(r, &buffer); err != nil {
-		http.Error(w, `{"message": "Error reading request body."}`, http.StatusInternalServerError)
+	if err := h.readBody(r, RouteDocuments, &buffer); err != nil {
+		bodyError(w, err)
 		return
 	}
 
-	if h.MaxLength > 0 && buffer.Len() > h.MaxLength {
-		log.Info().Str("key", "").Msg("Document exceeds max length")
-		http.Error(w, `{"message": "Document exceeds maximum length."}`, http.StatusBadRequest)
+	expiration, err := h.requestedExpiration(r)
+	if err != nil {
+		expirationError(w, err)
 		return
 	}
 
-	key := h.KeyGenerator.Generate(h.KeyLength)
-	h.Store.Set(key, buffer.String(), false)
+	meta, err := requestedMetadata(r)
+	if errors.Is(err, errInvalidViews) {
+		viewsError(w, err)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("Failed to prepare document metadata")
+		http.Error(w, `{"message": "Error adding document."}`, http.StatusInternalServerError)
+		return
+	}
+
+	key, err := h.vanityKey(r, r.Header.Get("X-Key"))
+	if err != nil {
+		keyError(w, err)
+		return
+	}
+
+	key, err = h.create(RouteDocuments, key, r.Header.Get("X-Filename"), buffer.String(), expiration, meta)
+	if err != nil {
+		createError(w, err)
+		return
+	}
 
 	log.Info().Str("key", key).Msg("Added document")
 
-	pasteCreated.Inc()
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"key": key})
 }
@@ -127,39 +290,239 @@ func (h *DocumentHandler) HandlePost(w http.ResponseWriter, r *http.Request) {
 // Handle PUT request that returns a direct link
 func (h *DocumentHandler) HandlePutLog(w http.ResponseWriter, r *http.Request) {
 	var buffer strings.Builder
-	if err := h.readBody(r, &buffer); err != nil {
-		http.Error(w, `{"message": "Error reading request body."}`, http.StatusInternalServerError)
+	if err := h.readBody(r, RouteLog, &buffer); err != nil {
+		bodyError(w, err)
 		return
 	}
 
-	if h.MaxLength > 0 && buffer.Len() > h.MaxLength {
-		log.Info().Str("key", "").Msg("Document exceeds max length")
-		http.Error(w, `{"message": "Document exceeds maximum length."}`, http.StatusBadRequest)
+	expiration, err := h.requestedExpiration(r)
+	if err != nil {
+		expirationError(w, err)
 		return
 	}
 
-	key := h.KeyGenerator.Generate(h.KeyLength)
-	h.Store.Set(key, buffer.String(), false)
+	meta, err := requestedMetadata(r)
+	if errors.Is(err, errInvalidViews) {
+		viewsError(w, err)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("Failed to prepare document metadata")
+		http.Error(w, `{"message": "Error adding document."}`, http.StatusInternalServerError)
+		return
+	}
+
+	key, err := h.vanityKey(r, r.Header.Get("X-Key"))
+	if err != nil {
+		keyError(w, err)
+		return
+	}
+
+	key, err = h.create(RouteLog, key, r.Header.Get("X-Filename"), buffer.String(), expiration, meta)
+	if err != nil {
+		createError(w, err)
+		return
+	}
 
 	log.Info().Str("key", key).Msg("Added document with log link")
 	w.Header().Set("Content-Type", "text/plain")
 	fmt.Fprintf(w, "\nhttps://%s/%s\n\n", r.Host, key)
 }
 
-// Reads body from the request
-func (h *DocumentHandler) readBody(r *http.Request, buffer *strings.Builder) error {
-	if strings.Contains(r.Header.Get("Content-Type"), "multipart/form-data") {
-		r.ParseMultipartForm(32 << 20)
+// Stores a new document uploaded through the route and returns its key
+// Empty key is generated, chosen ones get the prefix of the route too. Language of documents
+// uploaded without one is detected by the filename and content, documents get metadata for it.
+func (h *DocumentHandler) create(route string, key string, filename string, content string, expiration *time.Duration, meta *Metadata) (string, error) {
+	policy := h.policy(route)
+	if policy.MaxLength > 0 && len(content) > policy.MaxLength {
+		log.Info().Str("key", "").Msg("Document exceeds max length")
+		return "", errTooLong
+	}
+
+	if meta == nil || meta.Language == "" {
+		if language := highlight.Detect(filename, content); language != "" {
+			if meta == nil {
+				meta = &Metadata{CreatedAt: time.Now().UTC()}
+			}
+
+			meta.Language = language
+		}
+	}
+
+	// Documents limited by views are stored as entries, which need an explicit expiration
+	if meta != nil && meta.MaxViews > 0 && expiration == nil {
+		expiration = &policy.Expiration
+	}
+
+	if key == "" {
+		for attempt := 1; ; attempt++ {
+			key = policy.Prefix + h.KeyGenerator.Generate(h.KeyLength)
+			if h.routed(key, policy.Prefix) {
+				break
+			}
+
+			if attempt == maxKeyAttempts {
+				log.Error().Str("key", key).Msg("Failed to generate key outside prefixes of other profiles")
+				return "", errKeysExhausted
+			}
+		}
+	} else {
+		key = policy.Prefix + key
+		if !h.routed(key, policy.Prefix) {
+			return "", errReservedKey
+		}
+
+		if taken, err := h.taken(key); err != nil {
+			log.Error().Err(err).Str("key", key).Msg("Failed to check whether key is taken")
+			return "", err
+		} else if taken {
+			return "", errKeyTaken
+		}
+	}
+
+	if err := h.store(key, content, expiration, meta); err != nil {
+		log.Error().Err(err).Str("key", key).Msg("Failed to add document")
+		return "", err
+	}
+
+	pasteCreated.Inc()
+	return key, nil
+}
+
+// Reports whether the key with the prefix of its route is stored in the storage of that prefix,
+// rather than in a profile with a longer prefix it starts with too
+func (h *DocumentHandler) routed(key string, prefix string) bool {
+	starts := func(other string) bool {
+		return len(other) > len(prefix) && strings.HasPrefix(key, other)
+	}
+
+	if slices.ContainsFunc(h.Prefixes, starts) {
+		return false
+	}
+
+	for _, policy := range h.Policies {
+		if starts(policy.Prefix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Loads a revision of a document with its metadata, revision 0 is the latest one
+// Consume takes a view of documents limited by them. Documents protected by password
+// are only loaded with the right one.
+func (h *DocumentHandler) load(key string, revision int, password string, consume bool) (string, Metadata, error) {
+	meta, err := h.loadMetadata(key)
+	if err != nil {
+		return "", meta, err
+	}
+
+	if err := h.checkPassword(key, meta, password); err != nil {
+		return "", meta, err
+	}
+
+	data, err := h.read(key, revision, meta, consume)
+	return data, meta, err
+}
+
+// Reads the revision of the document described by meta, its password has to be checked already
+func (h *DocumentHandler) read(key string, revision int, meta Metadata, consume bool) (string, error) {
+	if revision > meta.Latest() {
+		return "", storage.ErrNotFound
+	}
+
+	// Documents never revised have only the first revision, stored under the key
+	if revision > 0 && len(meta.Revisions) > 0 {
+		return h.Store.Get(revisionKey(key, revision), false)
+	}
+
+	if consume && meta.MaxViews > 0 {
+		return h.consume(key)
+	}
+
+	return h.Store.Get(key, false)
+}
+
+// Returns policy of the route with defaults applied
+func (h *DocumentHandler) policy(route string) Policy {
+	policy := h.Policies[route]
+	if policy.MaxLength == 0 {
+		policy.MaxLength = h.MaxLength
+	}
+
+	if policy.Expiration == 0 {
+		policy.Expiration = h.StorageExpiration
+	}
+
+	return policy
+}
+
+// Reads body from the request, decoding it by its Content-Encoding
+// Decoded bodies are read up to the maximum length of the route, so small compressed
+// bodies can't expand into huge documents.
+func (h *DocumentHandler) readBody(r *http.Request, route string, buffer *strings.Builder) error {
+	body, err := decodeBody(r)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	multipart := strings.Contains(r.Header.Get("Content-Type"), "multipart/form-data")
+	if maxLength := int64(h.policy(route).MaxLength); maxLength > 0 {
+		if multipart {
+			maxLength += maxFormOverhead
+		}
+
+		body = &cappedReader{ReadCloser: body, limit: maxLength}
+	}
+
+	if multipart {
+		r.Body = body
+		if err := r.ParseMultipartForm(32 << 20); errors.Is(err, errTooLong) || errors.Is(err, errInvalidEncoding) {
+			return err
+		}
+
 		if val := r.FormValue("data"); val != "" {
 			buffer.WriteString(val)
 		}
 	} else {
-		data, err := io.ReadAll(r.Body)
+		data, err := io.ReadAll(body)
 		if err != nil {
-			log.Error().Err(err).Msg("Error reading request body")
 			return err
 		}
 		buffer.WriteString(string(data))
 	}
 	return nil
 }
+
+// Writes the response to a request body which couldn't be read
+func bodyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errUnsupportedEncoding):
+		http.Error(w, `{"message": "Unsupported content encoding."}`, http.StatusUnsupportedMediaType)
+	case errors.Is(err, errInvalidEncoding):
+		http.Error(w, `{"message": "Invalid encoded request body."}`, http.StatusBadRequest)
+	case errors.Is(err, errTooLong):
+		http.Error(w, `{"message": "Document exceeds maximum length."}`, http.StatusBadRequest)
+	default:
+		log.Error().Err(err).Msg("Error reading request body")
+		http.Error(w, `{"message": "Error reading request body."}`, http.StatusInternalServerError)
+	}
+}
+
+// Writes the response to a document which couldn't be created
+func createError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errTooLong):
+		http.Error(w, `{"message": "Document exceeds maximum length."}`, http.StatusBadRequest)
+	case errors.Is(err, errExpirationUnsupported):
+		expirationError(w, err)
+	case errors.Is(err, errViewsUnsupported):
+		viewsError(w, err)
+	case errors.Is(err, errKeyTaken), errors.Is(err, errReservedKey):
+		keyError(w, err)
+	default:
+		log.Error().Err(err).Msg("Error adding document")
+		http.Error(w, `{"message": "Error adding document."}`, http.StatusServiceUnavailable)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/armbian/ansi-hastebin/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -17,21 +18,30 @@ import (
 
 type mockStorage struct {
 	data map[string]string
+	err  error
 }
 
 func (m *mockStorage) Get(key string, _ bool) (string, error) {
 	val, exists := m.data[key]
 	if !exists {
-		return "", fmt.Errorf("not found")
+		return "", storage.ErrNotFound
 	}
 	return val, nil
 }
 
 func (m *mockStorage) Set(key, value string, _ bool) error {
+	if m.err != nil {
+		return m.err
+	}
 	m.data[key] = value
 	return nil
 }
 
+func (m *mockStorage) Delete(key string) error {
+	delete(m.data, key)
+	return nil
+}
+
 func (m *mockStorage) Close() error {
 	return nil
 }
@@ -171,6 +181,89 @@ func TestHandlePost_ExceedsMaxLength(t *testing.T) {
 	require.Equal(t, "{\"message\": \"Document exceeds maximum length.\"}\n", resp.Body.String())
 }
 
+func TestHandlePost_StorageError(t *testing.T) {
+	store := &mockStorage{data: make(map[string]string), err: fmt.Errorf("connection refused")}
+	handler := NewDocumentHandler(6, 1024, store, &mockKeyGenerator{fixedKey: "test123"})
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/documents", bytes.NewBufferString("test content"))
+	require.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	require.NotContains(t, resp.Body.String(), "test123")
+
+	resp = sendRequest(router, http.MethodPut, "/log", bytes.NewBufferString("log entry"))
+	require.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	require.NotContains(t, resp.Body.String(), "test123")
+}
+
+func TestHandlePutLog_Policy(t *testing.T) {
+	store := &mockStorage{data: make(map[string]string)}
+	handler := NewDocumentHandler(6, 10, store, &mockKeyGenerator{fixedKey: "test123"})
+	handler.Policies = map[string]Policy{
+		RouteLog: {Prefix: "log-", MaxLength: 100},
+	}
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPut, "/log", bytes.NewBufferString("this content is too long"))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Contains(t, resp.Body.String(), "log-test123")
+	require.Equal(t, "this content is too long", store.data["log-test123"])
+
+	// Routes without a policy keep the defaults
+	resp = sendRequest(router, http.MethodPost, "/documents", bytes.NewBufferString("this content is too long"))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = sendRequest(router, http.MethodPost, "/documents", bytes.NewBufferString("short"))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "short", store.data["test123"])
+}
+
+// sequenceKeyGenerator generates the keys in order, repeating the last one
+type sequenceKeyGenerator struct {
+	keys []string
+}
+
+func (s *sequenceKeyGenerator) Generate(_ int) string {
+	key := s.keys[0]
+	if len(s.keys) > 1 {
+		s.keys = s.keys[1:]
+	}
+	return key
+}
+
+func TestHandlePost_ProfilePrefixes(t *testing.T) {
+	store := &mockStorage{data: make(map[string]string)}
+	handler := NewDocumentHandler(6, 1024, store, &sequenceKeyGenerator{keys: []string{"logabc", "lxyz", "abcdef"}})
+	handler.Policies = map[string]Policy{RouteLog: {Prefix: "log"}}
+	handler.Prefixes = []string{"log", "l"}
+	handler.Vanity = VanityKeys{Tokens: []string{"client-token"}, MinLength: 3, MaxLength: 64}
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	// Generated keys starting with prefixes of profiles are generated again
+	resp := sendRequest(router, http.MethodPost, "/documents", bytes.NewBufferString("content"))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Contains(t, resp.Body.String(), `"abcdef"`)
+	require.Equal(t, "content", store.data["abcdef"])
+
+	// Chosen keys can't land in other profiles
+	resp = sendVanityRequest(router, http.MethodPost, "/documents", "log-x", "client-token", "content")
+	require.Equal(t, http.StatusConflict, resp.Code)
+	require.NotContains(t, store.data, "log-x")
+
+	// Keys of the route's own prefix only avoid longer prefixes
+	handler.KeyGenerator = &sequenceKeyGenerator{keys: []string{"abc"}}
+	resp = sendRequest(router, http.MethodPut, "/log", bytes.NewBufferString("log"))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "log", store.data["logabc"])
+
+	// Giving up when no generated key is free
+	handler.KeyGenerator = &sequenceKeyGenerator{keys: []string{"lost"}}
+	resp = sendRequest(router, http.MethodPost, "/documents", bytes.NewBufferString("content"))
+	require.Equal(t, http.StatusServiceUnavailable, resp.Code)
+}
+
 func BenchmarkHandlePost(b *testing.B) {
 	handler := setupHandler()
 	router := chi.NewRouter()
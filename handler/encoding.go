@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Content encodings of request bodies accepted by compatibility routes
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+	EncodingXZ   = "xz"
+)
+
+// maxZstdWindow limits memory zstd frames may ask for, it is far above windows of the compression levels
+const maxZstdWindow = 64 << 20
+
+// maxFormOverhead is the size of multipart forms beyond the document, such as boundaries and headers
+const maxFormOverhead = 64 << 10
+
+var (
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+	errInvalidEncoding     = errors.New("invalid encoded request body")
+)
+
+// Returns a reader decoding the body by its Content-Encoding header
+// Only one encoding is accepted, every layer would take memory of its own decoder, so a small
+// body encoded many times could exhaust it.
+func decodeBody(r *http.Request) (io.ReadCloser, error) {
+	var encodings []string
+	for _, encoding := range strings.Split(r.Header.Get("Content-Encoding"), ",") {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding == "" || encoding == "identity" {
+			continue
+		}
+
+		encodings = append(encodings, encoding)
+	}
+
+	if len(encodings) == 0 {
+		return r.Body, nil
+	} else if len(encodings) > 1 {
+		r.Body.Close()
+		return nil, fmt.Errorf("%w: %d encodings", errUnsupportedEncoding, len(encodings))
+	}
+
+	body, err := decoder(encodings[0], r.Body)
+	if err != nil {
+		r.Body.Close()
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// Returns a reader decoding the encoding, closing it closes body too
+func decoder(encoding string, body io.ReadCloser) (io.ReadCloser, error) {
+	source := &sourceReader{Reader: body}
+
+	switch encoding {
+	case EncodingGzip, "x-gzip":
+		reader, err := gzip.NewReader(source)
+		if err != nil {
+			return nil, source.wrap(err)
+		}
+
+		return decodedBody{Reader: reader, close: func() { reader.Close() }, source: source, body: body}, nil
+	case EncodingZstd:
+		reader, err := zstd.NewReader(source, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true), zstd.WithDecoderMaxWindow(maxZstdWindow))
+		if err != nil {
+			return nil, source.wrap(err)
+		}
+
+		return decodedBody{Reader: reader, close: reader.Close, source: source, body: body}, nil
+	case EncodingXZ:
+		reader, err := xz.NewReader(source)
+		if err != nil {
+			return nil, source.wrap(err)
+		}
+
+		return decodedBody{Reader: reader, close: func() {}, source: source, body: body}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", errUnsupportedEncoding, encoding)
+	}
+}
+
+// sourceReader reads the encoded body and keeps its failure, so it isn't taken for a malformed encoding
+type sourceReader struct {
+	io.Reader
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		s.err = err
+	}
+
+	return n, err
+}
+
+// Returns the failure of reading the body, or err of the decoder as a malformed encoding
+func (s *sourceReader) wrap(err error) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	return fmt.Errorf("%w: %w", errInvalidEncoding, err)
+}
+
+// decodedBody is a body read through a decoder, errors of the decoder mean the body is malformed
+type decodedBody struct {
+	io.Reader
+	close  func()
+	source *sourceReader
+	body   io.ReadCloser
+}
+
+func (d decodedBody) Read(p []byte) (int, error) {
+	n, err := d.Reader.Read(p)
+	if err != nil && err != io.EOF && !errors.Is(err, errTooLong) {
+		err = d.source.wrap(err)
+	}
+
+	return n, err
+}
+
+func (d decodedBody) Close() error {
+	d.close()
+	return d.body.Close()
+}
+
+// cappedReader fails with errTooLong once more than limit bytes are read, unlike io.LimitReader
+// which ends the body silently
+type cappedReader struct {
+	io.ReadCloser
+	limit int64
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if c.limit < 0 {
+		return 0, errTooLong
+	}
+
+	// One byte over the limit tells bodies of exactly the limit from longer ones
+	if int64(len(p)) > c.limit+1 {
+		p = p[:c.limit+1]
+	}
+
+	n, err := c.ReadCloser.Read(p)
+	c.limit -= int64(n)
+	if c.limit < 0 {
+		return n, errTooLong
+	}
+
+	return n, err
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+)
+
+// Returns content compressed by the encoding
+func encode(t *testing.T, encoding string, content string) []byte {
+	var buffer bytes.Buffer
+
+	var writer io.WriteCloser
+	var err error
+	switch encoding {
+	case EncodingGzip:
+		writer = gzip.NewWriter(&buffer)
+	case EncodingZstd:
+		writer, err = zstd.NewWriter(&buffer)
+	case EncodingXZ:
+		writer, err = xz.NewWriter(&buffer)
+	}
+	require.NoError(t, err)
+
+	_, err = writer.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	return buffer.Bytes()
+}
+
+func sendEncoded(handler http.Handler, method, path, encoding string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Content-Encoding", encoding)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlePost_Encoded(t *testing.T) {
+	content := strings.Repeat("[    1.234567] usb 1-1: new high-speed USB device\n", 20)
+
+	for _, encoding := range []string{EncodingGzip, EncodingZstd, EncodingXZ} {
+		for _, route := range []struct{ method, path string }{{http.MethodPost, "/documents"}, {http.MethodPut, "/log"}} {
+			handler := NewDocumentHandler(6, 1024, &mockStorage{data: make(map[string]string)}, &mockKeyGenerator{fixedKey: "test123"})
+			router := chi.NewRouter()
+			handler.RegisterRoutes(router)
+
+			resp := sendEncoded(router, route.method, route.path, encoding, encode(t, encoding, content))
+			require.Equal(t, http.StatusOK, resp.Code, encoding+" "+route.path)
+
+			data, err := handler.Store.Get("test123", false)
+			require.NoError(t, err)
+			require.Equal(t, content, data, encoding+" "+route.path)
+		}
+	}
+}
+
+func TestHandlePost_EncodedExceedsMaxLength(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	// Highly compressible content expands far beyond the limit
+	bomb := strings.Repeat("A", 10<<20)
+	for _, encoding := range []string{EncodingGzip, EncodingZstd, EncodingXZ} {
+		body := encode(t, encoding, bomb)
+		require.Less(t, len(body), 1<<20)
+
+		resp := sendEncoded(router, http.MethodPost, "/documents", encoding, body)
+		require.Equal(t, http.StatusBadRequest, resp.Code, encoding)
+
+		var message map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&message))
+		require.Equal(t, "Document exceeds maximum length.", message["message"], encoding)
+	}
+
+	_, err := handler.Store.Get("test123", false)
+	require.Error(t, err)
+}
+
+func TestHandlePost_InvalidEncoding(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendEncoded(router, http.MethodPost, "/documents", "br", []byte("test content"))
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.Code)
+
+	resp = sendEncoded(router, http.MethodPost, "/documents", EncodingGzip, []byte("not gzip"))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	// Truncated streams are malformed too
+	body := encode(t, EncodingZstd, strings.Repeat("test content\n", 50))
+	resp = sendEncoded(router, http.MethodPost, "/documents", EncodingZstd, body[:len(body)/2])
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = sendEncoded(router, http.MethodPost, "/documents", "identity", []byte("test content"))
+	require.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestHandlePost_StackedEncodings(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	// Every layer takes memory of its own decoder, so bodies are decoded once at most
+	body := encode(t, EncodingZstd, string(encode(t, EncodingZstd, "test content")))
+	resp := sendEncoded(router, http.MethodPost, "/documents", "zstd, zstd", body)
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.Code)
+
+	resp = sendEncoded(router, http.MethodPost, "/documents", strings.Repeat("zstd, ", 100)+"zstd", []byte{})
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.Code)
+
+	resp = sendEncoded(router, http.MethodPost, "/documents", "identity, gzip", encode(t, EncodingGzip, "test content"))
+	require.Equal(t, http.StatusOK, resp.Code)
+}
+
+// failingReader fails like a client disconnecting in the middle of the body
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func TestDecodeBody_ReadError(t *testing.T) {
+	body := encode(t, EncodingGzip, strings.Repeat("test content\n", 1000))
+
+	// Failures of reading the body are no malformed encodings
+	for _, partial := range [][]byte{body[:5], body[:len(body)/2]} {
+		req := httptest.NewRequest(http.MethodPost, "/documents", io.MultiReader(bytes.NewReader(partial), failingReader{}))
+		req.Header.Set("Content-Encoding", EncodingGzip)
+
+		decoded, err := decodeBody(req)
+		if err == nil {
+			_, err = io.ReadAll(decoded)
+		}
+
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF, len(partial))
+		require.NotErrorIs(t, err, errInvalidEncoding, len(partial))
+	}
+}
+
+func TestHandlePost_EncodedMultipart(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	require.NoError(t, writer.WriteField("data", "test content"))
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/documents", bytes.NewReader(encode(t, EncodingGzip, form.String())))
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Content-Encoding", EncodingGzip)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	data, err := handler.Store.Get("test123", false)
+	require.NoError(t, err)
+	require.Equal(t, "test content", data)
+}
+
+func TestCappedReader(t *testing.T) {
+	data, err := io.ReadAll(&cappedReader{ReadCloser: io.NopCloser(strings.NewReader("12345")), limit: 5})
+	require.NoError(t, err)
+	require.Equal(t, "12345", string(data))
+
+	_, err = io.ReadAll(&cappedReader{ReadCloser: io.NopCloser(strings.NewReader("123456")), limit: 5})
+	require.ErrorIs(t, err, errTooLong)
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errInvalidExpiration     = errors.New("invalid expiration")
+	errExpirationNotAllowed  = errors.New("expiration is not allowed")
+	errExpirationUnsupported = errors.New("storage doesn't support custom expiration")
+)
+
+// expirationUnits are units accepted by ParseExpiration
+var expirationUnits = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// ExpirationLimits restricts expiration chosen by uploaders
+type ExpirationLimits struct {
+	// Min is the shortest expiration, shorter ones are raised to it
+	Min time.Duration
+
+	// Max is the longest expiration, longer ones are lowered to it
+	// 0 means no limit, documents which never expire are rejected with one unless allowed.
+	Max time.Duration
+
+	// Allowed lists the only accepted expirations, 0 stands for no expiration
+	// Empty list accepts any expiration.
+	Allowed []time.Duration
+}
+
+// Apply returns the expiration allowed for the requested one, 0 means no expiration
+func (l ExpirationLimits) Apply(expiration time.Duration) (time.Duration, error) {
+	if len(l.Allowed) > 0 && !slices.Contains(l.Allowed, expiration) {
+		return 0, errExpirationNotAllowed
+	}
+
+	if expiration == 0 {
+		// Documents which never expire would outlive the maximum
+		if l.Max > 0 && !slices.Contains(l.Allowed, 0) {
+			return 0, errExpirationNotAllowed
+		}
+
+		return 0, nil
+	}
+
+	if l.Max > 0 && expiration > l.Max {
+		return l.Max, nil
+	}
+
+	return max(expiration, l.Min), nil
+}
+
+// ParseExpiration parses expiration such as "3600", "90s", "15m", "1h", "30d", "2w" or "never"
+// Numbers without unit are seconds, "never" is returned as 0.
+func ParseExpiration(value string) (time.Duration, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "never" {
+		return 0, nil
+	}
+
+	unit := time.Second
+	if len(value) > 0 {
+		if u, ok := expirationUnits[value[len(value)-1]]; ok {
+			unit = u
+			value = value[:len(value)-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 || n > int64(100*365*24*time.Hour/unit) {
+		return 0, errInvalidExpiration
+	}
+
+	return time.Duration(n) * unit, nil
+}
+
+// Returns expiration requested through "expires" query parameter or X-Expires header
+// Nil means the uploader didn't request any, so the storage-wide expiration applies.
+func (h *DocumentHandler) requestedExpiration(r *http.Request) (*time.Duration, error) {
+	value := r.URL.Query().Get("expires")
+	if value == "" {
+		value = r.Header.Get("X-Expires")
+	}
+
+	if value == "" {
+		return nil, nil
+	}
+
+	expiration, err := ParseExpiration(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.limitExpiration(expiration)
+}
+
+// Applies expiration limits, 0 means no expiration
+func (h *DocumentHandler) limitExpiration(expiration time.Duration) (*time.Duration, error) {
+	limits := h.Expiration
+
+	// Unconfigured limits keep uploaders within the lifetime chosen by the operator
+	if limits.Max == 0 && len(limits.Allowed) == 0 {
+		limits.Max = h.StorageExpiration
+	}
+
+	expiration, err := limits.Apply(expiration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &expiration, nil
+}
+
+// Writes response for an expiration error
+func expirationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errExpirationNotAllowed):
+		http.Error(w, `{"message": "Expiration is not allowed."}`, http.StatusBadRequest)
+	case errors.Is(err, errExpirationUnsupported):
+		http.Error(w, `{"message": "Custom expiration is not supported."}`, http.StatusBadRequest)
+	default:
+		http.Error(w, `{"message": "Invalid expiration."}`, http.StatusBadRequest)
+	}
+}
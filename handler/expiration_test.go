@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// entryMockStorage records entries stored with their own expiration
+type entryMockStorage struct {
+	*mockStorage
+	entries map[string]storage.Entry
+}
+
+func (m *entryMockStorage) SetEntry(entry storage.Entry) error {
+	m.entries[entry.Key] = entry
+	return m.mockStorage.Set(entry.Key, entry.Value, false)
+}
+
+func TestParseExpiration(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		err      bool
+	}{
+		{value: "3600", expected: time.Hour},
+		{value: "90s", expected: 90 * time.Second},
+		{value: "15m", expected: 15 * time.Minute},
+		{value: "1h", expected: time.Hour},
+		{value: "30d", expected: 30 * 24 * time.Hour},
+		{value: "2W", expected: 14 * 24 * time.Hour},
+		{value: "never", expected: 0},
+		{value: "", err: true},
+		{value: "0", err: true},
+		{value: "-1h", err: true},
+		{value: "1y", err: true},
+		{value: "h", err: true},
+		{value: "99999999999d", err: true},
+	}
+
+	for _, test := range tests {
+		expiration, err := ParseExpiration(test.value)
+		if test.err {
+			require.Error(t, err, test.value)
+			continue
+		}
+
+		require.NoError(t, err, test.value)
+		require.Equal(t, test.expected, expiration, test.value)
+	}
+}
+
+func TestExpirationLimits_Apply(t *testing.T) {
+	limits := ExpirationLimits{Min: time.Hour, Max: 7 * 24 * time.Hour}
+
+	for requested, expected := range map[time.Duration]time.Duration{
+		time.Minute:          time.Hour,
+		2 * time.Hour:        2 * time.Hour,
+		30 * 24 * time.Hour:  7 * 24 * time.Hour,
+		7 * 24 * time.Hour:   7 * 24 * time.Hour,
+		24*time.Hour + 1e9:   24*time.Hour + 1e9,
+		time.Hour - 1e9:      time.Hour,
+		365 * 24 * time.Hour: 7 * 24 * time.Hour,
+	} {
+		expiration, err := limits.Apply(requested)
+		require.NoError(t, err)
+		require.Equal(t, expected, expiration, requested.String())
+	}
+
+	// Documents which never expire would outlive the maximum
+	_, err := limits.Apply(0)
+	require.ErrorIs(t, err, errExpirationNotAllowed)
+
+	// Without maximum documents may never expire
+	expiration, err := ExpirationLimits{}.Apply(0)
+	require.NoError(t, err)
+	require.Zero(t, expiration)
+
+	allowed := ExpirationLimits{Allowed: []time.Duration{time.Hour, 0}}
+
+	expiration, err = allowed.Apply(time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, expiration)
+
+	expiration, err = allowed.Apply(0)
+	require.NoError(t, err)
+	require.Zero(t, expiration)
+
+	_, err = allowed.Apply(2 * time.Hour)
+	require.ErrorIs(t, err, errExpirationNotAllowed)
+}
+
+func TestHandlePost_Expiration(t *testing.T) {
+	store := &entryMockStorage{mockStorage: &mockStorage{data: make(map[string]string)}, entries: map[string]storage.Entry{}}
+	handler := NewDocumentHandler(6, 1024, store, &mockKeyGenerator{fixedKey: "test123"})
+	handler.Expiration = ExpirationLimits{Max: 7 * 24 * time.Hour}
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/documents?expires=1h", bytes.NewBufferString("test content"))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	entry := store.entries["test123"]
+	require.Equal(t, time.Hour, entry.TTL)
+	require.WithinDuration(t, time.Now().Add(time.Hour), entry.Expiration, time.Minute)
+
+	// Header works for /log and the maximum applies
+	req := httptest.NewRequest(http.MethodPut, "/log", bytes.NewBufferString("log entry"))
+	req.Header.Set("X-Expires", "30d")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, 7*24*time.Hour, store.entries["test123"].TTL)
+
+	resp = sendRequest(router, http.MethodPost, "/documents?expires=soon", bytes.NewBufferString("test content"))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	require.Contains(t, resp.Body.String(), "Invalid expiration.")
+
+	handler.Expiration = ExpirationLimits{Allowed: []time.Duration{time.Hour}}
+	resp = sendRequest(router, http.MethodPost, "/documents?expires=2h", bytes.NewBufferString("test content"))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	require.Contains(t, resp.Body.String(), "Expiration is not allowed.")
+}
+
+func TestHandlePost_ExpirationDefault(t *testing.T) {
+	store := &entryMockStorage{mockStorage: &mockStorage{data: make(map[string]string)}, entries: map[string]storage.Entry{}}
+	handler := NewDocumentHandler(6, 1024, store, &mockKeyGenerator{fixedKey: "test123"})
+	handler.StorageExpiration = 24 * time.Hour
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	// Without configured limits uploaders can't outlive the storage-wide expiration
+	resp := sendRequest(router, http.MethodPost, "/documents?expires=100w", bytes.NewBufferString("test content"))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, 24*time.Hour, store.entries["test123"].TTL)
+
+	resp = sendRequest(router, http.MethodPost, "/documents?expires=never", bytes.NewBufferString("test content"))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	require.Contains(t, resp.Body.String(), "Expiration is not allowed.")
+
+	resp = sendRequest(router, http.MethodPost, "/documents?expires=1h", bytes.NewBufferString("test content"))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, time.Hour, store.entries["test123"].TTL)
+}
+
+func TestHandlePost_ExpirationUnsupported(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/documents?expires=1h", bytes.NewBufferString("test content"))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	require.Contains(t, resp.Body.String(), "Custom expiration is not supported.")
+
+	// Documents which never expire don't need own expiration support
+	resp = sendRequest(router, http.MethodPost, "/documents?expires=never", bytes.NewBufferString("test content"))
+	require.Equal(t, http.StatusOK, resp.Code)
+}
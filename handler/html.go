@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"cmp"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/armbian/ansi-hastebin/internal/ansi"
+	"github.com/armbian/ansi-hastebin/internal/highlight"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// htmlPage is a document rendered for clients without JavaScript, such as crawlers and chat previews
+var htmlPage = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { background: {{.Background}}; color: {{.Foreground}}; margin: 0; }
+pre { font-family: monospace; margin: 0; padding: 1em; white-space: pre-wrap; word-wrap: break-word; }
+a { color: {{.Foreground}}; }
+</style>
+</head>
+<body>
+<pre>{{.Content}}</pre>
+<p><a href="/raw/{{.ID}}">raw</a></p>
+</body>
+</html>
+`))
+
+// Handle retrieving a document rendered as HTML page
+func (h *DocumentHandler) HandleHTMLGet(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	key, revision, err := parseKey(id)
+	if err != nil {
+		log.Info().Str("key", key).Msg("Rendered document not found")
+		http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
+		return
+	}
+
+	// Link previews open documents before their recipients do, so they don't take views
+	noScript := NoScript(r)
+	data, meta, err := h.load(key, revision, requestPassword(r), takesView(r) && !noScript)
+	if h.passwordError(w, r, key, err, false) {
+		log.Info().Err(err).Str("key", key).Msg("Rendered document is protected by password")
+		return
+	}
+
+	if data == "" || err != nil {
+		log.Info().Str("key", key).Msg("Rendered document not found")
+		http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
+		return
+	}
+
+	log.Info().Str("key", key).Msg("Retrieved rendered document")
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	title := meta.Title
+	if title == "" {
+		title = key
+	}
+
+	// The extension in the URL overrides the stored language, documents without one are terminal output
+	_, extension, _ := strings.Cut(id, ".")
+	language := cmp.Or(highlight.Lookup(extension), meta.Language, highlight.ANSI)
+
+	content, err := highlight.HTML(language, data)
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Str("language", language).Msg("Failed to highlight document")
+		content = ansi.ToHTML(data)
+	}
+
+	foreground, background := highlight.Colors(language)
+
+	// Documents limited by views are left to readers running the web view or fetching them raw
+	if noScript && meta.MaxViews > 0 {
+		content = template.HTMLEscapeString("This document can be read a limited number of times, it is not shown in previews.")
+	}
+
+	pasteRead.Inc()
+	htmlPage.Execute(w, map[string]any{
+		"ID":         id,
+		"Title":      title,
+		"Foreground": template.CSS(foreground),
+		"Background": template.CSS(background),
+		// Text of the document is escaped by the renderer
+		"Content": template.HTML(content),
+	})
+}
+
+// Handle listing languages documents can be highlighted as
+func (h *DocumentHandler) HandleLanguages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(highlight.Languages())
+}
+
+// NoScriptAgents are substrings of user agents of clients which don't run JavaScript, matched
+// case-insensitively, such as crawlers and link previews of chat services
+var NoScriptAgents = []string{
+	"bot", "crawler", "spider", "facebookexternalhit", "slack", "discord", "telegram", "whatsapp",
+}
+
+// TextBrowsers are products of text-mode browsers, matched case-insensitively against the first
+// product of user agents, since their names are common words
+var TextBrowsers = []string{"lynx", "w3m", "links", "elinks"}
+
+// NoScript reports whether the client doesn't run JavaScript, so the web view shows it nothing
+func NoScript(r *http.Request) bool {
+	userAgent := strings.ToLower(r.UserAgent())
+	product, _, _ := strings.Cut(userAgent, "/")
+	product, _, _ = strings.Cut(product, " ")
+
+	return slices.Contains(TextBrowsers, product) ||
+		slices.ContainsFunc(NoScriptAgents, func(agent string) bool { return strings.Contains(userAgent, agent) })
+}
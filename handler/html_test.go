@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/armbian/ansi-hastebin/internal/highlight"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleHTMLGet(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodGet, "/html/test123", nil)
+	require.Equal(t, http.StatusNotFound, resp.Code)
+
+	handler.Store.Set("test123", "\x1b[31merror\x1b[0m <script>alert(1)</script>\n", false)
+
+	resp = sendRequest(router, http.MethodGet, "/html/test123.log", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "text/html; charset=UTF-8", resp.Header().Get("Content-Type"))
+
+	body := resp.Body.String()
+	require.Contains(t, body, "<title>test123</title>")
+	require.Contains(t, body, `<pre><span style="color:#ff5252">error</span> &lt;script&gt;alert(1)&lt;/script&gt;`)
+	require.Contains(t, body, "background: #000; color: #FFF;")
+	require.Contains(t, body, `<a href="/raw/test123.log">`)
+	require.NotContains(t, body, "<script>")
+
+	resp = sendRequest(router, http.MethodHead, "/html/test123", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Empty(t, resp.Body.String())
+}
+
+func TestHandleHTMLGet_Highlighted(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	req := httptest.NewRequest(http.MethodPost, "/documents", strings.NewReader("#!/usr/bin/env python3\nprint('<hello>')\n"))
+	req.Header.Set("X-Filename", "hello")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	meta, err := handler.loadMetadata("test123")
+	require.NoError(t, err)
+	require.Equal(t, "python", meta.Language)
+
+	resp = sendRequest(router, http.MethodGet, "/html/test123", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	body := resp.Body.String()
+	require.Contains(t, body, "&lt;hello&gt;")
+	require.Contains(t, body, "<span style=")
+	require.Contains(t, body, "background: #002b36;")
+
+	// Extension of the URL overrides the detected language
+	resp = sendRequest(router, http.MethodGet, "/html/test123.ans", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Contains(t, resp.Body.String(), "background: #000; color: #FFF;")
+}
+
+func TestHandleLanguages(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodGet, "/languages", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+
+	var languages []highlight.Language
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&languages))
+	require.Contains(t, languages, highlight.Languages()[0])
+	require.Greater(t, len(languages), 100)
+}
+
+func TestNoScript(t *testing.T) {
+	for agent, expected := range map[string]bool{
+		"Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0": false,
+		"curl/8.5.0": false,
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)": true,
+		"Lynx/2.9.0dev.12 libwww-FM/2.14":                                          true,
+		"Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)":        true,
+		"TelegramBot (like TwitterBot)":                                            true,
+		"Links (2.29; Linux 6.1.0 x86_64; GNU C 12.2; text)":                       true,
+		"ELinks/0.16.1 (textmode; Linux; 80x24-2)":                                 true,
+		"LinkChecker/10.2 (+https://example.com/links)":                            false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/test123", nil)
+		req.Header.Set("User-Agent", agent)
+		require.Equal(t, expected, NoScript(req), agent)
+	}
+}
+
+func TestHandleHTMLGet_NoScriptViews(t *testing.T) {
+	handler := NewDocumentHandler(6, 1024, newViewMockStorage(), &mockKeyGenerator{fixedKey: "test123"})
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/api/v1/documents", strings.NewReader(`{"content": "psk=secret", "max_views": 1}`))
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	// Link previews neither see nor burn documents limited by views
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/html/test123", nil)
+		req.Header.Set("User-Agent", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.NotContains(t, rec.Body.String(), "psk=secret")
+	}
+
+	resp = sendRequest(router, http.MethodGet, "/raw/test123", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "psk=secret", resp.Body.String())
+
+	resp = sendRequest(router, http.MethodGet, "/raw/test123", nil)
+	require.Equal(t, http.StatusNotFound, resp.Code)
+}
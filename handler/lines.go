@@ -0,0 +1,349 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// lineIndexSuffix is appended to the key of a document to form the key of its line index
+const lineIndexSuffix = ".lines"
+
+// lineIndexInterval is the number of lines between offsets kept by line indexes
+// Ranges are read from the closest offsets, so at most this many extra lines are read.
+const lineIndexInterval = 256
+
+// minIndexedLength is the length from which documents get a line index, shorter ones are read whole
+const minIndexedLength = 64 << 10
+
+// rangeUnit is the unit of Range headers requesting lines of raw documents
+const rangeUnit = "lines"
+
+var (
+	errInvalidLines     = errors.New("invalid line range")
+	errLinesUnsatisfied = errors.New("line range not satisfiable")
+)
+
+// lineIndex keeps byte offsets of every lineIndexInterval-th line of a document
+type lineIndex struct {
+	// Lines is the number of lines, the final newline doesn't start another line
+	Lines int `json:"lines"`
+
+	// Size is the length of the document in bytes
+	Size int64 `json:"size"`
+
+	// Offsets are offsets of lines 0, lineIndexInterval, 2*lineIndexInterval and so on
+	Offsets []int64 `json:"offsets"`
+}
+
+// Builds the line index of the document
+func newLineIndex(content string) lineIndex {
+	index := lineIndex{Size: int64(len(content))}
+	for offset := 0; offset < len(content); index.Lines++ {
+		if index.Lines%lineIndexInterval == 0 {
+			index.Offsets = append(index.Offsets, int64(offset))
+		}
+
+		end := strings.IndexByte(content[offset:], '\n')
+		if end < 0 {
+			offset = len(content)
+		} else {
+			offset += end + 1
+		}
+	}
+
+	return index
+}
+
+// Returns offsets of the part of the document holding lines [start, end) and the line it starts with
+func (i lineIndex) span(start int, end int) (int64, int64, int) {
+	first := start / lineIndexInterval
+	last := i.Size
+	if next := (end + lineIndexInterval - 1) / lineIndexInterval; next < len(i.Offsets) {
+		last = i.Offsets[next]
+	}
+
+	return i.Offsets[first], last, first * lineIndexInterval
+}
+
+// lineRange is a range of lines requested by a reader
+type lineRange struct {
+	// First and Last are 1-based numbers of the first and the last line, 0 Last means the last line
+	First, Last int
+
+	// Tail is the number of lines at the end of the document, it takes precedence when set
+	Tail int
+}
+
+// Returns lines [start, end) of a document with total lines, false when the range starts past its end
+func (lr lineRange) resolve(total int) (int, int, bool) {
+	if lr.Tail > 0 {
+		return max(total-lr.Tail, 0), total, true
+	}
+
+	if lr.First > total {
+		return 0, 0, false
+	}
+
+	end := total
+	if lr.Last > 0 {
+		end = min(lr.Last, total)
+	}
+
+	return lr.First - 1, end, true
+}
+
+// Returns lines requested through query parameters lines, head and tail, or a Range header in line
+// units. The bool reports whether a range was requested through the Range header.
+func requestedLines(r *http.Request) (*lineRange, bool, error) {
+	query := r.URL.Query()
+
+	switch {
+	case query.Has("lines"):
+		lr, err := parseLineRange(query.Get("lines"), false)
+		return lr, false, err
+	case query.Has("head"):
+		count, err := strconv.Atoi(query.Get("head"))
+		if err != nil || count <= 0 {
+			return nil, false, errInvalidLines
+		}
+
+		return &lineRange{First: 1, Last: count}, false, nil
+	case query.Has("tail"):
+		count, err := strconv.Atoi(query.Get("tail"))
+		if err != nil || count <= 0 {
+			return nil, false, errInvalidLines
+		}
+
+		return &lineRange{Tail: count}, false, nil
+	}
+
+	// Ranges of other units and multiple ranges are ignored, the whole document is served
+	spec, ok := strings.CutPrefix(r.Header.Get("Range"), rangeUnit+"=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil, false, nil
+	}
+
+	lr, err := parseLineRange(strings.TrimSpace(spec), true)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	return lr, true, nil
+}
+
+// Parses a range of lines as first-last, first- or, in Range headers, -count of the last lines
+func parseLineRange(spec string, suffix bool) (*lineRange, error) {
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		// A single line
+		last = first
+	}
+
+	if first == "" {
+		count, err := strconv.Atoi(last)
+		if !suffix || err != nil || count <= 0 {
+			return nil, errInvalidLines
+		}
+
+		return &lineRange{Tail: count}, nil
+	}
+
+	lr := &lineRange{}
+	var err error
+	if lr.First, err = strconv.Atoi(first); err != nil || lr.First <= 0 {
+		return nil, errInvalidLines
+	}
+
+	if last != "" {
+		if lr.Last, err = strconv.Atoi(last); err != nil || lr.Last < lr.First {
+			return nil, errInvalidLines
+		}
+	}
+
+	return lr, nil
+}
+
+// Returns lines [start, end) of the text starting at line number offset
+func sliceLines(text string, offset int, start int, end int) string {
+	from := 0
+	for line := offset; line < start && from < len(text); line++ {
+		next := strings.IndexByte(text[from:], '\n')
+		if next < 0 {
+			return ""
+		}
+		from += next + 1
+	}
+
+	to := from
+	for line := start; line < end && to < len(text); line++ {
+		next := strings.IndexByte(text[to:], '\n')
+		if next < 0 {
+			return text[from:]
+		}
+		to += next + 1
+	}
+
+	return text[from:to]
+}
+
+// Counts lines of the text, the final newline doesn't start another line
+func countLines(text string) int {
+	lines := strings.Count(text, "\n")
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		lines++
+	}
+
+	return lines
+}
+
+// lineSelection is a range of lines read from a document
+type lineSelection struct {
+	Data string
+
+	// Start and End are 0-based numbers of the lines [Start, End) of the document with Total lines
+	Start, End, Total int
+}
+
+// Returns the requested lines of the document, checking the password like load
+// Lines of indexed documents are read without loading the whole document from storages
+// implementing RangeReader. Ranged reads don't extend expiration of the document.
+func (h *DocumentHandler) loadLines(key string, revision int, password string, consume bool, lines lineRange) (lineSelection, error) {
+	meta, err := h.loadMetadata(key)
+	if err != nil {
+		return lineSelection{}, err
+	}
+
+	if err := h.checkPassword(key, meta, password); err != nil {
+		return lineSelection{}, err
+	}
+
+	// Indexes describe the content under the key, which is the latest revision, reads limited by views
+	// have to take a view
+	if !(consume && meta.MaxViews > 0) && (revision == 0 || revision == meta.Latest()) {
+		selection, err := h.readIndexedLines(key, lines)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return selection, err
+		}
+	}
+
+	data, err := h.read(key, revision, meta, consume)
+	if err != nil {
+		return lineSelection{}, err
+	}
+
+	total := countLines(data)
+	start, end, ok := lines.resolve(total)
+	if !ok {
+		return lineSelection{Total: total}, errLinesUnsatisfied
+	}
+
+	return lineSelection{Data: sliceLines(data, 0, start, end), Start: start, End: end, Total: total}, nil
+}
+
+// Reads lines through the line index, errors.ErrUnsupported means the document has to be read whole
+func (h *DocumentHandler) readIndexedLines(key string, lines lineRange) (lineSelection, error) {
+	if _, ok := h.Store.(storage.RangeReader); !ok {
+		return lineSelection{}, errors.ErrUnsupported
+	}
+
+	data, err := h.Store.Get(key+lineIndexSuffix, true)
+	if errors.Is(err, storage.ErrNotFound) {
+		return lineSelection{}, errors.ErrUnsupported
+	} else if err != nil {
+		return lineSelection{}, err
+	}
+
+	var index lineIndex
+	if err := json.Unmarshal([]byte(data), &index); err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Ignoring malformed line index")
+		return lineSelection{}, errors.ErrUnsupported
+	}
+
+	start, end, ok := lines.resolve(index.Lines)
+	if !ok {
+		return lineSelection{Total: index.Lines}, errLinesUnsatisfied
+	}
+
+	selection := lineSelection{Start: start, End: end, Total: index.Lines}
+	if start == end {
+		return selection, nil
+	}
+
+	from, to, offset := index.span(start, end)
+	data, err = h.Store.(storage.RangeReader).GetRange(key, from, to-from)
+	if err != nil {
+		return lineSelection{}, err
+	}
+
+	selection.Data = sliceLines(data, offset, start, end)
+	return selection, nil
+}
+
+// Stores the line index of the document replacing the previous one, shorter documents have none
+// Storages which can't delete get the index of short documents too, so no stale one is left.
+func (h *DocumentHandler) storeLineIndex(key string, content string, expiration *time.Duration) error {
+	if deleter, ok := h.Store.(storage.Deleter); ok && len(content) < minIndexedLength {
+		return deleter.Delete(key + lineIndexSuffix)
+	}
+
+	data, err := json.Marshal(newLineIndex(content))
+	if err != nil {
+		return err
+	}
+
+	return h.set(key+lineIndexSuffix, string(data), expiration, 0)
+}
+
+// Serves the requested lines of a raw document, ranges requested through the Range header get partial content
+func (h *DocumentHandler) serveRawLines(w http.ResponseWriter, r *http.Request, id string, key string, revision int, mode string, lines lineRange, ranged bool) {
+	selection, err := h.loadLines(key, revision, requestPassword(r), takesView(r), lines)
+	if h.passwordError(w, r, id, err, true) {
+		log.Info().Err(err).Str("key", key).Msg("Raw document is protected by password")
+		return
+	}
+
+	if errors.Is(err, errLinesUnsatisfied) {
+		w.Header().Set("Content-Range", contentRange(selection, err))
+		http.Error(w, `{"message": "Line range not satisfiable."}`, http.StatusRequestedRangeNotSatisfiable)
+		return
+	} else if err != nil {
+		log.Info().Err(err).Str("key", key).Msg("Raw document not found")
+		http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
+		return
+	}
+
+	log.Info().Str("key", key).Int("start", selection.Start).Int("end", selection.End).Msg("Retrieved lines of raw document")
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.Header().Set("Vary", "Accept, User-Agent")
+
+	status := http.StatusOK
+	if ranged {
+		w.Header().Set("Content-Range", contentRange(selection, nil))
+		status = http.StatusPartialContent
+	}
+
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	pasteRead.Inc()
+	w.Write([]byte(applyANSIMode(mode, selection.Data)))
+}
+
+// Returns the Content-Range header of the selection, unsatisfiable ranges get the total only
+func contentRange(selection lineSelection, err error) string {
+	if errors.Is(err, errLinesUnsatisfied) {
+		return fmt.Sprintf("%s */%d", rangeUnit, selection.Total)
+	}
+
+	return fmt.Sprintf("%s %d-%d/%d", rangeUnit, selection.Start+1, selection.End, selection.Total)
+}
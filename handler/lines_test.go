@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+type rangeMockStorage struct {
+	*mockStorage
+	reads []string
+}
+
+func (m *rangeMockStorage) Get(key string, skipExpiration bool) (string, error) {
+	m.reads = append(m.reads, key)
+	return m.mockStorage.Get(key, skipExpiration)
+}
+
+func (m *rangeMockStorage) GetRange(key string, offset int64, length int64) (string, error) {
+	m.reads = append(m.reads, fmt.Sprintf("%s[%d:%d]", key, offset, offset+length))
+
+	value, err := m.mockStorage.Get(key, false)
+	if err != nil {
+		return "", err
+	}
+
+	value = value[min(offset, int64(len(value))):]
+	if length >= 0 {
+		value = value[:min(length, int64(len(value)))]
+	}
+
+	return value, nil
+}
+
+// Returns a document of numbered lines long enough to be indexed
+func numberedLines(count int) string {
+	var sb strings.Builder
+	for i := 1; i <= count; i++ {
+		fmt.Fprintf(&sb, "[%8d] line of a long kernel log\n", i)
+	}
+
+	return sb.String()
+}
+
+func TestNewLineIndex(t *testing.T) {
+	content := numberedLines(600)
+	index := newLineIndex(content)
+	require.Equal(t, 600, index.Lines)
+	require.Equal(t, int64(len(content)), index.Size)
+	require.Len(t, index.Offsets, 3)
+	require.Equal(t, int64(0), index.Offsets[0])
+	require.Equal(t, int64(strings.Index(content, "[     257]")), index.Offsets[1])
+
+	require.Equal(t, 2, newLineIndex("first\nsecond").Lines)
+	require.Equal(t, 2, countLines("first\nsecond"))
+	require.Equal(t, 2, countLines("first\nsecond\n"))
+	require.Equal(t, 0, countLines(""))
+}
+
+func TestParseLineRange(t *testing.T) {
+	tests := []struct {
+		spec     string
+		suffix   bool
+		expected lineRange
+		err      bool
+	}{
+		{spec: "120-240", expected: lineRange{First: 120, Last: 240}},
+		{spec: "120-", expected: lineRange{First: 120}},
+		{spec: "7", expected: lineRange{First: 7, Last: 7}},
+		{spec: "-20", suffix: true, expected: lineRange{Tail: 20}},
+		{spec: "-20", err: true},
+		{spec: "0-10", err: true},
+		{spec: "20-10", err: true},
+		{spec: "a-b", err: true},
+		{spec: "", err: true},
+	}
+
+	for _, tt := range tests {
+		lr, err := parseLineRange(tt.spec, tt.suffix)
+		if tt.err {
+			require.ErrorIs(t, err, errInvalidLines, tt.spec)
+			continue
+		}
+
+		require.NoError(t, err, tt.spec)
+		require.Equal(t, tt.expected, *lr, tt.spec)
+	}
+}
+
+func TestHandleRawGet_Lines(t *testing.T) {
+	store := &rangeMockStorage{mockStorage: &mockStorage{data: make(map[string]string)}}
+	handler := NewDocumentHandler(6, 1<<20, store, &mockKeyGenerator{fixedKey: "test123"})
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	content := numberedLines(4000)
+	resp := sendRequest(router, http.MethodPost, "/documents", strings.NewReader(content))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Contains(t, store.data, "test123"+lineIndexSuffix)
+
+	lines := strings.SplitAfter(content, "\n")
+	for _, tc := range []struct {
+		query    string
+		expected string
+	}{
+		{query: "lines=120-240", expected: strings.Join(lines[119:240], "")},
+		{query: "lines=3999-", expected: strings.Join(lines[3998:4000], "")},
+		{query: "lines=300-9000", expected: strings.Join(lines[299:4000], "")},
+		{query: "head=100", expected: strings.Join(lines[:100], "")},
+		{query: "tail=200", expected: strings.Join(lines[3800:4000], "")},
+	} {
+		store.reads = nil
+		resp := sendRequest(router, http.MethodGet, "/raw/test123?"+tc.query, nil)
+		require.Equal(t, http.StatusOK, resp.Code, tc.query)
+		require.Equal(t, tc.expected, resp.Body.String(), tc.query)
+		require.Equal(t, rangeUnit, resp.Header().Get("Accept-Ranges"))
+		require.Equal(t, "Accept, User-Agent", resp.Header().Get("Vary"), tc.query)
+
+		// The whole document is never loaded
+		require.NotContains(t, store.reads, "test123", tc.query)
+	}
+
+	for _, query := range []string{"lines=abc", "lines=10-5", "head=0", "tail=-1"} {
+		resp := sendRequest(router, http.MethodGet, "/raw/test123?"+query, nil)
+		require.Equal(t, http.StatusBadRequest, resp.Code, query)
+	}
+
+	resp = sendRequest(router, http.MethodGet, "/raw/test123?lines=4001-", nil)
+	require.Equal(t, http.StatusRequestedRangeNotSatisfiable, resp.Code)
+	require.Equal(t, "lines */4000", resp.Header().Get("Content-Range"))
+
+	resp = sendRequest(router, http.MethodGet, "/raw/unknown?head=10", nil)
+	require.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestHandleRawGet_RangeHeader(t *testing.T) {
+	handler := NewDocumentHandler(6, 1<<20, &mockStorage{data: make(map[string]string)}, &mockKeyGenerator{fixedKey: "test123"})
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	// Short documents are not indexed and storage can't read ranges, so lines are sliced from the whole document
+	handler.Store.Set("test123", "first\nsecond\nthird\nfourth", false)
+
+	rangeRequest := func(value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/raw/test123", nil)
+		req.Header.Set("Range", value)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := rangeRequest("lines=2-3")
+	require.Equal(t, http.StatusPartialContent, resp.Code)
+	require.Equal(t, "lines 2-3/4", resp.Header().Get("Content-Range"))
+	require.Equal(t, "second\nthird\n", resp.Body.String())
+
+	resp = rangeRequest("lines=-1")
+	require.Equal(t, http.StatusPartialContent, resp.Code)
+	require.Equal(t, "lines 4-4/4", resp.Header().Get("Content-Range"))
+	require.Equal(t, "fourth", resp.Body.String())
+
+	resp = rangeRequest("lines=5-")
+	require.Equal(t, http.StatusRequestedRangeNotSatisfiable, resp.Code)
+	require.Equal(t, "lines */4", resp.Header().Get("Content-Range"))
+
+	// Other units and multiple ranges serve the whole document
+	for _, value := range []string{"bytes=0-3", "lines=1-1,3-3", "lines=x"} {
+		resp = rangeRequest(value)
+		require.Equal(t, http.StatusOK, resp.Code, value)
+		require.Equal(t, "first\nsecond\nthird\nfourth", resp.Body.String(), value)
+	}
+}
+
+func TestHandleRawGet_LinesRevised(t *testing.T) {
+	store := &rangeMockStorage{mockStorage: &mockStorage{data: make(map[string]string)}}
+	handler := NewDocumentHandler(6, 1<<20, store, &mockKeyGenerator{fixedKey: "test123"})
+
+	content := numberedLines(2000)
+	meta := Metadata{}
+	require.NoError(t, handler.store("test123", content, nil, &meta))
+	require.Contains(t, store.data, "test123"+lineIndexSuffix)
+
+	// Revising the document to a short one removes the index of the long one
+	_, err := handler.revise("test123", meta, "short\nrevision\n")
+	require.NoError(t, err)
+	require.NotContains(t, store.data, "test123"+lineIndexSuffix)
+
+	selection, err := handler.loadLines("test123", 0, "", true, lineRange{Tail: 1})
+	require.NoError(t, err)
+	require.Equal(t, "revision\n", selection.Data)
+
+	// Earlier revisions are read whole
+	selection, err = handler.loadLines("test123", 1, "", true, lineRange{First: 2, Last: 2})
+	require.NoError(t, err)
+	require.Equal(t, strings.SplitAfter(content, "\n")[1], selection.Data)
+}
@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// metadataSuffix is appended to the key of a document to form the key of its metadata
+// Keys of documents never contain a dot, so metadata can't be requested as a document.
+// It differs from ".meta" sidecars some storages keep next to documents.
+const metadataSuffix = ".metadata"
+
+// Visibility values of documents
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+)
+
+// Metadata describes a document created through the API
+// Documents created through the compatibility routes have no metadata.
+type Metadata struct {
+	Title            string `json:"title,omitempty"`
+	Language         string `json:"language,omitempty"`
+	Visibility       string `json:"visibility,omitempty"`
+	BurnAfterReading bool   `json:"burn_after_reading,omitempty"`
+
+	// MaxViews is the number of reads the document was stored with, 0 means unlimited
+	// Reads of limited documents take a view from the storage, HEAD requests don't.
+	MaxViews int `json:"max_views,omitempty"`
+
+	// PasswordHash is the argon2id hash of the password required to read the document
+	PasswordHash string `json:"password_hash,omitempty"`
+
+	// TokenHash is the SHA-256 hash of the management token
+	TokenHash string `json:"token_hash,omitempty"`
+
+	// ExpiresIn is the lifetime the document was stored with in seconds, revisions are stored with it too
+	// Nil means the storage-wide expiration and 0 means no expiration.
+	ExpiresIn *int64 `json:"expires_in,omitempty"`
+
+	// Revisions are revisions published by the owner, documents never revised have none
+	Revisions []Revision `json:"revisions,omitempty"`
+
+	// Live is set while the document is being streamed, it grows until it is sealed
+	Live bool `json:"live,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Returns the lifetime the document was stored with, as taken by set
+func (m Metadata) expiration() *time.Duration {
+	if m.ExpiresIn == nil {
+		return nil
+	}
+
+	expiration := time.Duration(*m.ExpiresIn) * time.Second
+	return &expiration
+}
+
+// Authorize reports whether token is the management token of the document
+func (m Metadata) Authorize(token string) bool {
+	if m.TokenHash == "" || token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(m.TokenHash)) == 1
+}
+
+// Generates a new management token
+func newToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns metadata of the document, documents without metadata get the zero value
+func (h *DocumentHandler) loadMetadata(key string) (Metadata, error) {
+	var meta Metadata
+
+	data, err := h.Store.Get(key+metadataSuffix, false)
+	if errors.Is(err, storage.ErrNotFound) {
+		return meta, nil
+	} else if err != nil {
+		return meta, err
+	}
+
+	err = json.Unmarshal([]byte(data), &meta)
+	return meta, err
+}
+
+// Returns metadata requested by uploaders of compatibility routes through query parameters
+// and headers, documents uploaded without any option have no metadata
+func requestedMetadata(r *http.Request) (*Metadata, error) {
+	views, err := requestedViews(r)
+	if err != nil {
+		return nil, err
+	}
+
+	password := r.Header.Get("X-Password")
+	if views == 0 && password == "" {
+		return nil, nil
+	}
+
+	meta := &Metadata{MaxViews: views, CreatedAt: time.Now().UTC()}
+	if password != "" {
+		if meta.PasswordHash, err = hashPassword(password); err != nil {
+			return nil, err
+		}
+	}
+
+	return meta, nil
+}
+
+// Stores a document together with its metadata, the metadata is written first
+// so the document is never visible without it
+func (h *DocumentHandler) store(key string, content string, expiration *time.Duration, meta *Metadata) error {
+	if _, ok := h.Store.(storage.EntrySetter); !ok && expiration != nil && *expiration > 0 {
+		return errExpirationUnsupported
+	}
+
+	if meta == nil {
+		if err := h.clearMetadata(key, expiration); err != nil {
+			return err
+		}
+
+		if err := h.set(key, content, expiration, 0); err != nil {
+			return err
+		}
+
+		h.indexLines(key, content, expiration)
+		return nil
+	}
+
+	if _, ok := h.Store.(storage.ViewConsumer); !ok && meta.MaxViews > 0 {
+		return errViewsUnsupported
+	}
+
+	if expiration != nil {
+		expiresIn := int64(*expiration / time.Second)
+		meta.ExpiresIn = &expiresIn
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	if err := h.set(key+metadataSuffix, string(data), expiration, 0); err != nil {
+		return err
+	}
+
+	if err := h.set(key, content, expiration, meta.MaxViews); err != nil {
+		h.delete(key)
+		return err
+	}
+
+	// Documents limited by views are always read whole, as every read takes a view
+	if meta.MaxViews == 0 {
+		h.indexLines(key, content, expiration)
+	}
+
+	return nil
+}
+
+// Removes metadata and line index an expired document stored under the key may have left
+// behind, its password, views or lines would apply to the document stored in its place
+func (h *DocumentHandler) clearMetadata(key string, expiration *time.Duration) error {
+	if deleter, ok := h.Store.(storage.Deleter); ok {
+		var errs []error
+		for _, name := range []string{key + metadataSuffix, key + lineIndexSuffix} {
+			if err := deleter.Delete(name); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				errs = append(errs, err)
+			}
+		}
+
+		return errors.Join(errs...)
+	}
+
+	// Storages which can't delete get empty metadata, line indexes are only read through
+	// storages which can read ranges, which delete too
+	_, err := h.Store.Get(key+metadataSuffix, true)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return h.set(key+metadataSuffix, "{}", expiration, 0)
+}
+
+// Stores the line index of a new document, documents are served without one when it fails
+func (h *DocumentHandler) indexLines(key string, content string, expiration *time.Duration) {
+	if len(content) < minIndexedLength {
+		return
+	}
+
+	if err := h.storeLineIndex(key, content, expiration); err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Failed to store line index")
+	}
+}
+
+// Stores a value with its own expiration, which is also the TTL it is extended to on read
+// Nil expiration means the storage-wide one and 0 means no expiration. Values limited
+// by views need an explicit expiration, as they are always stored as entries.
+func (h *DocumentHandler) set(key string, value string, expiration *time.Duration, views int) error {
+	if views == 0 {
+		switch {
+		case expiration == nil:
+			return h.Store.Set(key, value, false)
+		case *expiration == 0:
+			return h.Store.Set(key, value, true)
+		}
+	}
+
+	setter, ok := h.Store.(storage.EntrySetter)
+	if !ok {
+		return errExpirationUnsupported
+	}
+
+	entry := storage.Entry{Key: key, Value: value, Views: views}
+	if *expiration > 0 {
+		entry.Expiration = time.Now().Add(*expiration)
+		entry.TTL = *expiration
+	}
+
+	err := setter.SetEntry(entry)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return errors.Join(errViewsUnsupported, err)
+	}
+
+	return err
+}
+
+// Removes a document together with its metadata
+func (h *DocumentHandler) delete(key string) error {
+	deleter, ok := h.Store.(storage.Deleter)
+	if !ok {
+		return errDeleteUnsupported
+	}
+
+	return errors.Join(deleter.Delete(key), deleter.Delete(key+metadataSuffix), deleter.Delete(key+lineIndexSuffix))
+}
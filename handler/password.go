@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/httprate"
+	"golang.org/x/crypto/argon2"
+)
+
+var (
+	errPasswordRequired = errors.New("password required")
+	errWrongPassword    = errors.New("wrong password")
+	errTooManyAttempts  = errors.New("too many failed password attempts")
+)
+
+// Parameters of argon2id hashes of new passwords, verification uses ones stored in the hash
+const (
+	argon2Time    = 1
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+// maxConcurrentHashes is the number of passwords hashed at once, each hash takes argon2Memory KiB
+const maxConcurrentHashes = 4
+
+// hashing holds a slot of every password being hashed, so parallel uploads and password checks
+// wait for one instead of exhausting memory
+var hashing = make(chan struct{}, maxConcurrentHashes)
+
+// unlockForm is served to browsers requesting a raw document protected by password
+var unlockForm = template.Must(template.New("unlock").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Key}} - password required</title></head>
+<body>
+<form method="post" action="/raw/{{.Key}}">
+<p>{{if .Wrong}}Wrong password, try again.{{else}}This document is protected by password.{{end}}</p>
+<input type="password" name="password" autofocus>
+<button type="submit">Unlock</button>
+</form>
+</body>
+</html>
+`))
+
+// Hashes the password into PHC string format of argon2id
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	hash := argon2ID(password, salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// Reports whether password matches the hash created by hashPassword
+func checkPassword(encoded string, password string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" || parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return false
+	}
+
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(hash) == 0 {
+		return false
+	}
+
+	other := argon2ID(password, salt, iterations, memory, threads, uint32(len(hash)))
+	return subtle.ConstantTimeCompare(hash, other) == 1
+}
+
+// Derives argon2id key of the password once a hashing slot is free
+func argon2ID(password string, salt []byte, iterations, memory uint32, threads uint8, keyLen uint32) []byte {
+	hashing <- struct{}{}
+	defer func() { <-hashing }()
+
+	return argon2.IDKey([]byte(password), salt, iterations, memory, threads, keyLen)
+}
+
+// Returns password supplied through X-Password header, "password" query parameter or the unlock form
+func requestPassword(r *http.Request) string {
+	if password := r.Header.Get("X-Password"); password != "" {
+		return password
+	}
+
+	if password := r.URL.Query().Get("password"); password != "" {
+		return password
+	}
+
+	if r.Method == http.MethodPost {
+		return r.PostFormValue("password")
+	}
+
+	return ""
+}
+
+// AttemptLimiter limits failed password attempts per document
+type AttemptLimiter struct {
+	limit   int
+	window  time.Duration
+	counter httprate.LimitCounter
+}
+
+// NewAttemptLimiter allows limit failed attempts per document within a sliding window
+func NewAttemptLimiter(limit int, window time.Duration) *AttemptLimiter {
+	return &AttemptLimiter{limit: limit, window: window, counter: httprate.NewLocalLimitCounter(window)}
+}
+
+// Allowed reports whether another attempt to guess password of the document is allowed
+func (l *AttemptLimiter) Allowed(key string) bool {
+	now := time.Now().UTC()
+	current := now.Truncate(l.window)
+
+	currCount, prevCount, err := l.counter.Get(key, current, current.Add(-l.window))
+	if err != nil {
+		return false
+	}
+
+	// Failures of the previous window count in proportion to its remaining overlap
+	rate := float64(prevCount)*float64(l.window-now.Sub(current))/float64(l.window) + float64(currCount)
+	return rate < float64(l.limit)
+}
+
+// Fail records a failed attempt to guess password of the document
+func (l *AttemptLimiter) Fail(key string) {
+	l.counter.IncrementBy(key, time.Now().UTC().Truncate(l.window), 1)
+}
+
+// Checks password supplied for the document, failed attempts are limited
+func (h *DocumentHandler) checkPassword(key string, meta Metadata, password string) error {
+	if meta.PasswordHash == "" {
+		return nil
+	}
+
+	if password == "" {
+		return errPasswordRequired
+	}
+
+	if !h.Attempts.Allowed(key) {
+		return errTooManyAttempts
+	}
+
+	if !checkPassword(meta.PasswordHash, password) {
+		h.Attempts.Fail(key)
+		return errWrongPassword
+	}
+
+	return nil
+}
+
+// Writes response for a password error and reports whether err was one
+// Browsers requesting raw documents get the unlock form.
+func (h *DocumentHandler) passwordError(w http.ResponseWriter, r *http.Request, key string, err error, form bool) bool {
+	switch {
+	case errors.Is(err, errTooManyAttempts):
+		w.Header().Set("Retry-After", strconv.Itoa(int(h.Attempts.window/time.Second)))
+		http.Error(w, `{"message": "Too many failed password attempts."}`, http.StatusTooManyRequests)
+	case errors.Is(err, errPasswordRequired), errors.Is(err, errWrongPassword):
+		if form && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+			w.WriteHeader(http.StatusUnauthorized)
+			unlockForm.Execute(w, map[string]any{"Key": key, "Wrong": errors.Is(err, errWrongPassword)})
+			return true
+		}
+
+		if errors.Is(err, errWrongPassword) {
+			http.Error(w, `{"message": "Wrong password."}`, http.StatusUnauthorized)
+		} else {
+			http.Error(w, `{"message": "Password required."}`, http.StatusUnauthorized)
+		}
+	default:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := hashPassword("hunter2")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hash, "$argon2id$"))
+	require.NotContains(t, hash, "hunter2")
+
+	require.True(t, checkPassword(hash, "hunter2"))
+	require.False(t, checkPassword(hash, "hunter3"))
+	require.False(t, checkPassword(hash, ""))
+
+	// Salts differ, so hashes of the same password do too
+	other, err := hashPassword("hunter2")
+	require.NoError(t, err)
+	require.NotEqual(t, hash, other)
+
+	for _, encoded := range []string{"", "hunter2", "$argon2i$v=19$m=65536,t=1,p=4$c2FsdA$aGFzaA", "$argon2id$v=19$m=x$c2FsdA$aGFzaA"} {
+		require.False(t, checkPassword(encoded, "hunter2"), encoded)
+	}
+}
+
+func TestHashPassword_Concurrency(t *testing.T) {
+	// Hashes wait for a slot while all of them are taken
+	for range maxConcurrentHashes {
+		hashing <- struct{}{}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hashPassword("hunter2")
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("password hashed without a free slot")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	for range maxConcurrentHashes {
+		<-hashing
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("password not hashed once slots were freed")
+	}
+}
+
+func TestAttemptLimiter(t *testing.T) {
+	limiter := NewAttemptLimiter(2, time.Minute)
+
+	require.True(t, limiter.Allowed("test123"))
+	limiter.Fail("test123")
+	require.True(t, limiter.Allowed("test123"))
+	limiter.Fail("test123")
+	require.False(t, limiter.Allowed("test123"))
+
+	// Attempts are limited per document
+	require.True(t, limiter.Allowed("other"))
+}
+
+func TestHandleAPICreate_Password(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/api/v1/documents", bytes.NewBufferString(`{"content": "psk=secret", "password": "hunter2"}`))
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	meta, err := handler.loadMetadata("test123")
+	require.NoError(t, err)
+	require.NotContains(t, meta.PasswordHash, "hunter2")
+
+	for _, path := range []string{"/raw/test123", "/documents/test123", "/raw/test123?password=wrong"} {
+		resp = sendRequest(router, http.MethodGet, path, nil)
+		require.Equal(t, http.StatusUnauthorized, resp.Code, path)
+		require.NotContains(t, resp.Body.String(), "psk=secret", path)
+	}
+
+	resp = sendRequest(router, http.MethodHead, "/raw/test123", nil)
+	require.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = sendRequest(router, http.MethodGet, "/raw/test123?password=hunter2", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "psk=secret", resp.Body.String())
+
+	req := httptest.NewRequest(http.MethodGet, "/documents/test123", nil)
+	req.Header.Set("X-Password", "hunter2")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "psk=secret")
+}
+
+func TestHandleRawGet_UnlockForm(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/api/v1/documents", bytes.NewBufferString(`{"content": "psk=secret", "password": "hunter2"}`))
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	// Browsers get the unlock form
+	req := httptest.NewRequest(http.MethodGet, "/raw/test123", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	require.Contains(t, rec.Body.String(), `action="/raw/test123"`)
+
+	form := url.Values{"password": {"hunter2"}}
+	req = httptest.NewRequest(http.MethodPost, "/raw/test123", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "psk=secret", rec.Body.String())
+}
+
+func TestHandleRawGet_PasswordAttempts(t *testing.T) {
+	handler := setupHandler()
+	handler.Attempts = NewAttemptLimiter(2, time.Minute)
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	req := httptest.NewRequest(http.MethodPost, "/documents", bytes.NewBufferString("psk=secret"))
+	req.Header.Set("X-Password", "hunter2")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	for range 2 {
+		resp := sendRequest(router, http.MethodGet, "/raw/test123?password=wrong", nil)
+		require.Equal(t, http.StatusUnauthorized, resp.Code)
+	}
+
+	// Even the right password is rejected once attempts are exhausted
+	resp := sendRequest(router, http.MethodGet, "/raw/test123?password=hunter2", nil)
+	require.Equal(t, http.StatusTooManyRequests, resp.Code)
+	require.Equal(t, "60", resp.Header().Get("Retry-After"))
+}
@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// revisionSeparator separates the key from the revision number in document URLs and in
+// keys revisions are stored under. Keys never contain it, neither generated nor chosen ones.
+const revisionSeparator = "@"
+
+// reviseGuardStripes is the number of guards keys of revised documents are spread over
+const reviseGuardStripes = 64
+
+var (
+	errInvalidRevision     = errors.New("invalid revision")
+	errRevisionUnsupported = errors.New("documents limited by views can't be revised")
+)
+
+// Revision describes a published revision of a document
+type Revision struct {
+	Number    int       `json:"number"`
+	Size      int       `json:"size"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+}
+
+// ReviseRequest is the body of POST /api/v1/documents/{id}/revisions
+type ReviseRequest struct {
+	Content string `json:"content"`
+}
+
+// RevisionResponse describes a revision in responses of the revision routes
+type RevisionResponse struct {
+	Revision  int       `json:"revision"`
+	Size      int       `json:"size,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	URL       string    `json:"url"`
+	RawURL    string    `json:"raw_url"`
+}
+
+// RevisionsResponse is the response of GET /documents/{id}/revisions
+type RevisionsResponse struct {
+	Key       string             `json:"key"`
+	Latest    int                `json:"latest"`
+	Revisions []RevisionResponse `json:"revisions"`
+}
+
+// Returns the key a revision of the document is stored under
+func revisionKey(key string, revision int) string {
+	return key + revisionSeparator + strconv.Itoa(revision)
+}
+
+// Splits ID of a document URL into the key and the requested revision, 0 means the latest
+// The extension after a dot is dropped.
+func parseKey(id string) (string, int, error) {
+	key, revision, ok := strings.Cut(strings.Split(id, ".")[0], revisionSeparator)
+	if !ok {
+		return key, 0, nil
+	}
+
+	number, err := strconv.Atoi(revision)
+	if err != nil || number <= 0 {
+		return key, 0, errInvalidRevision
+	}
+
+	return key, number, nil
+}
+
+// Returns the key of a document URL ID naming the document itself, false for IDs with a
+// revision or an extension
+func documentKey(id string) (string, bool) {
+	key, _, _ := parseKey(id)
+	return key, key == id && key != ""
+}
+
+// Latest returns number of the latest revision, documents never revised have the first one
+func (m Metadata) Latest() int {
+	return max(len(m.Revisions), 1)
+}
+
+// Locks revisions of the key and returns the function unlocking them
+func (h *DocumentHandler) guardRevisions(key string) func() {
+	sum := md5.Sum([]byte(key))
+	mu := &h.revising[binary.BigEndian.Uint16(sum[:])%reviseGuardStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Publishes content as a new revision of the document and returns its number
+// Every revision is kept under its own key with the lifetime of the document, the latest
+// one is also stored under the key of the document, so it is served by default.
+func (h *DocumentHandler) revise(key string, meta Metadata, content string) (int, error) {
+	if meta.MaxViews > 0 {
+		return 0, errRevisionUnsupported
+	}
+
+	if maxLength := h.policy(RouteDocuments).MaxLength; maxLength > 0 && len(content) > maxLength {
+		return 0, errTooLong
+	}
+
+	expiration := meta.expiration()
+
+	// The document as created becomes the first revision when it is revised for the first time
+	if len(meta.Revisions) == 0 {
+		data, err := h.Store.Get(key, true)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := h.set(revisionKey(key, 1), data, expiration, 0); err != nil {
+			return 0, err
+		}
+
+		meta.Revisions = append(meta.Revisions, Revision{Number: 1, Size: len(data), CreatedAt: meta.CreatedAt})
+	}
+
+	revision := Revision{Number: len(meta.Revisions) + 1, Size: len(content), CreatedAt: time.Now().UTC()}
+	if err := h.set(revisionKey(key, revision.Number), content, expiration, 0); err != nil {
+		return 0, err
+	}
+
+	meta.Revisions = append(meta.Revisions, revision)
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := h.set(key+metadataSuffix, string(data), expiration, 0); err != nil {
+		return 0, err
+	}
+
+	if err := h.set(key, content, expiration, 0); err != nil {
+		return 0, err
+	}
+
+	// The index of the previous revision would serve wrong lines, so failing to replace it fails the revision
+	if err := h.storeLineIndex(key, content, expiration); err != nil {
+		return 0, err
+	}
+
+	return revision.Number, nil
+}
+
+// Removes stored revisions of the document
+func (h *DocumentHandler) deleteRevisions(key string, meta Metadata) error {
+	deleter, ok := h.Store.(storage.Deleter)
+	if !ok {
+		return errDeleteUnsupported
+	}
+
+	var errs []error
+	for _, revision := range meta.Revisions {
+		errs = append(errs, deleter.Delete(revisionKey(key, revision.Number)))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Handle listing revisions of a document
+func (h *DocumentHandler) HandleRevisions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Revisions are listed for the document only, never for one of its revisions
+	key, ok := documentKey(chi.URLParam(r, "id"))
+	if !ok {
+		http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
+		return
+	}
+
+	// Loading the latest revision checks the document exists and the password
+	data, meta, err := h.load(key, 0, requestPassword(r), false)
+	if h.passwordError(w, r, key, err, false) {
+		log.Info().Err(err).Str("key", key).Msg("Revisions are protected by password")
+		return
+	}
+
+	if data == "" || err != nil {
+		log.Info().Str("key", key).Msg("Document not found")
+		http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
+		return
+	}
+
+	revisions := meta.Revisions
+	if len(revisions) == 0 {
+		revisions = []Revision{{Number: 1, Size: len(data), CreatedAt: meta.CreatedAt}}
+	}
+
+	resp := RevisionsResponse{Key: key, Latest: meta.Latest()}
+	for _, revision := range revisions {
+		resp.Revisions = append(resp.Revisions, revisionResponse(r, key, revision))
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Handle publishing a new revision of a document, the management token is passed as a bearer token
+func (h *DocumentHandler) HandleAPIRevise(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	key, ok := documentKey(chi.URLParam(r, "id"))
+	if !ok {
+		http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
+		return
+	}
+
+	h.limitJSONBody(w, r)
+
+	var req ReviseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, `{"message": "Document exceeds maximum length."}`, http.StatusBadRequest)
+			return
+		}
+
+		http.Error(w, `{"message": "Malformed request body."}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Content == "" {
+		http.Error(w, `{"message": "Content is required."}`, http.StatusBadRequest)
+		return
+	}
+
+	// Metadata is loaded under the guard, so the revision is numbered after the ones published before
+	defer h.guardRevisions(key)()
+
+	meta, err := h.loadMetadata(key)
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Msg("Failed to load document metadata")
+		http.Error(w, `{"message": "Error revising document."}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	if !meta.Authorize(bearerToken(r)) {
+		http.Error(w, `{"message": "Invalid management token."}`, http.StatusUnauthorized)
+		return
+	}
+
+	number, err := h.revise(key, meta, req.Content)
+	if errors.Is(err, errTooLong) {
+		http.Error(w, `{"message": "Document exceeds maximum length."}`, http.StatusBadRequest)
+		return
+	} else if errors.Is(err, errRevisionUnsupported) {
+		http.Error(w, `{"message": "Documents limited by views can't be revised."}`, http.StatusBadRequest)
+		return
+	} else if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Str("key", key).Msg("Failed to revise document")
+		http.Error(w, `{"message": "Error revising document."}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	log.Info().Str("key", key).Int("revision", number).Msg("Published document revision")
+
+	revision := Revision{Number: number, Size: len(req.Content), CreatedAt: time.Now().UTC()}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(revisionResponse(r, key, revision))
+}
+
+func revisionResponse(r *http.Request, key string, revision Revision) RevisionResponse {
+	id := revisionKey(key, revision.Number)
+
+	return RevisionResponse{
+		Revision:  revision.Number,
+		Size:      revision.Size,
+		CreatedAt: revision.CreatedAt,
+		URL:       fmt.Sprintf("https://%s/%s", r.Host, id),
+		RawURL:    fmt.Sprintf("https://%s/raw/%s", r.Host, id),
+	}
+}
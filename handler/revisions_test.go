@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func sendRevision(router http.Handler, key, token, content string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(ReviseRequest{Content: content})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/documents/"+key+"/revisions", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		id       string
+		key      string
+		revision int
+		err      bool
+	}{
+		{id: "abc", key: "abc"},
+		{id: "abc.sh", key: "abc"},
+		{id: "abc@2", key: "abc", revision: 2},
+		{id: "abc@2.sh", key: "abc", revision: 2},
+		{id: "abc@0", key: "abc", err: true},
+		{id: "abc@x", key: "abc", err: true},
+	}
+
+	for _, test := range tests {
+		key, revision, err := parseKey(test.id)
+		if test.err {
+			require.Error(t, err, test.id)
+			continue
+		}
+
+		require.NoError(t, err, test.id)
+		require.Equal(t, test.key, key, test.id)
+		require.Equal(t, test.revision, revision, test.id)
+	}
+}
+
+func TestHandleAPIRevise(t *testing.T) {
+	store := &entryMockStorage{mockStorage: &mockStorage{data: make(map[string]string)}, entries: map[string]storage.Entry{}}
+	handler := NewDocumentHandler(6, 1024, store, &mockKeyGenerator{fixedKey: "test123"})
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/api/v1/documents", bytes.NewBufferString(`{"content": "first", "expires_in": 3600}`))
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	var created CreateResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+
+	rec := sendRevision(router, "test123", "wrong", "second")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = sendRevision(router, "test123", created.Token, "second")
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var revision RevisionResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&revision))
+	require.Equal(t, 2, revision.Revision)
+	require.Equal(t, "https://example.com/raw/test123@2", revision.RawURL)
+
+	rec = sendRevision(router, "test123", created.Token, "third")
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	// Revisions keep the lifetime the document was created with
+	require.Equal(t, time.Hour, store.entries["test123@1"].TTL)
+	require.Equal(t, time.Hour, store.entries["test123@3"].TTL)
+
+	for path, expected := range map[string]string{
+		"/raw/test123":      "third",
+		"/raw/test123@1":    "first",
+		"/raw/test123@2.sh": "second",
+		"/raw/test123@3":    "third",
+	} {
+		resp := sendRequest(router, http.MethodGet, path, nil)
+		require.Equal(t, http.StatusOK, resp.Code, path)
+		require.Equal(t, expected, resp.Body.String(), path)
+	}
+
+	for _, path := range []string{"/raw/test123@4", "/raw/test123@0", "/documents/test123@x"} {
+		resp := sendRequest(router, http.MethodGet, path, nil)
+		require.Equal(t, http.StatusNotFound, resp.Code, path)
+	}
+
+	resp = sendRequest(router, http.MethodGet, "/documents/test123@2", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var document documentResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&document))
+	require.Equal(t, "second", document.Data)
+	require.Equal(t, 2, document.Revision)
+
+	resp = sendRequest(router, http.MethodGet, "/documents/test123/revisions", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var revisions RevisionsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&revisions))
+	require.Equal(t, 3, revisions.Latest)
+	require.Len(t, revisions.Revisions, 3)
+	require.Equal(t, 1, revisions.Revisions[0].Revision)
+	require.Equal(t, len("first"), revisions.Revisions[0].Size)
+	require.Equal(t, "https://example.com/test123@3", revisions.Revisions[2].URL)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/documents/test123", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Token)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Empty(t, store.data)
+}
+
+// slowMetadataStorage delays reads of metadata, so concurrent revisions read it at the same time
+type slowMetadataStorage struct {
+	storage.Storage
+}
+
+func (s slowMetadataStorage) Get(key string, skipExpiration bool) (string, error) {
+	value, err := s.Storage.Get(key, skipExpiration)
+	if strings.HasSuffix(key, metadataSuffix) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return value, err
+}
+
+func TestHandleAPIRevise_Concurrent(t *testing.T) {
+	store := slowMetadataStorage{storage.NewFileStorage(t.TempDir(), 0)}
+	handler := NewDocumentHandler(6, 1024, store, &mockKeyGenerator{fixedKey: "test123"})
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/api/v1/documents", bytes.NewBufferString(`{"content": "first"}`))
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	var created CreateResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+
+	// Every concurrent revision gets its own number and none of them is lost
+	const count = 8
+	numbers := make([]int, count)
+	var wg sync.WaitGroup
+	for i := range count {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			rec := sendRevision(router, "test123", created.Token, fmt.Sprintf("revision %d", i))
+			var revision RevisionResponse
+			if rec.Code == http.StatusCreated && json.NewDecoder(rec.Body).Decode(&revision) == nil {
+				numbers[i] = revision.Revision
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, number := range numbers {
+		require.NotZero(t, number, i)
+		resp := sendRequest(router, http.MethodGet, fmt.Sprintf("/raw/test123@%d", number), nil)
+		require.Equal(t, fmt.Sprintf("revision %d", i), resp.Body.String(), number)
+	}
+
+	resp = sendRequest(router, http.MethodGet, "/documents/test123/revisions", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var revisions RevisionsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&revisions))
+	require.Equal(t, count+1, revisions.Latest)
+	require.Len(t, revisions.Revisions, count+1)
+}
+
+func TestHandleRevisions_NotRevised(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodGet, "/documents/test123/revisions", nil)
+	require.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = sendRequest(router, http.MethodPost, "/documents", bytes.NewBufferString("test content"))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	resp = sendRequest(router, http.MethodGet, "/documents/test123/revisions", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var revisions RevisionsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&revisions))
+	require.Equal(t, 1, revisions.Latest)
+	require.Len(t, revisions.Revisions, 1)
+
+	resp = sendRequest(router, http.MethodGet, "/raw/test123@1", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "test content", resp.Body.String())
+
+	resp = sendRequest(router, http.MethodGet, "/raw/test123@2", nil)
+	require.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestHandleAPIRevise_Invalid(t *testing.T) {
+	handler := NewDocumentHandler(6, 10, newViewMockStorage(), &mockKeyGenerator{fixedKey: "test123"})
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/api/v1/documents", bytes.NewBufferString(`{"content": "test", "max_views": 2}`))
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	var created CreateResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+
+	require.Equal(t, http.StatusBadRequest, sendRevision(router, "test123", created.Token, "").Code)
+	require.Equal(t, http.StatusBadRequest, sendRevision(router, "test123", created.Token, "this content is too long").Code)
+	require.Equal(t, http.StatusBadRequest, sendRevision(router, "test123", created.Token, "second").Code)
+}
+
+func TestHandleRevisions_RevisionID(t *testing.T) {
+	store := &entryMockStorage{mockStorage: &mockStorage{data: make(map[string]string)}, entries: map[string]storage.Entry{}}
+	handler := NewDocumentHandler(6, 1024, store, &mockKeyGenerator{fixedKey: "test123"})
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/api/v1/documents", bytes.NewBufferString(`{"content": "psk=secret", "password": "hunter2"}`))
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	var created CreateResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	require.Equal(t, http.StatusCreated, sendRevision(router, "test123", created.Token, "psk=changed").Code)
+
+	// Revision IDs name no document of their own, so they can't get around its password
+	for _, path := range []string{"/documents/test123@1/revisions", "/documents/test123@2/revisions", "/documents/test123.txt/revisions"} {
+		resp = sendRequest(router, http.MethodGet, path+"?password=hunter2", nil)
+		require.Equal(t, http.StatusNotFound, resp.Code, path)
+		require.NotContains(t, resp.Body.String(), "test123@", path)
+	}
+
+	resp = sendRequest(router, http.MethodGet, "/documents/test123/revisions", nil)
+	require.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = sendRequest(router, http.MethodGet, "/documents/test123/revisions?password=hunter2", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var revisions RevisionsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&revisions))
+	require.Equal(t, "https://example.com/test123@1", revisions.Revisions[0].URL)
+
+	// Revisions are neither revised nor deleted on their own
+	require.Equal(t, http.StatusNotFound, sendRevision(router, "test123@1", created.Token, "psk=other").Code)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/documents/test123@1", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Contains(t, store.data, "test123@1")
+	require.Equal(t, "psk=changed", store.data["test123"])
+}
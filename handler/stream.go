@@ -0,0 +1,608 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/armbian/ansi-hastebin/internal/highlight"
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Default limits of live pastes
+const (
+	DefaultStreamIdleTimeout = 5 * time.Minute
+	DefaultStreamMaxDuration = 6 * time.Hour
+)
+
+// streamFlushInterval is how often data received by live pastes is written to storage
+const streamFlushInterval = time.Second
+
+// streamFlushSize is the amount of received data written to storage without waiting for the interval
+const streamFlushSize = 64 << 10
+
+// streamChunkSize is the size of reads of live uploads
+const streamChunkSize = 32 << 10
+
+// streamPollInterval is how often followers of pastes streamed through other instances check storage
+const streamPollInterval = time.Second
+
+// streamKeepAlive is how often idle followers get a comment, so proxies don't close their connections
+const streamKeepAlive = 30 * time.Second
+
+// followerBuffer is the number of chunks queued for a follower, slower followers are disconnected
+const followerBuffer = 64
+
+// stream is a live paste uploaded through this instance
+type stream struct {
+	mu        sync.Mutex
+	content   strings.Builder
+	followers map[chan string]struct{}
+	sealed    bool
+
+	// done is closed once the paste is sealed
+	done chan struct{}
+
+	// stop ends the upload, which seals the paste
+	stop context.CancelFunc
+}
+
+// Appends data to the paste and passes it to followers
+func (s *stream) write(data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.content.WriteString(data)
+	for follower := range s.followers {
+		select {
+		case follower <- data:
+		default:
+			// Followers reconnect from the last event they received
+			delete(s.followers, follower)
+			close(follower)
+		}
+	}
+}
+
+// Returns the content from offset and a channel of data appended later, it is closed once
+// the paste is sealed or the follower falls behind
+func (s *stream) follow(offset int) (string, chan string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	follower := make(chan string, followerBuffer)
+	if s.sealed {
+		close(follower)
+	} else {
+		s.followers[follower] = struct{}{}
+	}
+
+	content := s.content.String()
+	return content[min(offset, len(content)):], follower
+}
+
+func (s *stream) unfollow(follower chan string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.followers[follower]; ok {
+		delete(s.followers, follower)
+		close(follower)
+	}
+}
+
+func (s *stream) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.content.String()
+}
+
+func (s *stream) isSealed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sealed
+}
+
+// Ends following the paste, followers learn it was sealed
+func (s *stream) seal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sealed = true
+	for follower := range s.followers {
+		close(follower)
+	}
+	s.followers = nil
+	close(s.done)
+}
+
+// streams are live pastes uploaded through this instance by their keys
+type streams struct {
+	mu   sync.Mutex
+	live map[string]*stream
+}
+
+func (s *streams) open(key string, stop context.CancelFunc) *stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.live == nil {
+		s.live = make(map[string]*stream)
+	}
+
+	live := &stream{followers: make(map[chan string]struct{}), done: make(chan struct{}), stop: stop}
+	s.live[key] = live
+	return live
+}
+
+func (s *streams) get(key string) *stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.live[key]
+}
+
+func (s *streams) close(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.live, key)
+}
+
+// CloseStreams ends uploads of all live pastes and waits until they are sealed with data received so far
+func (h *DocumentHandler) CloseStreams() {
+	h.streams.mu.Lock()
+	live := make([]*stream, 0, len(h.streams.live))
+	for _, s := range h.streams.live {
+		s.stop()
+		live = append(live, s)
+	}
+	h.streams.mu.Unlock()
+
+	for _, s := range live {
+		<-s.done
+	}
+}
+
+// Handle live paste uploaded as a chunked body (PUT /stream)
+// The link is written as soon as the paste is created and data is appended as it arrives. The paste is
+// sealed once the upload ends, stays idle for StreamIdleTimeout or lasts StreamMaxDuration. Live pastes
+// use the policy of the log route.
+func (h *DocumentHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
+	expiration, err := h.requestedExpiration(r)
+	if err != nil {
+		expirationError(w, err)
+		return
+	}
+
+	meta, err := requestedMetadata(r)
+	if errors.Is(err, errInvalidViews) {
+		viewsError(w, err)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("Failed to prepare document metadata")
+		http.Error(w, `{"message": "Error adding document."}`, http.StatusInternalServerError)
+		return
+	}
+
+	// Every read of a live paste would take a view, so they can't be limited by them
+	if meta != nil && meta.MaxViews > 0 {
+		viewsError(w, errViewsUnsupported)
+		return
+	}
+
+	key, err := h.vanityKey(r, r.Header.Get("X-Key"))
+	if err != nil {
+		keyError(w, err)
+		return
+	}
+
+	body, err := decodeBody(r)
+	if err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	if meta == nil {
+		meta = &Metadata{CreatedAt: time.Now().UTC()}
+	}
+	meta.Live = true
+
+	key, err = h.create(RouteLog, key, "", "", expiration, meta)
+	if err != nil {
+		body.Close()
+		createError(w, err)
+		return
+	}
+
+	ctx, stop := context.WithCancel(r.Context())
+	defer stop()
+	live := h.streams.open(key, stop)
+
+	// The link is sent while the body is still being uploaded
+	controller := http.NewResponseController(w)
+	controller.EnableFullDuplex()
+
+	log.Info().Str("key", key).Msg("Added live document")
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "\nhttps://%s/%s\n\n", r.Host, key)
+	controller.Flush()
+
+	err = h.receive(ctx, controller, body, key, expiration, live)
+	if sealErr := h.seal(key, *meta, r.Header.Get("X-Filename"), expiration, live); sealErr != nil {
+		log.Error().Err(sealErr).Str("key", key).Msg("Failed to seal live document")
+		err = cmp.Or(err, sealErr)
+	}
+
+	switch {
+	case errors.Is(err, errTooLong):
+		fmt.Fprintf(w, "Document exceeds maximum length, it was sealed after %d bytes.\n", len(live.String()))
+	case errors.Is(err, errInvalidEncoding):
+		fmt.Fprintf(w, "Invalid encoded request body, the document was sealed after %d bytes.\n", len(live.String()))
+	case err != nil:
+		fmt.Fprintf(w, "Error adding document, it was sealed after %d bytes.\n", len(live.String()))
+	default:
+		fmt.Fprintf(w, "Sealed after %d bytes.\n", len(live.String()))
+	}
+}
+
+// Receives the body of a live paste until it ends, times out or the upload is stopped
+// Data is passed to followers as soon as it arrives and written to storage in batches.
+func (h *DocumentHandler) receive(ctx context.Context, controller *http.ResponseController, body io.ReadCloser, key string, expiration *time.Duration, live *stream) error {
+	chunks := make(chan string)
+	received := make(chan error, 1)
+	done := make(chan struct{})
+
+	// Reads block, so they run aside and the reader owns the body
+	go func() {
+		defer body.Close()
+
+		buffer := make([]byte, streamChunkSize)
+		carried := 0
+		for {
+			n, err := body.Read(buffer[carried:])
+			n += carried
+
+			// Characters split between reads are passed on whole, so followers decode them
+			carried = 0
+			if err == nil {
+				carried = incompleteRune(buffer[:n])
+			}
+
+			if n > carried {
+				select {
+				case chunks <- string(buffer[:n-carried]):
+				case <-done:
+					return
+				}
+			}
+
+			if err != nil {
+				received <- err
+				return
+			}
+
+			copy(buffer, buffer[n-carried:n])
+		}
+	}()
+
+	defer func() {
+		close(done)
+
+		// Unblocks the pending read, the server closes the body otherwise
+		controller.SetReadDeadline(time.Now())
+	}()
+
+	maxLength := h.policy(RouteLog).MaxLength
+	length := 0
+	var pending strings.Builder
+
+	flush := func() error {
+		if pending.Len() == 0 {
+			return nil
+		}
+
+		err := h.appendStream(key, pending.String(), expiration, live)
+		pending.Reset()
+		return err
+	}
+
+	idle := time.NewTimer(cmp.Or(h.StreamIdleTimeout, DefaultStreamIdleTimeout))
+	defer idle.Stop()
+
+	deadline := time.NewTimer(cmp.Or(h.StreamMaxDuration, DefaultStreamMaxDuration))
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(streamFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case chunk := <-chunks:
+			idle.Reset(cmp.Or(h.StreamIdleTimeout, DefaultStreamIdleTimeout))
+
+			var err error
+			if maxLength > 0 && length+len(chunk) > maxLength {
+				// Followers get whole characters only, the one crossing the limit is dropped
+				chunk = chunk[:maxLength-length]
+				chunk = chunk[:len(chunk)-incompleteRune([]byte(chunk))]
+				err = errTooLong
+			}
+
+			length += len(chunk)
+			live.write(chunk)
+			pending.WriteString(chunk)
+
+			if err != nil {
+				return errors.Join(err, flush())
+			}
+
+			if pending.Len() >= streamFlushSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		case err := <-received:
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+
+			return errors.Join(err, flush())
+		case <-idle.C:
+			log.Info().Str("key", key).Msg("Live document timed out")
+			return flush()
+		case <-deadline.C:
+			log.Info().Str("key", key).Msg("Live document reached maximum duration")
+			return flush()
+		case <-ctx.Done():
+			return flush()
+		}
+	}
+}
+
+// Writes data received by a live paste to storage, storages which can't append get all of it
+func (h *DocumentHandler) appendStream(key string, data string, expiration *time.Duration, live *stream) error {
+	if appender, ok := h.Store.(storage.Appender); ok {
+		err := appender.Append(key, data)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return err
+		}
+	}
+
+	return h.set(key, live.String(), expiration, 0)
+}
+
+// Stores metadata of the sealed paste with its detected language and line index, and ends following it
+func (h *DocumentHandler) seal(key string, meta Metadata, filename string, expiration *time.Duration, live *stream) error {
+	defer h.streams.close(key)
+	defer live.seal()
+
+	content := live.String()
+	meta.Live = false
+	if meta.Language == "" {
+		meta.Language = highlight.Detect(filename, content)
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	if err := h.set(key+metadataSuffix, string(data), expiration, 0); err != nil {
+		return err
+	}
+
+	h.indexLines(key, content, expiration)
+	log.Info().Str("key", key).Int("length", len(content)).Msg("Sealed live document")
+	return nil
+}
+
+// Handle following a document over Server-Sent Events (GET /documents/{id}/follow)
+// Data is sent in chunk events as JSON strings, with IDs of offsets after them, so readers
+// reconnecting with Last-Event-ID continue where they stopped. The end event follows once the
+// document is sealed, documents which are not live are sent whole and end right away.
+func (h *DocumentHandler) HandleFollow(w http.ResponseWriter, r *http.Request) {
+	// Revisions and extensions aren't followed, they would name other storage keys
+	key, ok := documentKey(chi.URLParam(r, "id"))
+	if !ok {
+		log.Info().Str("key", key).Msg("Document not found")
+		http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
+		return
+	}
+
+	data, meta, err := h.load(key, 0, requestPassword(r), true)
+	if h.passwordError(w, r, key, err, false) {
+		log.Info().Err(err).Str("key", key).Msg("Followed document is protected by password")
+		return
+	}
+
+	// Live documents are empty until their first data arrives
+	live := h.streams.get(key)
+	following := live != nil || h.streamedElsewhere(meta)
+	if err != nil || (data == "" && !following) {
+		log.Info().Err(err).Str("key", key).Msg("Document not found")
+		http.Error(w, `{"message": "Document not found."}`, http.StatusNotFound)
+		return
+	}
+
+	offset, err := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	events := newEventWriter(w)
+	switch {
+	case live != nil:
+		h.followLive(r.Context(), events, live, offset)
+	case following:
+		h.followStored(r.Context(), events, key, offset)
+	default:
+		events.chunk(data[min(offset, len(data)):], offset)
+		events.end()
+	}
+}
+
+// Reports whether the document is live without being uploaded through this instance
+// Documents of instances which stopped without sealing them are live until the maximum duration passes.
+func (h *DocumentHandler) streamedElsewhere(meta Metadata) bool {
+	return meta.Live && time.Since(meta.CreatedAt) < cmp.Or(h.StreamMaxDuration, DefaultStreamMaxDuration)+cmp.Or(h.StreamIdleTimeout, DefaultStreamIdleTimeout)
+}
+
+// Follows a paste uploaded through this instance
+func (h *DocumentHandler) followLive(ctx context.Context, events *eventWriter, live *stream, offset int) {
+	data, follower := live.follow(offset)
+	defer live.unfollow(follower)
+
+	offset = events.chunk(data, offset)
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case data, ok := <-follower:
+			if !ok {
+				// Followers which fell behind reconnect
+				if live.isSealed() {
+					events.end()
+				}
+
+				return
+			}
+
+			offset = events.chunk(data, offset)
+		case <-keepAlive.C:
+			events.keepAlive()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Follows a paste uploaded through another instance by polling storage
+func (h *DocumentHandler) followStored(ctx context.Context, events *eventWriter, key string, offset int) {
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Metadata is loaded ahead of data, so nothing written before sealing is missed
+		meta, err := h.loadMetadata(key)
+		if err != nil {
+			log.Error().Err(err).Str("key", key).Msg("Failed to load document metadata")
+			return
+		}
+
+		data, err := h.readFrom(key, offset)
+		if err != nil {
+			log.Error().Err(err).Str("key", key).Msg("Failed to read followed document")
+			return
+		}
+
+		live := h.streamedElsewhere(meta)
+		if live {
+			// Data may be read while it is being appended, the rest of a split character comes later
+			data = data[:len(data)-incompleteRune([]byte(data))]
+		}
+
+		offset = events.chunk(data, offset)
+		if !live {
+			events.end()
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Reads the document from offset, without loading all of it from storages which read ranges
+func (h *DocumentHandler) readFrom(key string, offset int) (string, error) {
+	if reader, ok := h.Store.(storage.RangeReader); ok {
+		data, err := reader.GetRange(key, int64(offset), -1)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return data, err
+		}
+	}
+
+	data, err := h.Store.Get(key, false)
+	return data[min(offset, len(data)):], err
+}
+
+// Returns the number of bytes of the UTF-8 character data ends in the middle of
+func incompleteRune(data []byte) int {
+	for size := 1; size < utf8.UTFMax && size <= len(data); size++ {
+		tail := data[len(data)-size:]
+		if !utf8.RuneStart(tail[0]) {
+			continue
+		}
+
+		if utf8.FullRune(tail) {
+			return 0
+		}
+
+		return size
+	}
+
+	return 0
+}
+
+// eventWriter writes Server-Sent Events to followers
+type eventWriter struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+}
+
+func newEventWriter(w http.ResponseWriter) *eventWriter {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Proxies buffering responses would hold events back
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	events := &eventWriter{w: w, controller: http.NewResponseController(w)}
+	events.controller.Flush()
+	return events
+}
+
+// Sends data read at offset and returns the offset after it, empty data isn't sent
+// Data is encoded as JSON string, as events can't carry carriage returns of terminal output.
+func (e *eventWriter) chunk(data string, offset int) int {
+	if data == "" {
+		return offset
+	}
+
+	encoded, _ := json.Marshal(data)
+	offset += len(data)
+	fmt.Fprintf(e.w, "id: %d\nevent: chunk\ndata: %s\n\n", offset, encoded)
+	e.controller.Flush()
+	return offset
+}
+
+func (e *eventWriter) end() {
+	fmt.Fprint(e.w, "event: end\ndata: {}\n\n")
+	e.controller.Flush()
+}
+
+func (e *eventWriter) keepAlive() {
+	fmt.Fprint(e.w, ": keep-alive\n\n")
+	e.controller.Flush()
+}
@@ -0,0 +1,355 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func setupStreamServer(t *testing.T) (*DocumentHandler, *httptest.Server) {
+	handler := NewDocumentHandler(6, 1024, storage.NewFileStorage(t.TempDir(), 0), &mockKeyGenerator{fixedKey: "live123"})
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return handler, server
+}
+
+type event struct {
+	id, name, data string
+}
+
+// Reads the next Server-Sent Event, skipping comments
+func readEvent(t *testing.T, reader *bufio.Reader) event {
+	var e event
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && e.name != "":
+			return e
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func follow(t *testing.T, server *httptest.Server, key string, lastEventID string) *bufio.Reader {
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/documents/"+key+"/follow", nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	return bufio.NewReader(resp.Body)
+}
+
+func requireChunk(t *testing.T, e event, data string, offset string) {
+	require.Equal(t, "chunk", e.name)
+	require.Equal(t, offset, e.id)
+
+	var decoded string
+	require.NoError(t, json.Unmarshal([]byte(e.data), &decoded))
+	require.Equal(t, data, decoded)
+}
+
+// Reads chunk events until length bytes are received, characters split between chunks would decode
+// to replacement characters
+func readChunks(t *testing.T, reader *bufio.Reader, length int) string {
+	var data string
+	for len(data) < length {
+		e := readEvent(t, reader)
+		require.Equal(t, "chunk", e.name)
+
+		var decoded string
+		require.NoError(t, json.Unmarshal([]byte(e.data), &decoded))
+		data += decoded
+	}
+
+	return data
+}
+
+func TestHandleStream(t *testing.T) {
+	handler, server := setupStreamServer(t)
+
+	body, upload := io.Pipe()
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/stream", body)
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The link comes before the upload ends
+	output := bufio.NewReader(resp.Body)
+	line, err := output.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "\n", line)
+	line, err = output.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(line, "/live123\n"), line)
+
+	meta, err := handler.loadMetadata("live123")
+	require.NoError(t, err)
+	require.True(t, meta.Live)
+
+	// Live documents are served while empty
+	got := sendRequest(server.Config.Handler, http.MethodGet, "/documents/live123", nil)
+	require.Equal(t, http.StatusOK, got.Code)
+	require.Contains(t, got.Body.String(), `"live":true`)
+
+	events := follow(t, server, "live123", "")
+
+	_, err = upload.Write([]byte("[    1.000000] first\n"))
+	require.NoError(t, err)
+	requireChunk(t, readEvent(t, events), "[    1.000000] first\n", "21")
+
+	// Characters split between writes arrive whole
+	_, err = upload.Write([]byte("caf\xc3"))
+	require.NoError(t, err)
+	_, err = upload.Write([]byte("\xa9\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, "café\r\n", readChunks(t, events, 28-21))
+
+	// Followers reconnecting continue after the last event they received
+	resumed := follow(t, server, "live123", "21")
+	requireChunk(t, readEvent(t, resumed), "café\r\n", "28")
+
+	require.NoError(t, upload.Close())
+	require.Equal(t, "end", readEvent(t, events).name)
+	require.Equal(t, "end", readEvent(t, resumed).name)
+
+	rest, err := io.ReadAll(output)
+	require.NoError(t, err)
+	require.Equal(t, "\nSealed after 28 bytes.\n", string(rest))
+
+	data, err := handler.Store.Get("live123", false)
+	require.NoError(t, err)
+	require.Equal(t, "[    1.000000] first\ncafé\r\n", data)
+
+	meta, err = handler.loadMetadata("live123")
+	require.NoError(t, err)
+	require.False(t, meta.Live)
+
+	// Sealed documents are sent whole
+	sealed := follow(t, server, "live123", "")
+	requireChunk(t, readEvent(t, sealed), data, "28")
+	require.Equal(t, "end", readEvent(t, sealed).name)
+}
+
+func TestHandleStream_ExceedsMaxLength(t *testing.T) {
+	handler, server := setupStreamServer(t)
+
+	resp, err := http.Post(server.URL+"/stream", "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/stream", strings.NewReader(strings.Repeat("A", 2000)))
+	require.NoError(t, err)
+
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	output, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(string(output), "Document exceeds maximum length, it was sealed after 1024 bytes.\n"), string(output))
+
+	data, err := handler.Store.Get("live123", false)
+	require.NoError(t, err)
+	require.Equal(t, strings.Repeat("A", 1024), data)
+}
+
+func TestHandleStream_ExceedsMaxLengthMidRune(t *testing.T) {
+	handler, server := setupStreamServer(t)
+
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/stream", strings.NewReader(strings.Repeat("A", 1023)+"é"))
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	output, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(string(output), "Document exceeds maximum length, it was sealed after 1023 bytes.\n"), string(output))
+
+	data, err := handler.Store.Get("live123", false)
+	require.NoError(t, err)
+	require.Equal(t, strings.Repeat("A", 1023), data)
+}
+
+func TestHandleStream_IdleTimeout(t *testing.T) {
+	handler, server := setupStreamServer(t)
+	handler.StreamIdleTimeout = 100 * time.Millisecond
+
+	body, upload := io.Pipe()
+	defer upload.Close()
+
+	go upload.Write([]byte("waiting\n"))
+
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/stream", body)
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	output, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(string(output), "Sealed after 8 bytes.\n"), string(output))
+
+	meta, err := handler.loadMetadata("live123")
+	require.NoError(t, err)
+	require.False(t, meta.Live)
+}
+
+func TestCloseStreams(t *testing.T) {
+	handler := NewDocumentHandler(6, 1024, storage.NewFileStorage(t.TempDir(), 0), &mockKeyGenerator{fixedKey: "live123"})
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	server := httptest.NewUnstartedServer(router)
+	server.Config.RegisterOnShutdown(handler.CloseStreams)
+	server.Start()
+	t.Cleanup(server.Close)
+
+	body, upload := io.Pipe()
+	defer upload.Close()
+
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/stream", body)
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	_, err = upload.Write([]byte("partial"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		live := handler.streams.get("live123")
+		return live != nil && live.String() == "partial"
+	}, time.Second, 10*time.Millisecond)
+
+	// The upload is still open when the shutdown deadline passes, live pastes are sealed once
+	// CloseStreams returns, so storage may be closed after it
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	server.Config.Shutdown(ctx)
+	handler.CloseStreams()
+
+	meta, err := handler.loadMetadata("live123")
+	require.NoError(t, err)
+	require.False(t, meta.Live)
+
+	data, err := handler.Store.Get("live123", false)
+	require.NoError(t, err)
+	require.Equal(t, "partial", data)
+	require.Nil(t, handler.streams.get("live123"))
+}
+
+func TestHandleStream_ViewsUnsupported(t *testing.T) {
+	handler, server := setupStreamServer(t)
+
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/stream?views=1", strings.NewReader("secret"))
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	_, err = handler.Store.Get("live123", false)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestHandleFollow_NotFound(t *testing.T) {
+	_, server := setupStreamServer(t)
+
+	resp, err := http.Get(server.URL + "/documents/missing/follow")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestHandleFollow_Password(t *testing.T) {
+	handler, server := setupStreamServer(t)
+
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/stream", strings.NewReader("secret\n"))
+	require.NoError(t, err)
+	req.Header.Set("X-Password", "hunter2")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// Revisions, metadata and other keys next to the document aren't followed around its password
+	require.NoError(t, handler.Store.Set("live123@2", "revised secret\n", false))
+	for _, id := range []string{"live123@2", "live123.metadata", "live123.txt"} {
+		resp, err := http.Get(server.URL + "/documents/" + id + "/follow")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode, id)
+	}
+
+	resp, err = http.Get(server.URL + "/documents/live123/follow")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/documents/live123/follow?password=hunter2")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	events := bufio.NewReader(resp.Body)
+	requireChunk(t, readEvent(t, events), "secret\n", "7")
+	require.Equal(t, "end", readEvent(t, events).name)
+}
+
+func TestIncompleteRune(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected int
+	}{
+		{"", 0},
+		{"ascii", 0},
+		{"café", 0},
+		{"caf\xc3", 1},
+		{"\xe2\x82", 2},
+		{"\xf0\x9f\x98", 3},
+		{"\xf0\x9f\x98\x80", 0},
+		{"invalid\x80", 0},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, incompleteRune([]byte(test.data)), "%q", test.data)
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/armbian/ansi-hastebin/storage"
+)
+
+var (
+	errKeyUnauthorized = errors.New("choosing keys requires authorization")
+	errInvalidKey      = errors.New("invalid key")
+	errReservedKey     = errors.New("key is reserved")
+	errKeyTaken        = errors.New("key is already taken")
+	errKeysExhausted   = errors.New("no generated key is free of prefixes of other profiles")
+)
+
+// maxKeyAttempts is the number of keys generated before giving up on finding one outside
+// prefixes of other profiles
+const maxKeyAttempts = 16
+
+// vanityKeyChars are characters allowed in keys chosen by uploaders
+// Dots are left out, as they separate the key from the extension in document URLs.
+const vanityKeyChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"
+
+// VanityKeys allows authenticated clients to choose keys of their documents
+type VanityKeys struct {
+	// Tokens are bearer tokens of clients allowed to choose keys, empty list disables vanity keys
+	Tokens []string
+
+	// MinLength and MaxLength limit length of chosen keys
+	MinLength int
+	MaxLength int
+
+	// Reserved are keys which can't be chosen, such as keys of static documents
+	// and names served by other routes. They are compared case-insensitively.
+	Reserved []string
+}
+
+// Authorize reports whether token allows choosing keys
+func (v VanityKeys) Authorize(token string) bool {
+	if token == "" {
+		return false
+	}
+
+	for _, allowed := range v.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate checks the key against the charset, length and reserved names
+func (v VanityKeys) Validate(key string) error {
+	if key == "" || len(key) < v.MinLength || (v.MaxLength > 0 && len(key) > v.MaxLength) {
+		return errInvalidKey
+	}
+
+	if strings.Trim(key, vanityKeyChars) != "" {
+		return errInvalidKey
+	}
+
+	if slices.ContainsFunc(v.Reserved, func(reserved string) bool { return strings.EqualFold(reserved, key) }) {
+		return errReservedKey
+	}
+
+	return nil
+}
+
+// Returns key chosen by the uploader, the request has to be authorized by a client token
+// Empty key means the key is generated.
+func (h *DocumentHandler) vanityKey(r *http.Request, key string) (string, error) {
+	if key == "" {
+		return "", nil
+	}
+
+	if !h.Vanity.Authorize(bearerToken(r)) {
+		return "", errKeyUnauthorized
+	}
+
+	return key, h.Vanity.Validate(key)
+}
+
+// Reports whether a document is already stored under the key
+// The check isn't atomic with storing the document, concurrent uploads of the same
+// key may overwrite each other.
+func (h *DocumentHandler) taken(key string) (bool, error) {
+	_, err := h.Store.Get(key, true)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Writes response for a vanity key error
+func keyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errKeyUnauthorized):
+		http.Error(w, `{"message": "Choosing keys requires authorization."}`, http.StatusUnauthorized)
+	case errors.Is(err, errReservedKey):
+		http.Error(w, `{"message": "Key is reserved."}`, http.StatusConflict)
+	case errors.Is(err, errKeyTaken):
+		http.Error(w, `{"message": "Key is already taken."}`, http.StatusConflict)
+	default:
+		http.Error(w, `{"message": "Invalid key."}`, http.StatusBadRequest)
+	}
+}
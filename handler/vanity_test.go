@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVanityKeys_Validate(t *testing.T) {
+	vanity := VanityKeys{MinLength: 3, MaxLength: 24, Reserved: []string{"about", "raw"}}
+
+	for _, key := range []string{"orangepi5-boot-fail", "abc", "Board_42"} {
+		require.NoError(t, vanity.Validate(key), key)
+	}
+
+	for _, key := range []string{"", "ab", strings.Repeat("a", 25), "boot.log", "boot/log", "boot log", "bööt"} {
+		require.ErrorIs(t, vanity.Validate(key), errInvalidKey, key)
+	}
+
+	for _, key := range []string{"about", "ABOUT", "raw"} {
+		require.ErrorIs(t, vanity.Validate(key), errReservedKey, key)
+	}
+}
+
+func TestVanityKeys_Authorize(t *testing.T) {
+	vanity := VanityKeys{Tokens: []string{"first", "second"}}
+
+	require.True(t, vanity.Authorize("first"))
+	require.True(t, vanity.Authorize("second"))
+	require.False(t, vanity.Authorize("third"))
+	require.False(t, vanity.Authorize(""))
+
+	require.False(t, VanityKeys{}.Authorize(""))
+}
+
+func setupVanityHandler() (*DocumentHandler, http.Handler) {
+	handler := setupHandler()
+	handler.Vanity = VanityKeys{Tokens: []string{"client-token"}, MinLength: 3, MaxLength: 64, Reserved: []string{"about"}}
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+	return handler, router
+}
+
+func sendVanityRequest(router http.Handler, method, path, key, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	if key != "" {
+		req.Header.Set("X-Key", key)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlePutLog_VanityKey(t *testing.T) {
+	_, router := setupVanityHandler()
+
+	resp := sendVanityRequest(router, http.MethodPut, "/log", "orangepi5-boot-fail", "client-token", "boot log")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Contains(t, resp.Body.String(), "/orangepi5-boot-fail")
+
+	resp = sendRequest(router, http.MethodGet, "/raw/orangepi5-boot-fail", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "boot log", resp.Body.String())
+
+	// Taken keys are not overwritten
+	resp = sendVanityRequest(router, http.MethodPut, "/log", "orangepi5-boot-fail", "client-token", "other log")
+	require.Equal(t, http.StatusConflict, resp.Code)
+
+	resp = sendRequest(router, http.MethodGet, "/raw/orangepi5-boot-fail", nil)
+	require.Equal(t, "boot log", resp.Body.String())
+}
+
+func TestHandlePutLog_VanityKeyReused(t *testing.T) {
+	for _, deletes := range []bool{true, false} {
+		handler, router := setupVanityHandler()
+		store := handler.Store.(*mockStorage)
+		if !deletes {
+			handler.Store = struct{ storage.Storage }{store}
+		}
+
+		req := httptest.NewRequest(http.MethodPut, "/log", bytes.NewBufferString("secret log"))
+		req.Header.Set("X-Key", "reused")
+		req.Header.Set("Authorization", "Bearer client-token")
+		req.Header.Set("X-Password", "hunter2")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		// The document expires, its metadata outlives it
+		delete(store.data, "reused")
+		require.Contains(t, store.data, "reused"+metadataSuffix)
+
+		resp := sendVanityRequest(router, http.MethodPut, "/log", "reused", "client-token", "public log")
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		resp = sendRequest(router, http.MethodGet, "/raw/reused", nil)
+		require.Equal(t, http.StatusOK, resp.Code, "deletes %v", deletes)
+		require.Equal(t, "public log", resp.Body.String())
+	}
+}
+
+func TestHandlePost_VanityKeyErrors(t *testing.T) {
+	_, router := setupVanityHandler()
+
+	tests := []struct {
+		key, token string
+		code       int
+	}{
+		{key: "my-key", token: "", code: http.StatusUnauthorized},
+		{key: "my-key", token: "wrong", code: http.StatusUnauthorized},
+		{key: "my.key", token: "client-token", code: http.StatusBadRequest},
+		{key: "ab", token: "client-token", code: http.StatusBadRequest},
+		{key: "about", token: "client-token", code: http.StatusConflict},
+	}
+
+	for _, test := range tests {
+		resp := sendVanityRequest(router, http.MethodPost, "/documents", test.key, test.token, "content")
+		require.Equal(t, test.code, resp.Code, test.key)
+	}
+}
+
+func TestHandleAPICreate_VanityKey(t *testing.T) {
+	handler, router := setupVanityHandler()
+	handler.Policies = map[string]Policy{RouteDocuments: {Prefix: "p-"}}
+
+	resp := sendVanityRequest(router, http.MethodPost, "/api/v1/documents", "", "client-token", `{"key": "my-config", "content": "config"}`)
+	require.Equal(t, http.StatusCreated, resp.Code)
+	require.Contains(t, resp.Body.String(), `"key":"p-my-config"`)
+
+	resp = sendVanityRequest(router, http.MethodPost, "/api/v1/documents", "", "", `{"key": "other-config", "content": "config"}`)
+	require.Equal(t, http.StatusUnauthorized, resp.Code)
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	errInvalidViews     = errors.New("invalid view limit")
+	errViewsUnsupported = errors.New("storage doesn't support view limits")
+)
+
+// Returns view limit requested through "views" query parameter or X-Views header, 0 means unlimited
+func requestedViews(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("views")
+	if value == "" {
+		value = r.Header.Get("X-Views")
+	}
+
+	if value == "" {
+		return 0, nil
+	}
+
+	views, err := strconv.Atoi(value)
+	if err != nil || views <= 0 {
+		return 0, errInvalidViews
+	}
+
+	return views, nil
+}
+
+// Reads a document limited by views, taking one of them
+// The last view removes the document in the storage, its metadata is removed here.
+func (h *DocumentHandler) consume(key string) (string, error) {
+	consumer, ok := h.Store.(storage.ViewConsumer)
+	if !ok {
+		return "", errViewsUnsupported
+	}
+
+	data, views, err := consumer.Consume(key)
+	if err != nil || views != 0 {
+		return data, err
+	}
+
+	log.Info().Str("key", key).Msg("Burned document after its last view")
+
+	if deleter, ok := h.Store.(storage.Deleter); ok {
+		if err := deleter.Delete(key + metadataSuffix); err != nil {
+			log.Error().Err(err).Str("key", key).Msg("Failed to delete metadata of burned document")
+		}
+	}
+
+	return data, nil
+}
+
+// Reports whether reading the document for the request takes a view of documents limited
+// by them, HEAD requests don't
+func takesView(r *http.Request) bool {
+	return r.Method != http.MethodHead
+}
+
+// Writes response for a view limit error
+func viewsError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errViewsUnsupported):
+		http.Error(w, `{"message": "View limits are not supported."}`, http.StatusBadRequest)
+	default:
+		http.Error(w, `{"message": "Invalid view limit."}`, http.StatusBadRequest)
+	}
+}
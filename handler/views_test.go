@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// viewMockStorage limits views of entries stored with them
+type viewMockStorage struct {
+	*entryMockStorage
+	mu sync.Mutex
+}
+
+func newViewMockStorage() *viewMockStorage {
+	return &viewMockStorage{entryMockStorage: &entryMockStorage{mockStorage: &mockStorage{data: make(map[string]string)}, entries: map[string]storage.Entry{}}}
+}
+
+func (m *viewMockStorage) Get(key string, skip_expiration bool) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mockStorage.Get(key, skip_expiration)
+}
+
+func (m *viewMockStorage) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mockStorage.Delete(key)
+}
+
+func (m *viewMockStorage) Consume(key string) (string, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, err := m.mockStorage.Get(key, false)
+	if err != nil {
+		return "", 0, err
+	}
+
+	entry, ok := m.entries[key]
+	if !ok || entry.Views == 0 {
+		return value, -1, nil
+	}
+
+	entry.Views--
+	m.entries[key] = entry
+	if entry.Views == 0 {
+		delete(m.data, key)
+	}
+
+	return value, entry.Views, nil
+}
+
+func TestRequestedViews(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "/documents?views=3", nil)
+	views, err := requestedViews(req)
+	require.NoError(t, err)
+	require.Equal(t, 3, views)
+
+	req, _ = http.NewRequest(http.MethodPost, "/documents", nil)
+	req.Header.Set("X-Views", "1")
+	views, err = requestedViews(req)
+	require.NoError(t, err)
+	require.Equal(t, 1, views)
+
+	req, _ = http.NewRequest(http.MethodPost, "/documents", nil)
+	views, err = requestedViews(req)
+	require.NoError(t, err)
+	require.Zero(t, views)
+
+	for _, value := range []string{"0", "-1", "many"} {
+		req, _ = http.NewRequest(http.MethodPost, "/documents?views="+value, nil)
+		_, err = requestedViews(req)
+		require.ErrorIs(t, err, errInvalidViews, value)
+	}
+}
+
+func TestHandlePost_Views(t *testing.T) {
+	store := newViewMockStorage()
+	handler := NewDocumentHandler(6, 1024, store, &mockKeyGenerator{fixedKey: "test123"})
+	handler.StorageExpiration = time.Hour
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/documents?views=1", bytes.NewBufferString("secret"))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	// Documents limited by views keep the storage-wide expiration
+	entry := store.entries["test123"]
+	require.Equal(t, 1, entry.Views)
+	require.WithinDuration(t, time.Now().Add(time.Hour), entry.Expiration, time.Minute)
+
+	resp = sendRequest(router, http.MethodPost, "/documents?views=none", bytes.NewBufferString("secret"))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestHandlePost_ViewsUnsupported(t *testing.T) {
+	handler := setupHandler()
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPost, "/documents?views=1", bytes.NewBufferString("secret"))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestHandleRawGet_ViewsConcurrency(t *testing.T) {
+	handler := NewDocumentHandler(6, 1024, newViewMockStorage(), &mockKeyGenerator{fixedKey: "test123"})
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	resp := sendRequest(router, http.MethodPut, "/log?views=1", bytes.NewBufferString("secret"))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	const readers = 8
+
+	var wg sync.WaitGroup
+	codes := make(chan int, readers)
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- sendRequest(router, http.MethodGet, "/raw/test123", nil).Code
+		}()
+	}
+
+	wg.Wait()
+	close(codes)
+
+	// Only one reader sees a single view document
+	seen := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			seen++
+		}
+	}
+
+	require.Equal(t, 1, seen)
+}
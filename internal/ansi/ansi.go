@@ -0,0 +1,73 @@
+// Package ansi interprets ANSI escape sequences of terminal output stored in documents.
+package ansi
+
+// Kinds of escape sequences
+const (
+	// CSI is a control sequence, such as SGR or cursor movement
+	CSI = '['
+
+	// OSC is an operating system command, such as setting the window title
+	OSC = ']'
+
+	// DCS is a device control string, such as a status request
+	DCS = 'P'
+)
+
+// Sequence is an escape sequence at the start of the text
+type Sequence struct {
+	// Length is the number of bytes of the sequence including the escape
+	Length int
+
+	// Kind is CSI, OSC or the byte following the escape of other sequences
+	Kind byte
+
+	// Params are parameter bytes of CSI sequences and the payload of string sequences
+	Params string
+
+	// Final is the final byte of CSI sequences
+	Final byte
+}
+
+// Parse parses the escape sequence text starts with, incomplete sequences span the rest of text
+func Parse(text string) Sequence {
+	if len(text) < 2 || text[0] != '\x1b' {
+		return Sequence{Length: min(len(text), 1)}
+	}
+
+	switch text[1] {
+	case CSI:
+		i := 2
+		for i < len(text) && text[i] >= 0x30 && text[i] <= 0x3f {
+			i++
+		}
+		params := text[2:i]
+
+		for i < len(text) && text[i] >= 0x20 && text[i] <= 0x2f {
+			i++
+		}
+
+		// Incomplete sequences and ones interrupted by other bytes, such as another escape, end before them
+		if i == len(text) || text[i] < 0x40 || text[i] > 0x7e {
+			return Sequence{Length: i, Kind: CSI, Params: params}
+		}
+
+		return Sequence{Length: i + 1, Kind: CSI, Params: params, Final: text[i]}
+	case OSC, DCS, 'X', '^', '_':
+		// Strings of OSC, DCS, SOS, PM and APC are terminated by ST, terminals accept BEL too
+		for i := 2; i < len(text); i++ {
+			switch {
+			case text[i] == '\x07':
+				return Sequence{Length: i + 1, Kind: text[1], Params: text[2:i]}
+			case text[i] == '\x1b' && i+1 < len(text) && text[i+1] == '\\':
+				return Sequence{Length: i + 2, Kind: text[1], Params: text[2:i]}
+			}
+		}
+
+		return Sequence{Length: len(text), Kind: text[1], Params: text[2:]}
+	case '(', ')', '*', '+':
+		// Character set designation
+		return Sequence{Length: min(len(text), 3), Kind: text[1]}
+	default:
+		return Sequence{Length: 2, Kind: text[1]}
+	}
+}
@@ -0,0 +1,18 @@
+package ansi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	require.Equal(t, Sequence{Length: 6, Kind: CSI, Params: "1;2", Final: 'm'}, Parse("\x1b[1;2mtext"))
+	require.Equal(t, Sequence{Length: 10, Kind: OSC, Params: "0;title"}, Parse("\x1b]0;title\x07"))
+	require.Equal(t, Sequence{Length: 11, Kind: OSC, Params: "0;title"}, Parse("\x1b]0;title\x1b\\"))
+	require.Equal(t, Sequence{Length: 3, Kind: '('}, Parse("\x1b(B"))
+	require.Equal(t, Sequence{Length: 2, Kind: 'M'}, Parse("\x1bM"))
+	require.Equal(t, Sequence{Length: 1}, Parse("\x1b"))
+	require.Equal(t, Sequence{Length: 7, Kind: DCS, Params: "$qm"}, Parse("\x1bP$qm\x1b\\"))
+	require.Equal(t, Sequence{Length: 3, Kind: CSI, Params: "1"}, Parse("\x1b[1\x1b]0;title\x07"))
+}
@@ -0,0 +1,271 @@
+package ansi
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Default colors of text without SGR colors, as in the web view
+const (
+	DefaultForeground = "#FFF"
+	DefaultBackground = "#000"
+)
+
+// Palette maps xterm color numbers to CSS colors, it is the palette of the web view
+var Palette = palette()
+
+func palette() [256]string {
+	colors := [256]string{
+		"#999", // no, NOT BLACK
+		"#ff5252",
+		"#5F5",
+		"#ffeb00",
+		"#4242da",
+		"#ff84ff",
+		"#92ffff",
+		"#AAA",
+		"#777",
+		"#F55",
+		"#3bfd3b",
+		"#ffff0b",
+		"#55F",
+		"#F5F",
+		"#5FF",
+		"#FFF",
+	}
+
+	level := func(value int) int {
+		if value == 0 {
+			return 0
+		}
+
+		return value*40 + 55
+	}
+
+	for red := range 6 {
+		for green := range 6 {
+			for blue := range 6 {
+				colors[16+red*36+green*6+blue] = fmt.Sprintf("#%02x%02x%02x", level(red), level(green), level(blue))
+			}
+		}
+	}
+
+	for gray := range 24 {
+		colors[232+gray] = fmt.Sprintf("#%02x%02x%02x", gray*10+8, gray*10+8, gray*10+8)
+	}
+
+	return colors
+}
+
+// style is the state of SGR attributes
+type style struct {
+	fg, bg    string
+	bold      bool
+	italic    bool
+	underline bool
+	strike    bool
+	overline  bool
+}
+
+// Returns the CSS of the style, empty for the default one
+func (s style) css() string {
+	var rules []string
+	if s.fg != "" {
+		rules = append(rules, "color:"+s.fg)
+	}
+
+	if s.bg != "" {
+		rules = append(rules, "background-color:"+s.bg)
+	}
+
+	if s.bold {
+		rules = append(rules, "font-weight:bold")
+	}
+
+	if s.italic {
+		rules = append(rules, "font-style:italic")
+	}
+
+	var decorations []string
+	if s.underline {
+		decorations = append(decorations, "underline")
+	}
+
+	if s.strike {
+		decorations = append(decorations, "line-through")
+	}
+
+	if s.overline {
+		decorations = append(decorations, "overline")
+	}
+
+	if len(decorations) > 0 {
+		rules = append(rules, "text-decoration:"+strings.Join(decorations, " "))
+	}
+
+	return strings.Join(rules, ";")
+}
+
+// Applies parameters of a SGR sequence
+func (s *style) apply(params string) {
+	if params == "" {
+		params = "0"
+	}
+
+	codes := strings.FieldsFunc(params, func(r rune) bool { return r == ';' || r == ':' })
+	for i := 0; i < len(codes); i++ {
+		code, err := strconv.Atoi(codes[i])
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case code == 0:
+			*s = style{}
+		case code == 1:
+			s.bold = true
+		case code == 3:
+			s.italic = true
+		case code == 4:
+			s.underline = true
+		case code == 9:
+			s.strike = true
+		case code == 22:
+			// The web view resets weight and decorations alike
+			*s = style{fg: s.fg, bg: s.bg}
+		case code == 23:
+			s.italic = false
+		case code == 24:
+			s.underline = false
+		case code == 29:
+			s.strike = false
+		case code == 53:
+			s.overline = true
+		case code == 55:
+			s.overline = false
+		case code >= 30 && code <= 37:
+			s.fg = Palette[code-30]
+		case code >= 90 && code <= 97:
+			s.fg = Palette[code-90+8]
+		case code == 39:
+			s.fg = DefaultForeground
+		case code == 49:
+			s.bg = ""
+		case (code >= 40 && code <= 47) || (code >= 100 && code <= 107):
+			// Backgrounds of the 16 colors are left out as in the web view
+		case code == 38 || code == 48:
+			color, skip := extendedColor(codes[i+1:])
+			i += skip
+			if color == "" {
+				continue
+			}
+
+			if code == 38 {
+				s.fg = color
+			} else {
+				s.bg = color
+			}
+		}
+	}
+}
+
+// Returns the color of 256 color and truecolor parameters following 38 or 48 and
+// the number of parameters taken, malformed parameters take the rest of the sequence
+func extendedColor(params []string) (string, int) {
+	if len(params) == 0 {
+		return "", 0
+	}
+
+	count := 0
+	switch params[0] {
+	case "5":
+		count = 1
+	case "2":
+		count = 3
+	default:
+		return "", 1
+	}
+
+	if len(params) <= count {
+		return "", len(params)
+	}
+
+	values := make([]int, count)
+	for i := range values {
+		value, err := strconv.Atoi(params[1+i])
+		if err != nil || value < 0 || value > 255 {
+			return "", len(params)
+		}
+
+		values[i] = value
+	}
+
+	if count == 1 {
+		return Palette[values[0]], 2
+	}
+
+	return fmt.Sprintf("#%02x%02x%02x", values[0], values[1], values[2]), 4
+}
+
+// ToHTML renders SGR colors and attributes of text as HTML spans and escapes the text
+// Other escape sequences and backspaces are removed, carriage returns end lines.
+func ToHTML(text string) string {
+	var sb strings.Builder
+	var current, next style
+	open := false
+
+	for i := 0; i < len(text); {
+		switch text[i] {
+		case '\x1b':
+			seq := Parse(text[i:])
+			if seq.Kind == CSI && seq.Final == 'm' {
+				next.apply(seq.Params)
+			}
+
+			i += seq.Length
+			continue
+		case '\b':
+			i++
+			continue
+		case '\r':
+			i++
+			if i < len(text) && text[i] == '\n' {
+				continue
+			}
+
+			sb.WriteByte('\n')
+			continue
+		}
+
+		end := i + 1
+		for end < len(text) && !strings.ContainsRune("\x1b\b\r", rune(text[end])) {
+			end++
+		}
+
+		// Spans are only opened for text, so attributes changed before any text leave no empty spans
+		if next != current {
+			if open {
+				sb.WriteString("</span>")
+			}
+
+			css := next.css()
+			open = css != ""
+			if open {
+				sb.WriteString(`<span style="` + css + `">`)
+			}
+
+			current = next
+		}
+
+		sb.WriteString(html.EscapeString(text[i:end]))
+		i = end
+	}
+
+	if open {
+		sb.WriteString("</span>")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,44 @@
+package ansi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPalette(t *testing.T) {
+	require.Equal(t, "#999", Palette[0])
+	require.Equal(t, "#FFF", Palette[15])
+	require.Equal(t, "#000000", Palette[16])
+	require.Equal(t, "#5f87af", Palette[67])
+	require.Equal(t, "#ffffff", Palette[231])
+	require.Equal(t, "#080808", Palette[232])
+	require.Equal(t, "#eeeeee", Palette[255])
+}
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "plain", input: "plain <text> & \"quotes\"", expected: "plain &lt;text&gt; &amp; &#34;quotes&#34;"},
+		{name: "16 colors", input: "\x1b[31mred\x1b[0m \x1b[92mgreen\x1b[m", expected: `<span style="color:#ff5252">red</span> <span style="color:#3bfd3b">green</span>`},
+		{name: "256 colors", input: "\x1b[38;5;67mblue\x1b[48;5;232mon gray", expected: `<span style="color:#5f87af">blue</span><span style="color:#5f87af;background-color:#080808">on gray</span>`},
+		{name: "truecolor", input: "\x1b[38;2;255;128;0morange", expected: `<span style="color:#ff8000">orange</span>`},
+		{name: "attributes", input: "\x1b[1;4mbold\x1b[24m no line\x1b[22m normal", expected: `<span style="font-weight:bold;text-decoration:underline">bold</span><span style="font-weight:bold"> no line</span> normal`},
+		{name: "combined", input: "\x1b[1;38;5;196;4mx", expected: `<span style="color:#ff0000;font-weight:bold;text-decoration:underline">x</span>`},
+		{name: "default foreground", input: "\x1b[31ma\x1b[39mb", expected: `<span style="color:#ff5252">a</span><span style="color:#FFF">b</span>`},
+		{name: "16 color background", input: "\x1b[41mtext", expected: "text"},
+		{name: "no empty spans", input: "\x1b[31m\x1b[0mtext\x1b[32m", expected: "text"},
+		{name: "other sequences", input: "\x1b[2J\x1b[1;1Hclear\x1b]0;title\x07\x1b(B\b!", expected: "clear!"},
+		{name: "carriage returns", input: "a\r\nb\rc", expected: "a\nb\nc"},
+		{name: "incomplete", input: "text\x1b[3", expected: "text"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, ToHTML(test.input))
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package ansi
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Sanitize makes text safe to write to a terminal, only SGR sequences are kept
+// Every other escape sequence is removed, among them clipboard writes, window titles,
+// hyperlinks and status requests answered by terminals into their input. C0 controls
+// other than line endings, tabs and backspaces are removed, as are C1 controls.
+func Sanitize(text string) string {
+	var sb strings.Builder
+	sb.Grow(len(text))
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\x1b':
+			seq := Parse(text[i:])
+			if isSGR(seq) {
+				sb.WriteString(text[i : i+seq.Length])
+			}
+
+			i += seq.Length
+		case c == '\n' || c == '\r' || c == '\t' || c == '\b':
+			sb.WriteByte(c)
+			i++
+		case c < 0x20 || c == 0x7f:
+			i++
+		case c < utf8.RuneSelf:
+			sb.WriteByte(c)
+			i++
+		default:
+			r, size := utf8.DecodeRuneInString(text[i:])
+
+			// Terminals which aren't in UTF-8 mode read stray bytes as C1 controls
+			if (r == utf8.RuneError && size == 1 && c <= 0x9f) || (r >= 0x80 && r <= 0x9f) {
+				i += size
+				continue
+			}
+
+			sb.WriteString(text[i : i+size])
+			i += size
+		}
+	}
+
+	return sb.String()
+}
+
+// Reports whether the sequence is SGR without anything else in it
+func isSGR(seq Sequence) bool {
+	return seq.Kind == CSI && seq.Final == 'm' && seq.Length == len(seq.Params)+3 &&
+		strings.Trim(seq.Params, "0123456789;:") == ""
+}
@@ -0,0 +1,33 @@
+package ansi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "plain", input: "plain\ttext\r\n", expected: "plain\ttext\r\n"},
+		{name: "colors", input: "\x1b[1;31merror\x1b[0m \x1b[38;5;67mx\x1b[38:2::1:2:3my\x1b[m", expected: "\x1b[1;31merror\x1b[0m \x1b[38;5;67mx\x1b[38:2::1:2:3my\x1b[m"},
+		{name: "progress", input: " 10%\r\b100%", expected: " 10%\r\b100%"},
+		{name: "clipboard", input: "a\x1b]52;c;cm0gLXJmIH4K\x07b", expected: "ab"},
+		{name: "title", input: "\x1b]0;pwned\x1b\\text", expected: "text"},
+		{name: "hyperlink", input: "\x1b]8;;https://evil.example\x1b\\https://good.example\x1b]8;;\x1b\\", expected: "https://good.example"},
+		{name: "status request", input: "\x1bP$qm\x1b\\\x1b[6n\x1b[>c\x1b[21t", expected: ""},
+		{name: "cursor", input: "\x1b[2J\x1b[H\x1b[1Ahidden\x1b7\x1b8", expected: "hidden"},
+		{name: "sgr with intermediate", input: "\x1b[1 m\x1b[?1m", expected: ""},
+		{name: "controls", input: "\a\x00\x05\x7fok", expected: "ok"},
+		{name: "c1", input: "\u009b6n\xc2\x9d\x9b2Jok é", expected: "6n2Jok é"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, Sanitize(test.input))
+		})
+	}
+}
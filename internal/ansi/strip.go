@@ -0,0 +1,121 @@
+package ansi
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxCursorSkip is how far past the end of a line the cursor moves, terminals are rarely wider
+const maxCursorSkip = 256
+
+// maxPaddingRatio limits spaces added by cursor moves to a multiple of the length of the text
+const maxPaddingRatio = 4
+
+// line is the line of a terminal being written, with the cursor in it
+type line struct {
+	cells  []rune
+	cursor int
+
+	// padding is the number of spaces cursor moves past the end of lines may still add
+	padding int
+}
+
+func (l *line) write(r rune) {
+	for len(l.cells) < l.cursor && l.padding > 0 {
+		l.cells = append(l.cells, ' ')
+		l.padding--
+	}
+
+	l.cursor = min(l.cursor, len(l.cells))
+	if l.cursor < len(l.cells) {
+		l.cells[l.cursor] = r
+	} else {
+		l.cells = append(l.cells, r)
+	}
+
+	l.cursor++
+}
+
+// Applies CSI sequences moving the cursor within the line or erasing it
+func (l *line) control(seq Sequence) {
+	count := 1
+	if n, err := strconv.Atoi(seq.Params); err == nil && n > 0 {
+		count = n
+	}
+
+	switch seq.Final {
+	case 'C':
+		l.cursor = min(l.cursor+min(count, maxCursorSkip), len(l.cells)+maxCursorSkip)
+	case 'D':
+		l.cursor = max(l.cursor-count, 0)
+	case 'G':
+		l.cursor = min(count-1, len(l.cells)+maxCursorSkip)
+	case 'K':
+		switch seq.Params {
+		case "", "0":
+			l.cells = l.cells[:min(l.cursor, len(l.cells))]
+		case "1":
+			for i := 0; i <= l.cursor && i < len(l.cells); i++ {
+				l.cells[i] = ' '
+			}
+		case "2":
+			l.cells = l.cells[:0]
+		}
+	}
+}
+
+// Strip removes escape sequences and control characters from text, leaving what a terminal shows
+// Carriage returns, backspaces and cursor movement within a line overwrite it, so progress
+// bars collapse to their final state. Sequences moving the cursor across lines are removed.
+// Cursor moves pad lines with at most maxPaddingRatio times as many spaces as the text is long.
+func Strip(text string) string {
+	var sb strings.Builder
+	sb.Grow(len(text))
+
+	current := line{padding: maxPaddingRatio*len(text) + maxCursorSkip}
+	flush := func() {
+		sb.WriteString(string(current.cells))
+		current = line{cells: current.cells[:0], padding: current.padding}
+	}
+
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == '\x1b':
+			seq := Parse(text[i:])
+			if seq.Kind == CSI {
+				current.control(seq)
+			}
+
+			i += seq.Length
+		case c == '\n':
+			flush()
+			sb.WriteByte('\n')
+			i++
+		case c == '\r':
+			// Line endings of Windows don't return the cursor
+			if i+1 < len(text) && text[i+1] == '\n' {
+				i++
+				continue
+			}
+
+			current.cursor = 0
+			i++
+		case c == '\b':
+			current.cursor = max(current.cursor-1, 0)
+			i++
+		case c == '\t':
+			current.write('\t')
+			i++
+		case c < 0x20 || c == 0x7f:
+			i++
+		default:
+			r, size := utf8.DecodeRuneInString(text[i:])
+			current.write(r)
+			i += size
+		}
+	}
+
+	flush()
+	return sb.String()
+}
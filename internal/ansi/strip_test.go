@@ -0,0 +1,46 @@
+package ansi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "plain", input: "plain text\n  indented  \n", expected: "plain text\n  indented  \n"},
+		{name: "colors", input: "\x1b[1;31merror:\x1b[0m failed\n", expected: "error: failed\n"},
+		{name: "osc", input: "\x1b]0;title\x07\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\\n", expected: "link\n"},
+		{name: "progress", input: "  0%\r 50%\r100%\ndone\n", expected: "100%\ndone\n"},
+		{name: "shorter overwrite", input: "downloading\rok\n", expected: "okwnloading\n"},
+		{name: "erase line", input: "downloading\r\x1b[Kok\n", expected: "ok\n"},
+		{name: "erase whole line", input: "downloading\x1b[2K\rok\n", expected: "ok\n"},
+		{name: "cursor", input: "abc\x1b[2Dx\x1b[3Cy\x1b[1Gz\n", expected: "zxc  y\n"},
+		{name: "cursor across lines", input: "one\n\x1b[1Atwo\x1b[2J\n", expected: "one\ntwo\n"},
+		{name: "backspace", input: "ab\bc\n", expected: "ac\n"},
+		{name: "windows line endings", input: "one\r\ntwo\r\n", expected: "one\ntwo\n"},
+		{name: "controls", input: "bell\a\x00\ttab", expected: "bell\ttab"},
+		{name: "unicode", input: "ěščř\r\x1b[32mž\x1b[0m\n", expected: "žščř\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, Strip(test.input))
+		})
+	}
+}
+
+func TestStrip_CursorBounds(t *testing.T) {
+	// Far moves stop a little past the end of the line
+	require.Equal(t, strings.Repeat(" ", maxCursorSkip)+"x", Strip("\x1b[50000000Gx"))
+	require.Equal(t, "ab"+strings.Repeat(" ", maxCursorSkip)+"x", Strip("ab\x1b[9223372036854775807Cx"))
+
+	// Repeated moves pad lines with a limited number of spaces
+	input := strings.Repeat("\x1b[256Cx\n", 1000)
+	require.LessOrEqual(t, len(Strip(input)), (maxPaddingRatio+1)*len(input)+maxCursorSkip)
+}
@@ -0,0 +1,281 @@
+// Package archive implements a portable, backend independent archive of stored documents.
+//
+// An archive is a zstd compressed tar stream. The first member is always the
+// manifest "hastebin.json":
+//
+//	{"format": "hastebin-archive", "version": 1, "created_at": "2025-01-01T00:00:00Z"}
+//
+// It is followed by one pair of members per document, where N is a sequence number
+// starting at 1:
+//
+//	documents/N/entry.json  {"key": "abcdef", "expires_at": "2025-02-01T00:00:00Z", "ttl": 3600, "views": 1}
+//	documents/N/content     raw document content
+//
+// "expires_at" is omitted for documents which never expire, "ttl" is the lifetime in seconds
+// of documents stored with their own one and omitted otherwise. "views" is the number of reads
+// left of documents limited by views and omitted otherwise. Readers must ignore
+// unknown members and unknown fields, the version is only increased on incompatible changes.
+package archive
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// Format is the identifier of the archive format stored in the manifest
+	Format = "hastebin-archive"
+
+	// Version is the current version of the archive format
+	Version = 1
+
+	manifestName = "hastebin.json"
+	entryName    = "entry.json"
+	contentName  = "content"
+	documentsDir = "documents"
+)
+
+var (
+	ErrInvalidArchive     = errors.New("invalid archive")
+	ErrUnsupportedVersion = errors.New("unsupported archive version")
+)
+
+type manifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type entryHeader struct {
+	Key       string     `json:"key"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       int64      `json:"ttl,omitempty"`
+	Views     int        `json:"views,omitempty"`
+}
+
+// Writer writes documents into an archive
+type Writer struct {
+	zw    *zstd.Encoder
+	tw    *tar.Writer
+	count int
+}
+
+// NewWriter creates a new archive writer and writes the manifest
+func NewWriter(w io.Writer) (*Writer, error) {
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+
+	aw := &Writer{zw: zw, tw: tar.NewWriter(zw)}
+
+	data, err := json.Marshal(manifest{Format: Format, Version: Version, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := aw.writeFile(manifestName, data); err != nil {
+		return nil, err
+	}
+
+	return aw, nil
+}
+
+// Write appends a single entry to the archive
+func (w *Writer) Write(entry storage.Entry) error {
+	header := entryHeader{Key: entry.Key, Views: entry.Views}
+	if !entry.Expiration.IsZero() {
+		expiresAt := entry.Expiration.UTC()
+		header.ExpiresAt = &expiresAt
+		header.TTL = int64(entry.TTL / time.Second)
+	}
+
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	w.count++
+	dir := path.Join(documentsDir, strconv.Itoa(w.count))
+
+	if err := w.writeFile(path.Join(dir, entryName), data); err != nil {
+		return err
+	}
+
+	return w.writeFile(path.Join(dir, contentName), []byte(entry.Value))
+}
+
+// Count returns the number of entries written so far
+func (w *Writer) Count() int {
+	return w.count
+}
+
+// Close flushes the archive, it doesn't close the underlying writer
+func (w *Writer) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+
+	return w.zw.Close()
+}
+
+func (w *Writer) writeFile(name string, data []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err := w.tw.Write(data)
+	return err
+}
+
+// Reader reads documents from an archive
+type Reader struct {
+	zr *zstd.Decoder
+	tr *tar.Reader
+}
+
+// NewReader creates a new archive reader and validates the manifest
+func NewReader(r io.Reader) (*Reader, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ar := &Reader{zr: zr, tr: tar.NewReader(zr)}
+
+	header, err := ar.tr.Next()
+	if err != nil || header.Name != manifestName {
+		zr.Close()
+		return nil, fmt.Errorf("%w: missing manifest", ErrInvalidArchive)
+	}
+
+	var m manifest
+	if err := json.NewDecoder(ar.tr).Decode(&m); err != nil || m.Format != Format {
+		zr.Close()
+		return nil, fmt.Errorf("%w: malformed manifest", ErrInvalidArchive)
+	}
+
+	if m.Version > Version {
+		zr.Close()
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, m.Version)
+	}
+
+	return ar, nil
+}
+
+// Next returns the next entry from the archive, io.EOF is returned at the end of the archive
+func (r *Reader) Next() (storage.Entry, error) {
+	var entry storage.Entry
+	var header *entryHeader
+
+	for {
+		th, err := r.tr.Next()
+		if err == io.EOF && header != nil {
+			return entry, fmt.Errorf("%w: missing content of %q", ErrInvalidArchive, header.Key)
+		} else if err != nil {
+			return entry, err
+		}
+
+		switch path.Base(th.Name) {
+		case entryName:
+			header = &entryHeader{}
+			if err := json.NewDecoder(r.tr).Decode(header); err != nil {
+				return entry, fmt.Errorf("%w: %s", ErrInvalidArchive, err)
+			}
+		case contentName:
+			if header == nil {
+				return entry, fmt.Errorf("%w: content without entry in %s", ErrInvalidArchive, th.Name)
+			}
+
+			value, err := io.ReadAll(r.tr)
+			if err != nil {
+				return entry, err
+			}
+
+			entry.Key = header.Key
+			entry.Value = string(value)
+			entry.Views = header.Views
+			if header.ExpiresAt != nil {
+				entry.Expiration = *header.ExpiresAt
+				entry.TTL = time.Duration(header.TTL) * time.Second
+			}
+
+			return entry, nil
+		}
+	}
+}
+
+// Close releases resources of the reader, it doesn't close the underlying reader
+func (r *Reader) Close() {
+	r.zr.Close()
+}
+
+// Export writes every entry of the store into w
+func Export(store storage.Storage, w io.Writer) (int, error) {
+	iterator, ok := store.(storage.Iterator)
+	if !ok {
+		return 0, fmt.Errorf("storage %T doesn't support export", store)
+	}
+
+	aw, err := NewWriter(w)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := iterator.Iterate(aw.Write); err != nil {
+		return aw.Count(), err
+	}
+
+	return aw.Count(), aw.Close()
+}
+
+// Import restores every entry from r into the store
+// Entries which have already expired are skipped.
+func Import(store storage.Storage, r io.Reader) (int, error) {
+	setter, ok := store.(storage.EntrySetter)
+	if !ok {
+		return 0, fmt.Errorf("storage %T doesn't support import", store)
+	}
+
+	ar, err := NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer ar.Close()
+
+	count := 0
+	now := time.Now()
+	for {
+		entry, err := ar.Next()
+		if err == io.EOF {
+			return count, nil
+		} else if err != nil {
+			return count, err
+		}
+
+		if !entry.Expiration.IsZero() && entry.Expiration.Before(now) {
+			continue
+		}
+
+		if err := setter.SetEntry(entry); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
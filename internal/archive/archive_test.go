@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterReaderRoundTrip(t *testing.T) {
+	expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+	entries := []storage.Entry{
+		{Key: "first", Value: "first value"},
+		{Key: "second", Value: "\x1b[31mcolored\x1b[0m\n", Expiration: expiration},
+		{Key: "empty", Value: ""},
+		{Key: "custom", Value: "custom ttl", Expiration: expiration, TTL: time.Hour},
+		{Key: "secret", Value: "single view", Views: 1},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	require.NoError(t, err)
+
+	for _, entry := range entries {
+		require.NoError(t, w.Write(entry))
+	}
+	require.Equal(t, 5, w.Count())
+	require.NoError(t, w.Close())
+
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	defer r.Close()
+
+	for _, expected := range entries {
+		entry, err := r.Next()
+		require.NoError(t, err)
+		require.Equal(t, expected.Key, entry.Key)
+		require.Equal(t, expected.Value, entry.Value)
+		require.True(t, expected.Expiration.Equal(entry.Expiration))
+		require.Equal(t, expected.TTL, entry.TTL)
+		require.Equal(t, expected.Views, entry.Views)
+	}
+
+	_, err = r.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestNewReader_Invalid(t *testing.T) {
+	_, err := NewReader(bytes.NewBufferString("not an archive"))
+	require.Error(t, err)
+
+	// Archive with manifest from the future
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	require.NoError(t, err)
+	tw := tar.NewWriter(zw)
+
+	data, err := json.Marshal(manifest{Format: Format, Version: Version + 1})
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0600, Size: int64(len(data))}))
+	_, err = tw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+
+	_, err = NewReader(&buf)
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+}
+
+func TestExportImport(t *testing.T) {
+	source := storage.NewFileStorage(t.TempDir(), 0)
+	require.NoError(t, source.Set("first", "first value", false))
+	require.NoError(t, source.Set("second", "second value", true))
+
+	var buf bytes.Buffer
+	count, err := Export(source, &buf)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	target := storage.NewFileStorage(t.TempDir(), 0)
+	count, err = Import(target, &buf)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	val, err := target.Get("first", false)
+	require.NoError(t, err)
+	require.Equal(t, "first value", val)
+
+	val, err = target.Get("second", false)
+	require.NoError(t, err)
+	require.Equal(t, "second value", val)
+}
+
+func TestImport_SkipsExpired(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(storage.Entry{Key: "expired", Value: "old", Expiration: time.Now().Add(-time.Hour)}))
+	require.NoError(t, w.Write(storage.Entry{Key: "alive", Value: "new"}))
+	require.NoError(t, w.Close())
+
+	target := storage.NewFileStorage(t.TempDir(), 0)
+	count, err := Import(target, &buf)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	_, err = target.Get("expired", false)
+	require.Error(t, err)
+}
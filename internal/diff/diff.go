@@ -0,0 +1,420 @@
+// Package diff compares documents line by line.
+//
+// Lines are compared by the Myers algorithm in linear space, bisecting the edit graph
+// at the middle snake, so comparing large logs doesn't need quadratic memory. Its time
+// is limited by a cost budget, blocks left once it runs out are replaced whole. Lines can
+// be normalized before comparison to ignore differences which are expected between
+// two runs, such as timestamps or ANSI escape sequences, the output keeps them intact.
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/armbian/ansi-hastebin/internal/ansi"
+)
+
+// Op is the operation applied to a line
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+var opNames = []string{Equal: "equal", Delete: "delete", Insert: "insert"}
+
+func (o Op) String() string {
+	return opNames[o]
+}
+
+// MarshalText encodes the operation by its name
+func (o Op) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText decodes the operation from its name
+func (o *Op) UnmarshalText(text []byte) error {
+	for op, name := range opNames {
+		if name == string(text) {
+			*o = Op(op)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown diff operation %q", text)
+}
+
+// Line is a line of a hunk
+type Line struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Hunk is a group of changed lines with lines of context around them
+// Starts are 1-based line numbers, or the number of preceding lines for empty ranges.
+type Hunk struct {
+	OldStart int    `json:"old_start"`
+	OldLines int    `json:"old_lines"`
+	NewStart int    `json:"new_start"`
+	NewLines int    `json:"new_lines"`
+	Lines    []Line `json:"lines"`
+}
+
+// Options adjust how lines are compared
+type Options struct {
+	// Context is the number of unchanged lines around changes
+	Context int
+
+	// IgnoreTimestamps ignores timestamps of kernel, syslog and ISO 8601 formats
+	IgnoreTimestamps bool
+
+	// IgnoreANSI ignores ANSI escape sequences, such as colors, and lines compare as shown by terminals
+	IgnoreANSI bool
+}
+
+var timestampPatterns = []*regexp.Regexp{
+	// dmesg
+	regexp.MustCompile(`\[\s*\d+\.\d+\]`),
+	// ISO 8601
+	regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`),
+	// syslog
+	regexp.MustCompile(`\b(?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) [ \d]\d \d{2}:\d{2}:\d{2}\b`),
+	// time of day
+	regexp.MustCompile(`\b\d{2}:\d{2}:\d{2}(?:[.,]\d+)?\b`),
+}
+
+// Returns the line as it is compared
+func (o Options) normalize(line string) string {
+	if o.IgnoreANSI {
+		line = ansi.Strip(line)
+	}
+
+	if o.IgnoreTimestamps {
+		for _, pattern := range timestampPatterns {
+			line = pattern.ReplaceAllString(line, "")
+		}
+	}
+
+	return line
+}
+
+// Compare returns hunks of changes turning document a into document b
+func Compare(a string, b string, opts Options) []Hunk {
+	linesA, linesB := split(a), split(b)
+
+	// Lines are compared by numbers of their normalized forms
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		result := make([]int, len(lines))
+		for i, line := range lines {
+			line = opts.normalize(line)
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+
+			result[i] = id
+		}
+
+		return result
+	}
+
+	d := &differ{
+		a:        intern(linesA),
+		b:        intern(linesB),
+		deleted:  make([]bool, len(linesA)),
+		inserted: make([]bool, len(linesB)),
+		budget:   maxCost,
+	}
+	d.compare(0, len(d.a), 0, len(d.b))
+
+	return hunks(d.script(), linesA, linesB, max(opts.Context, 0))
+}
+
+// Unified formats hunks as unified diff of documents named nameA and nameB
+func Unified(nameA string, nameB string, hunks []Hunk) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", nameA, nameB)
+
+	for _, hunk := range hunks {
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", unifiedRange(hunk.OldStart, hunk.OldLines), unifiedRange(hunk.NewStart, hunk.NewLines))
+		for _, line := range hunk.Lines {
+			switch line.Op {
+			case Delete:
+				sb.WriteByte('-')
+			case Insert:
+				sb.WriteByte('+')
+			default:
+				sb.WriteByte(' ')
+			}
+
+			sb.WriteString(line.Text)
+			sb.WriteByte('\n')
+		}
+	}
+
+	return sb.String()
+}
+
+func unifiedRange(start int, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// Splits the document into lines, the final newline doesn't start another line
+func split(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// edit is a line of the edit script with positions in both documents before it
+type edit struct {
+	op   Op
+	i, j int
+}
+
+// maxCost is the budget of a comparison, in steps through lines of the compared blocks
+// Myers runs in O((N+M)·D), so unrelated documents would take hours to compare. Like the
+// heuristic of GNU diff, blocks needing more edits than the rest of the budget affords are
+// replaced whole.
+const maxCost = 1 << 26
+
+// differ marks lines deleted from a and inserted into b
+type differ struct {
+	a, b              []int
+	deleted, inserted []bool
+
+	// budget is the remaining cost of the comparison
+	budget int
+}
+
+// Compares a[aLo:aHi] with b[bLo:bHi]
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	switch {
+	case aLo == aHi:
+		for j := bLo; j < bHi; j++ {
+			d.inserted[j] = true
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.deleted[i] = true
+		}
+	default:
+		size := aHi - aLo + bHi - bLo
+		x, y, edits, ok := bisect(d.a[aLo:aHi], d.b[bLo:bHi], d.budget/size)
+		d.budget = max(d.budget-(edits+1)*size, 0)
+		if !ok {
+			// Nothing in common, or too expensive to find out
+			for i := aLo; i < aHi; i++ {
+				d.deleted[i] = true
+			}
+
+			for j := bLo; j < bHi; j++ {
+				d.inserted[j] = true
+			}
+
+			return
+		}
+
+		d.compare(aLo, aLo+x, bLo, bLo+y)
+		d.compare(aLo+x, aHi, bLo+y, bHi)
+	}
+}
+
+// Finds the middle snake of the shortest edit script by running it from both ends
+// at once, and returns the point where the halves meet to split the comparison at
+// with the number of edits tried. Each edit takes up to a step through every line, so
+// the search gives up after limit edits.
+func bisect(a, b []int, limit int) (int, int, int, bool) {
+	n, m := len(a), len(b)
+	maxD := min((n+m+1)/2, limit)
+	offset := maxD + 1
+	length := 2*maxD + 3
+
+	forward := make([]int, length)
+	backward := make([]int, length)
+	for i := range forward {
+		forward[i] = -1
+		backward[i] = -1
+	}
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+
+	delta := n - m
+	// Paths overlap in the forward pass when delta is odd, in the backward one otherwise
+	front := delta%2 != 0
+
+	// Diagonals leaving the edit graph are trimmed from further passes
+	var fStart, fEnd, bStart, bEnd int
+	for d := 0; d < maxD; d++ {
+		for k := -d + fStart; k <= d-fEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case front:
+				other := offset + delta - k
+				if other >= 0 && other < length && backward[other] != -1 && x >= n-backward[other] {
+					return x, y, d, true
+				}
+			}
+		}
+
+		for k := -d + bStart; k <= d-bEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !front:
+				other := offset + delta - k
+				if other >= 0 && other < length && forward[other] != -1 {
+					fx := forward[other]
+					fy := fx - (other - offset)
+					if fx >= n-x {
+						return fx, fy, d, true
+					}
+				}
+			}
+		}
+	}
+
+	return 0, 0, maxD, false
+}
+
+// Returns the edit script with deletions ahead of insertions of the same change
+func (d *differ) script() []edit {
+	var script []edit
+	i, j := 0, 0
+	for i < len(d.a) || j < len(d.b) {
+		switch {
+		case i < len(d.a) && d.deleted[i]:
+			script = append(script, edit{op: Delete, i: i, j: j})
+			i++
+		case j < len(d.b) && d.inserted[j]:
+			script = append(script, edit{op: Insert, i: i, j: j})
+			j++
+		default:
+			script = append(script, edit{op: Equal, i: i, j: j})
+			i++
+			j++
+		}
+	}
+
+	return script
+}
+
+// Groups changes of the edit script into hunks, changes separated by at most
+// twice the context share a hunk
+func hunks(script []edit, a, b []string, context int) []Hunk {
+	var result []Hunk
+	for idx := 0; idx < len(script); {
+		if script[idx].op == Equal {
+			idx++
+			continue
+		}
+
+		start := max(idx-context, 0)
+		end := idx
+		for end < len(script) {
+			if script[end].op != Equal {
+				end++
+				continue
+			}
+
+			run := end
+			for run < len(script) && script[run].op == Equal {
+				run++
+			}
+
+			if run == len(script) || run-end > 2*context {
+				break
+			}
+
+			end = run
+		}
+		stop := min(end+context, len(script))
+
+		hunk := Hunk{OldStart: script[start].i, NewStart: script[start].j}
+		for _, e := range script[start:stop] {
+			switch e.op {
+			case Delete:
+				hunk.OldLines++
+				hunk.Lines = append(hunk.Lines, Line{Op: Delete, Text: a[e.i]})
+			case Insert:
+				hunk.NewLines++
+				hunk.Lines = append(hunk.Lines, Line{Op: Insert, Text: b[e.j]})
+			default:
+				hunk.OldLines++
+				hunk.NewLines++
+				hunk.Lines = append(hunk.Lines, Line{Op: Equal, Text: a[e.i]})
+			}
+		}
+
+		if hunk.OldLines > 0 {
+			hunk.OldStart++
+		}
+
+		if hunk.NewLines > 0 {
+			hunk.NewStart++
+		}
+
+		result = append(result, hunk)
+		idx = stop
+	}
+
+	return result
+}
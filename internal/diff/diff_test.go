@@ -0,0 +1,200 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Returns length of the longest common subsequence of lines
+func lcs(a, b []string) int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	return lengths[0][0]
+}
+
+func randomDocument(r *rand.Rand, lines int) string {
+	var sb strings.Builder
+	for range lines {
+		sb.WriteString(string(rune('a' + r.IntN(4))))
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+func TestCompare_Minimal(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+
+	for range 500 {
+		a, b := randomDocument(r, r.IntN(30)), randomDocument(r, r.IntN(30))
+		linesA, linesB := split(a), split(b)
+
+		hunks := Compare(a, b, Options{Context: 100})
+		if a == b {
+			require.Empty(t, hunks)
+			continue
+		}
+
+		require.Len(t, hunks, 1)
+
+		var old, new []string
+		changes := 0
+		for _, line := range hunks[0].Lines {
+			if line.Op != Insert {
+				old = append(old, line.Text)
+			}
+
+			if line.Op != Delete {
+				new = append(new, line.Text)
+			}
+
+			if line.Op != Equal {
+				changes++
+			}
+		}
+
+		require.Equal(t, linesA, old)
+		require.Equal(t, linesB, new)
+		require.Equal(t, len(linesA)+len(linesB)-2*lcs(linesA, linesB), changes)
+	}
+}
+
+func TestCompare_Hunks(t *testing.T) {
+	var a, b strings.Builder
+	for i := range 20 {
+		line := strings.Repeat("x", i+1) + "\n"
+		a.WriteString(line)
+		if i == 2 || i == 15 {
+			b.WriteString("changed\n")
+			continue
+		}
+
+		b.WriteString(line)
+	}
+
+	hunks := Compare(a.String(), b.String(), Options{Context: 3})
+	require.Len(t, hunks, 2)
+	require.Equal(t, Hunk{OldStart: 1, OldLines: 6, NewStart: 1, NewLines: 6}, Hunk{
+		OldStart: hunks[0].OldStart, OldLines: hunks[0].OldLines, NewStart: hunks[0].NewStart, NewLines: hunks[0].NewLines,
+	})
+	require.Equal(t, 13, hunks[1].OldStart)
+	require.Equal(t, 7, hunks[1].OldLines)
+
+	// Changes close to each other share a hunk
+	hunks = Compare(a.String(), b.String(), Options{Context: 7})
+	require.Len(t, hunks, 1)
+}
+
+// Returns the documents a hunk covering all lines turns into each other
+func apply(hunk Hunk) (string, string) {
+	var old, new strings.Builder
+	for _, line := range hunk.Lines {
+		if line.Op != Insert {
+			old.WriteString(line.Text + "\n")
+		}
+
+		if line.Op != Delete {
+			new.WriteString(line.Text + "\n")
+		}
+	}
+
+	return old.String(), new.String()
+}
+
+func TestCompare_Expensive(t *testing.T) {
+	// Unrelated documents take O(N·M) without the cost budget
+	var a, b strings.Builder
+	for i := range 20000 {
+		fmt.Fprintf(&a, "old %d\n", i)
+		fmt.Fprintf(&b, "new %d\n", i)
+	}
+
+	start := time.Now()
+	hunks := Compare(a.String(), b.String(), Options{})
+	require.Less(t, time.Since(start), 2*time.Second)
+
+	require.Len(t, hunks, 1)
+	require.Len(t, hunks[0].Lines, 40000)
+	old, new := apply(hunks[0])
+	require.Equal(t, a.String(), old)
+	require.Equal(t, b.String(), new)
+
+	// Documents exceeding the budget in the middle of the comparison still get a valid diff
+	r := rand.New(rand.NewPCG(3, 4))
+	c, d := randomDocument(r, 30000), randomDocument(r, 30000)
+	hunks = Compare(c, d, Options{Context: 1 << 20})
+	require.Len(t, hunks, 1)
+	old, new = apply(hunks[0])
+	require.Equal(t, c, old)
+	require.Equal(t, d, new)
+}
+
+func TestUnified(t *testing.T) {
+	hunks := Compare("one\ntwo\nthree\n", "one\n2\nthree\nfour\n", Options{Context: 1})
+	expected := `--- a
++++ b
+@@ -1,3 +1,4 @@
+ one
+-two
++2
+ three
++four
+`
+	require.Equal(t, expected, Unified("a", "b", hunks))
+	require.Empty(t, Unified("a", "b", nil))
+
+	hunks = Compare("", "new\n", Options{})
+	require.Equal(t, "--- a\n+++ b\n@@ -0,0 +1 @@\n+new\n", Unified("a", "b", hunks))
+}
+
+func TestCompare_Ignore(t *testing.T) {
+	a := "[    1.000000] \x1b[32mOK\x1b[0m usb 1-1: new device\n2025-01-01T10:00:00Z started\nJan  1 10:00:00 host sshd: ready\n"
+	b := "[    2.345678] \x1b[31mOK\x1b[0m usb 1-1: new device\n2025-02-03T11:22:33.123+01:00 started\nFeb 13 11:22:33 host sshd: ready\n"
+
+	require.NotEmpty(t, Compare(a, b, Options{}))
+	require.NotEmpty(t, Compare(a, b, Options{IgnoreTimestamps: true}))
+	require.Empty(t, Compare(a, b, Options{IgnoreTimestamps: true, IgnoreANSI: true}))
+
+	// Output keeps lines intact
+	hunks := Compare(a, b+"extra\n", Options{Context: 1, IgnoreTimestamps: true, IgnoreANSI: true})
+	require.Len(t, hunks, 1)
+	require.Equal(t, []Line{{Op: Equal, Text: "Jan  1 10:00:00 host sshd: ready"}, {Op: Insert, Text: "extra"}}, hunks[0].Lines)
+}
+
+func TestHunkJSON(t *testing.T) {
+	data, err := json.Marshal(Compare("a\n", "b\n", Options{}))
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"old_start": 1, "old_lines": 1, "new_start": 1, "new_lines": 1, "lines": [{"op": "delete", "text": "a"}, {"op": "insert", "text": "b"}]}]`, string(data))
+
+	var hunks []Hunk
+	require.NoError(t, json.Unmarshal(data, &hunks))
+	require.Equal(t, Insert, hunks[0].Lines[1].Op)
+}
+
+func BenchmarkCompare(b *testing.B) {
+	r := rand.New(rand.NewPCG(1, 2))
+	a, other := randomDocument(r, 10000), randomDocument(r, 10000)
+
+	for b.Loop() {
+		Compare(a, other, Options{Context: 3})
+	}
+}
@@ -0,0 +1,238 @@
+// Package highlight detects languages of documents and renders them highlighted as HTML.
+//
+// Languages are named by the first alias of their lexer, which mostly matches names
+// used by the web view, such as "bash" or "python". Terminal output is the "ansi"
+// language, which is rendered by its colors instead of a lexer.
+package highlight
+
+import (
+	"encoding/json"
+	"html"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/armbian/ansi-hastebin/internal/ansi"
+)
+
+// ANSI is the language of terminal output with escape sequences
+const ANSI = "ansi"
+
+// Style is the name of the style highlighted documents are rendered with, as in the web view
+const Style = "solarized-dark"
+
+// maxAnalysedLength limits the part of documents analysed for their language
+const maxAnalysedLength = 16 << 10
+
+// minAnalysisWeight is the confidence lexers must have in their analysis of a document
+// Weak analysis misleads on plain logs, which are the most common documents.
+const minAnalysisWeight = 0.5
+
+// patterns recognize languages by content which lexers don't analyse
+var patterns = []struct {
+	pattern  *regexp.Regexp
+	language string
+}{
+	{regexp.MustCompile(`^\s*<\?php`), "php"},
+	{regexp.MustCompile(`^\s*<\?xml`), "xml"},
+	{regexp.MustCompile(`(?i)^\s*(?:<!doctype html|<html)`), "html"},
+	{regexp.MustCompile(`(?m)^diff --git |^--- .*\n\+\+\+ .*\n@@ `), "diff"},
+	{regexp.MustCompile(`(?m)^package \w+$[\s\S]*^(?:func|import|type|var|const) `), "go"},
+	{regexp.MustCompile(`(?m)^#include\s*[<"]`), "c"},
+}
+
+// Language describes a language documents can be highlighted as
+type Language struct {
+	// Name identifies the language in metadata and URLs
+	Name  string `json:"name"`
+	Title string `json:"title"`
+
+	// Aliases and Extensions are other names and file extensions which identify the language
+	Aliases    []string `json:"aliases,omitempty"`
+	Extensions []string `json:"extensions,omitempty"`
+}
+
+// Returns the name of the lexer's language
+func name(lexer chroma.Lexer) string {
+	config := lexer.Config()
+	if len(config.Aliases) > 0 {
+		return strings.ToLower(config.Aliases[0])
+	}
+
+	return strings.ToLower(config.Name)
+}
+
+// Languages returns languages documents can be highlighted as, sorted by name
+var Languages = sync.OnceValue(func() []Language {
+	languages := []Language{{Name: ANSI, Title: "ANSI terminal output", Aliases: []string{"ans"}, Extensions: []string{"ans", "ansi"}}}
+
+	for _, lexer := range lexers.GlobalLexerRegistry.Lexers {
+		config := lexer.Config()
+		language := Language{Name: name(lexer), Title: config.Name}
+		for _, alias := range config.Aliases {
+			if alias = strings.ToLower(alias); alias != language.Name {
+				language.Aliases = append(language.Aliases, alias)
+			}
+		}
+
+		for _, filename := range config.Filenames {
+			if extension, ok := strings.CutPrefix(filename, "*."); ok && !strings.ContainsAny(extension, "*?[") {
+				language.Extensions = append(language.Extensions, extension)
+			}
+		}
+
+		languages = append(languages, language)
+	}
+
+	slices.SortFunc(languages, func(a, b Language) int { return strings.Compare(a.Name, b.Name) })
+	return languages
+})
+
+// Lookup returns the language identified by name, alias or file extension, empty if it's unknown
+func Lookup(identifier string) string {
+	if identifier == "" {
+		return ""
+	}
+
+	if identifier = strings.ToLower(identifier); identifier == ANSI || identifier == "ans" {
+		return ANSI
+	}
+
+	if lexer := lexers.Get(identifier); lexer != nil {
+		return name(lexer)
+	}
+
+	return ""
+}
+
+// Detect returns the language of the document by its filename, shebang and content, empty if it's unknown
+func Detect(filename string, content string) string {
+	if filename != "" {
+		if language := Lookup(strings.TrimPrefix(path.Ext(filename), ".")); language != "" {
+			return language
+		}
+
+		if lexer := lexers.Match(path.Base(filename)); lexer != nil {
+			return name(lexer)
+		}
+	}
+
+	if language := shebang(content); language != "" {
+		return language
+	}
+
+	if strings.Contains(content, "\x1b[") {
+		return ANSI
+	}
+
+	if len(content) <= maxAnalysedLength && json.Valid([]byte(content)) && strings.ContainsAny(content, "{[") {
+		return "json"
+	}
+
+	if len(content) > maxAnalysedLength {
+		content = content[:maxAnalysedLength]
+	}
+
+	for _, p := range patterns {
+		if p.pattern.MatchString(content) {
+			return p.language
+		}
+	}
+
+	return analyse(content)
+}
+
+// Returns the language lexers are the most confident about
+func analyse(content string) string {
+	var picked chroma.Lexer
+	highest := float32(minAnalysisWeight)
+	for _, lexer := range lexers.GlobalLexerRegistry.Lexers {
+		if analyser, ok := lexer.(chroma.Analyser); ok {
+			if weight := analyser.AnalyseText(content); weight >= highest {
+				picked, highest = lexer, weight
+			}
+		}
+	}
+
+	if picked == nil {
+		return ""
+	}
+
+	return name(picked)
+}
+
+// Returns the language of the interpreter in the shebang of the document
+func shebang(content string) string {
+	line, ok := strings.CutPrefix(content, "#!")
+	if !ok {
+		return ""
+	}
+
+	line, _, _ = strings.Cut(line, "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") {
+				interpreter = field
+				break
+			}
+		}
+	}
+
+	// Versioned interpreters, such as python3.12, are looked up without the version too
+	for _, candidate := range []string{interpreter, strings.TrimRight(interpreter, "0123456789.")} {
+		if language := Lookup(candidate); language != "" {
+			return language
+		}
+	}
+
+	return ""
+}
+
+// Colors returns the foreground and background colors of documents highlighted as the language
+func Colors(language string) (string, string) {
+	if language == ANSI || lexers.Get(language) == nil {
+		return ansi.DefaultForeground, ansi.DefaultBackground
+	}
+
+	entry := styles.Get(Style).Get(chroma.Background)
+	return entry.Colour.String(), entry.Background.String()
+}
+
+// HTML renders the document highlighted as the language, the text is escaped
+// Documents of unknown languages are only escaped.
+func HTML(language string, content string) (string, error) {
+	if language == ANSI {
+		return ansi.ToHTML(content), nil
+	}
+
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		return html.EscapeString(content), nil
+	}
+
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, content)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	formatter := chromahtml.New(chromahtml.PreventSurroundingPre(true))
+	if err := formatter.Format(&sb, styles.Get(Style), iterator); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,72 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect(t *testing.T) {
+	for _, tc := range []struct {
+		filename string
+		content  string
+		language string
+	}{
+		{"build.py", "print(1)\n", "python"},
+		{"Makefile", "all:\n\ttrue\n", "make"},
+		{"", "#!/bin/bash\necho hello\n", "bash"},
+		{"", "#!/usr/bin/env python3\nprint(1)\n", "python"},
+		{"", "\x1b[32mok\x1b[0m\n", ANSI},
+		{"", `{"board": "orangepi5", "release": "bookworm"}`, "json"},
+		{"", "package main\n\nfunc main() {}\n", "go"},
+		{"", "<?php echo 1;\n", "php"},
+		{"", "diff --git a/x b/x\n--- a/x\n+++ b/x\n@@ -1 +1 @@\n-a\n+b\n", "diff"},
+		{"", "[    0.000000] Booting Linux on physical CPU 0x0\n[    0.000000] Linux version 6.6.0\n", ""},
+		{"", "plain text\n", ""},
+	} {
+		require.Equal(t, tc.language, Detect(tc.filename, tc.content), "%q %q", tc.filename, tc.content)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	require.Equal(t, "python", Lookup("py"))
+	require.Equal(t, "python", Lookup("Python"))
+	require.Equal(t, "bash", Lookup("sh"))
+	require.Equal(t, ANSI, Lookup("ans"))
+	require.Empty(t, Lookup("no-such-language"))
+	require.Empty(t, Lookup(""))
+}
+
+func TestLanguages(t *testing.T) {
+	languages := Languages()
+	require.NotEmpty(t, languages)
+
+	var names []string
+	for _, language := range languages {
+		names = append(names, language.Name)
+	}
+	require.Contains(t, names, ANSI)
+	require.Contains(t, names, "python")
+	require.IsNonDecreasing(t, names)
+}
+
+func TestHTML(t *testing.T) {
+	content, err := HTML("go", "package main // <script>\n")
+	require.NoError(t, err)
+	require.Contains(t, content, "<span")
+	require.Contains(t, content, "&lt;script&gt;")
+	require.NotContains(t, content, "<pre")
+
+	content, err = HTML("", "<b>text</b>")
+	require.NoError(t, err)
+	require.Equal(t, "&lt;b&gt;text&lt;/b&gt;", content)
+
+	content, err = HTML(ANSI, "\x1b[31mred\x1b[0m")
+	require.NoError(t, err)
+	require.Equal(t, `<span style="color:#ff5252">red</span>`, content)
+
+	foreground, background := Colors("go")
+	require.True(t, strings.HasPrefix(foreground, "#"))
+	require.NotEqual(t, "#000", background)
+}
@@ -3,16 +3,18 @@ package server
 import (
 	"context"
 	"io"
+	"io/fs"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/armbian/ansi-hastebin/config"
 	"github.com/armbian/ansi-hastebin/handler"
-	"github.com/armbian/ansi-hastebin/internal/keygenerator"
-	"github.com/armbian/ansi-hastebin/internal/storage"
+	"github.com/armbian/ansi-hastebin/keygenerator"
 	"github.com/armbian/ansi-hastebin/static"
+	"github.com/armbian/ansi-hastebin/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/httprate"
@@ -26,6 +28,7 @@ type Server struct {
 	keyGenerator keygenerator.KeyGenerator
 	server       *http.Server
 	mux          *chi.Mux
+	handler      *handler.DocumentHandler
 }
 
 func NewServer(config *config.Config, storage storage.Storage, keyGenerator keygenerator.KeyGenerator) *Server {
@@ -59,7 +62,22 @@ func (s *Server) RegisterRoutes() {
 
 	// Register document handler
 	documentHandler := handler.NewDocumentHandler(s.config.KeyLength, s.config.MaxLength, s.storage, s.keyGenerator)
+	documentHandler.Policies = policies(s.config)
+	documentHandler.Prefixes = prefixes(s.config)
+	documentHandler.Expiration = expirationLimits(s.config.CustomExpiration)
+	documentHandler.StorageExpiration = time.Duration(s.config.Expiration) * time.Second
+	documentHandler.Attempts = handler.NewAttemptLimiter(s.config.PasswordAttempts.Limit, time.Duration(s.config.PasswordAttempts.Window)*time.Second)
+	documentHandler.SafeTerminalAgents = s.config.SafeTerminal.UserAgents
+	if s.config.SafeTerminal.Disable {
+		documentHandler.SafeTerminalAgents = nil
+	}
+	documentHandler.StreamIdleTimeout = time.Duration(s.config.Streaming.IdleTimeout) * time.Second
+	documentHandler.StreamMaxDuration = time.Duration(s.config.Streaming.MaxDuration) * time.Second
 	documentHandler.RegisterRoutes(s.mux)
+	s.handler = documentHandler
+
+	// Live pastes are sealed with data received so far when the server shuts down
+	s.server.RegisterOnShutdown(documentHandler.CloseStreams)
 
 	// Register health check
 	s.mux.Get("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -76,6 +94,12 @@ func (s *Server) RegisterRoutes() {
 			return
 		}
 
+		// Clients without JavaScript get documents rendered by the server instead of an empty web view
+		if path != "" && !strings.Contains(path, "/") && handler.NoScript(r) {
+			http.Redirect(w, r, "/html/"+path, http.StatusFound)
+			return
+		}
+
 		// If file does not exist, serve index.html
 		index, err := static.StaticFS.Open("index.html")
 		if err != nil {
@@ -89,6 +113,86 @@ func (s *Server) RegisterRoutes() {
 			return
 		}
 	})
+
+	// Routes are known only now, names they serve can't be chosen as keys
+	documentHandler.Vanity = vanityKeys(s.config, s.mux)
+}
+
+// Returns policy of keys chosen by uploaders, keys of static documents, static assets
+// and first segments of routes are reserved in addition to configured ones
+func vanityKeys(cfg *config.Config, routes chi.Routes) handler.VanityKeys {
+	vanity := handler.VanityKeys{
+		Tokens:    cfg.VanityKeys.Tokens,
+		MinLength: cfg.VanityKeys.MinLength,
+		MaxLength: cfg.VanityKeys.MaxLength,
+		Reserved:  slices.Clone(cfg.VanityKeys.Reserved),
+	}
+
+	for _, doc := range cfg.Documents {
+		vanity.Reserved = append(vanity.Reserved, doc.Key)
+	}
+
+	assets, err := fs.ReadDir(static.StaticFS, ".")
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to list static assets")
+	}
+
+	for _, asset := range assets {
+		vanity.Reserved = append(vanity.Reserved, asset.Name())
+	}
+
+	chi.Walk(routes, func(_ string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+		if segment != "" && segment != "*" && !strings.Contains(segment, "{") {
+			vanity.Reserved = append(vanity.Reserved, segment)
+		}
+
+		return nil
+	})
+
+	slices.Sort(vanity.Reserved)
+	vanity.Reserved = slices.Compact(vanity.Reserved)
+
+	return vanity
+}
+
+// Returns limits of expiration chosen by uploaders, configured in seconds
+func expirationLimits(cfg config.CustomExpirationConfig) handler.ExpirationLimits {
+	limits := handler.ExpirationLimits{
+		Min: time.Duration(cfg.Min) * time.Second,
+		Max: time.Duration(cfg.Max) * time.Second,
+	}
+
+	for _, allowed := range cfg.Allowed {
+		limits.Allowed = append(limits.Allowed, time.Duration(allowed)*time.Second)
+	}
+
+	return limits
+}
+
+// Returns policies of upload routes mapped to storage profiles
+func policies(cfg *config.Config) map[string]handler.Policy {
+	policies := map[string]handler.Policy{}
+	for route, name := range cfg.Routes {
+		profile := cfg.Profiles[name]
+		policies[route] = handler.Policy{
+			Prefix:     profile.Prefix,
+			MaxLength:  profile.MaxLength,
+			Expiration: time.Duration(profile.Expiration) * time.Second,
+		}
+	}
+
+	return policies
+}
+
+// Returns key prefixes of all storage profiles
+func prefixes(cfg *config.Config) []string {
+	var prefixes []string
+	for _, profile := range cfg.Profiles {
+		prefixes = append(prefixes, profile.Prefix)
+	}
+
+	return prefixes
 }
 
 func (s *Server) Start() {
@@ -102,11 +206,16 @@ func (s *Server) Start() {
 func (s *Server) Shutdown(ctx context.Context) {
 	log.Info().Msg("Gracefully shutting down server")
 
-	if err := s.storage.Close(); err != nil {
-		log.Error().Err(err).Msg("Failed to close storage")
-	}
-
 	if err := s.server.Shutdown(ctx); err != nil {
 		log.Error().Err(err).Msg("Failed to shutdown server")
 	}
+
+	// Handlers of live pastes may outlive the shutdown deadline, they are sealed before storage closes
+	if s.handler != nil {
+		s.handler.CloseStreams()
+	}
+
+	if err := s.storage.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to close storage")
+	}
 }
@@ -20,6 +20,12 @@ func randomFromStr(str string) byte {
 	return str[index.Int64()]
 }
 
+func init() {
+	Register("phonetic", func(struct{}) (KeyGenerator, error) {
+		return NewPhoneticKeyGenerator(), nil
+	})
+}
+
 func NewPhoneticKeyGenerator() *PhoneticKeyGenerator {
 	return &PhoneticKeyGenerator{}
 }
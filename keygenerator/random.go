@@ -10,6 +10,17 @@ type RandomKeyGenerator struct {
 	keyspace string
 }
 
+// RandomConfig is the configuration of "random" key generator
+type RandomConfig struct {
+	KeySpace string `yaml:"key_space"`
+}
+
+func init() {
+	Register("random", func(cfg RandomConfig) (KeyGenerator, error) {
+		return NewRandomKeyGenerator(cfg.KeySpace), nil
+	})
+}
+
 func NewRandomKeyGenerator(keyspace string) *RandomKeyGenerator {
 	if keyspace == "" {
 		keyspace = "abcdefghijklmnopqrstuvwxyz"
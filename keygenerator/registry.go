@@ -0,0 +1,65 @@
+package keygenerator
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Decoder decodes the YAML configuration of a key generator into v
+type Decoder func(v any) error
+
+type factory func(decode Decoder) (KeyGenerator, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]factory{}
+)
+
+// Register makes a key generator available under the given name
+// The configuration of the key generator is decoded into C before the factory is called.
+// Register panics if the name is already taken, it is meant to be called from init functions.
+func Register[C any](name string, fn func(cfg C) (KeyGenerator, error)) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic("keygenerator: key generator " + name + " registered twice")
+	}
+
+	registry[name] = func(decode Decoder) (KeyGenerator, error) {
+		var cfg C
+		if err := decode(&cfg); err != nil {
+			return nil, fmt.Errorf("failed to decode %s key generator configuration: %w", name, err)
+		}
+
+		return fn(cfg)
+	}
+}
+
+// New creates the key generator registered under the given name
+func New(name string, decode Decoder) (KeyGenerator, error) {
+	registryMu.RLock()
+	fn, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown key generator %q", name)
+	}
+
+	return fn(decode)
+}
+
+// Registered returns sorted names of all registered key generators
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
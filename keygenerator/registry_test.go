@@ -0,0 +1,55 @@
+package keygenerator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func yamlDecoder(t *testing.T, data string) Decoder {
+	var node yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(data), &node))
+
+	return func(v any) error {
+		return node.Decode(v)
+	}
+}
+
+func TestNew(t *testing.T) {
+	require.Equal(t, []string{"phonetic", "random"}, Registered())
+
+	kg, err := New("random", yamlDecoder(t, "key_space: ab"))
+	require.NoError(t, err)
+	require.Equal(t, "ab", kg.(*RandomKeyGenerator).keyspace)
+
+	kg, err = New("phonetic", yamlDecoder(t, "key_space: ab"))
+	require.NoError(t, err)
+	require.IsType(t, &PhoneticKeyGenerator{}, kg)
+
+	_, err = New("nonexistent", yamlDecoder(t, "{}"))
+	require.ErrorContains(t, err, "unknown key generator")
+}
+
+func TestRegister(t *testing.T) {
+	type constantConfig struct {
+		Key string `yaml:"constant_key"`
+	}
+
+	Register("constant", func(cfg constantConfig) (KeyGenerator, error) {
+		return constantKeyGenerator(cfg.Key), nil
+	})
+	require.Panics(t, func() {
+		Register("constant", func(cfg struct{}) (KeyGenerator, error) { return nil, nil })
+	})
+
+	kg, err := New("constant", yamlDecoder(t, "constant_key: fixed"))
+	require.NoError(t, err)
+	require.Equal(t, "fixed", kg.Generate(10))
+}
+
+type constantKeyGenerator string
+
+func (c constantKeyGenerator) Generate(int) string {
+	return string(c)
+}
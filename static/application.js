@@ -1,4 +1,4 @@
-/* global $, hljs, window, document */
+/* global $, hljs, window, document, EventSource */
 
 ///// represents a single document
 var haste_document = function () {
@@ -15,49 +15,87 @@ haste_document.prototype.htmlEscape = function (s) {
 };
 
 // Get this document from the server and lock it here
-haste_document.prototype.load = function (key, callback, lang) {
+haste_document.prototype.load = function (key, callback, lang, password) {
     console.log("Loading document key", key, "lang", lang);
     var _this = this;
     $.ajax('/documents/' + key, {
-        type: 'get', dataType: 'json', success: function (res) {
+        type: 'get', dataType: 'json', headers: password ? {'X-Password': password} : {}, success: function (res) {
             console.log("Loaded success document key", key, "lang", lang);
             _this.locked = true;
             _this.key = key;
             _this.data = res.data;
 
-            let final_language;
-            let highlighted;
-            var high;
-            if (lang === 'txt') {
-                console.log("Highlighting as text");
-                high = {value: _this.htmlEscape(res.data)};
-                final_language = high.language;
-                highlighted = high.value;
-            } else if (lang !== undefined && lang !== 'ans') {
-                console.log("Highlighting as", lang);
-                high = hljs.highlight(lang, res.data);
-                final_language = high.language;
-                highlighted = high.value;
-            } else {
-                // don't guess, use ANSI
-                console.log("Highlighting ANSI");
-                final_language = "ans"
-                highlighted = new Filter({}).toHtml(res.data);
-                console.log("ANSI highlighted!");
+            // Without an extension in the URL, use the language detected by the server
+            if (lang === undefined && res.language && res.language !== 'ansi') {
+                lang = haste.languages[res.language] || (hljs.getLanguage(res.language) ? res.language : undefined);
+            }
+            _this.show(key, res.data, lang, callback);
+
+            // Live documents are shown again as they grow, until they are sealed
+            if (res.live) {
+                _this.follow(key, password, lang, callback);
             }
-            //console.log("Language FINAL", final_language, "value", highlighted);
-            let lineCount = res.data.split('\n').length;
-            console.log("Line count", lineCount);
-            callback({
-                    value: highlighted, key: key, language: final_language || lang, lineCount: lineCount
+        }, error: function (res) {
+            // Documents protected by password are loaded again once the reader enters it
+            if (res.status === 401) {
+                var entered = window.prompt(password ? 'Wrong password, try again:' : 'This document is protected by password:');
+                if (entered) {
+                    _this.load(key, callback, lang, entered);
+                    return;
                 }
-            );
-        }, error: function () {
+            }
             callback(false);
         }
     });
 };
 
+// Highlight data of the document and pass it to the callback
+haste_document.prototype.show = function (key, data, lang, callback) {
+    var _this = this;
+    let final_language;
+    let highlighted;
+    var high;
+    if (lang === 'txt') {
+        console.log("Highlighting as text");
+        high = {value: _this.htmlEscape(data)};
+        final_language = high.language;
+        highlighted = high.value;
+    } else if (lang !== undefined && lang !== 'ans') {
+        console.log("Highlighting as", lang);
+        high = hljs.highlight(lang, data);
+        final_language = high.language;
+        highlighted = high.value;
+    } else {
+        // don't guess, use ANSI
+        console.log("Highlighting ANSI");
+        final_language = "ans"
+        highlighted = new Filter({}).toHtml(data);
+        console.log("ANSI highlighted!");
+    }
+    //console.log("Language FINAL", final_language, "value", highlighted);
+    let lineCount = data.split('\n').length;
+    console.log("Line count", lineCount);
+    callback({
+            value: highlighted, key: key, language: final_language || lang, lineCount: lineCount
+        }
+    );
+};
+
+// Follow a live document over Server-Sent Events, showing it again with every chunk
+haste_document.prototype.follow = function (key, password, lang, callback) {
+    var _this = this;
+    var data = '';
+    var source = new EventSource('/documents/' + key + '/follow' + (password ? '?password=' + encodeURIComponent(password) : ''));
+    source.addEventListener('chunk', function (e) {
+        data += JSON.parse(e.data);
+        _this.data = data;
+        _this.show(key, data, lang, callback);
+    });
+    source.addEventListener('end', function () {
+        source.close();
+    });
+};
+
 // Save this document to the server and lock it here
 haste_document.prototype.save = function (data, callback) {
     if (this.locked) {
@@ -198,6 +236,42 @@ haste.extensionMap = {
     swift: 'swift'
 };
 
+// Languages the server knows, by their names, aliases and extensions (GET /languages)
+// Values are names highlight.js knows them by, languages it can't highlight are left out.
+haste.languages = {};
+
+// Extension preferred for each language highlight.js knows, by its name
+haste.languageExtensions = {};
+
+// Load languages the server knows, the callback is called even when it fails,
+// then only extensionMap is used
+haste.prototype.loadLanguages = function (callback) {
+    $.ajax('/languages', {
+        type: 'get', dataType: 'json', success: function (languages) {
+            languages.forEach(function (language) {
+                var names = [language.name].concat(language.aliases || []);
+                var type = names.find(function (name) {
+                    return hljs.getLanguage(name);
+                });
+                if (type === undefined) {
+                    return;
+                }
+                names.concat(language.extensions || []).forEach(function (name) {
+                    if (!(name in haste.languages)) {
+                        haste.languages[name] = type;
+                    }
+                });
+                if (language.extensions && !(type in haste.languageExtensions)) {
+                    haste.languageExtensions[type] = language.extensions[0];
+                }
+            });
+            console.log("Loaded", languages.length, "languages");
+        }, complete: function () {
+            callback();
+        }
+    });
+};
+
 // Look up the extension preferred for a type
 // If not found, return the type itself - which we'll place as the extension
 haste.prototype.lookupExtensionByType = function (type) {
@@ -207,13 +281,16 @@ haste.prototype.lookupExtensionByType = function (type) {
             return key;
         }
     }
+    if (haste.languageExtensions[type]) {
+        return haste.languageExtensions[type];
+    }
     return type;
 };
 
 // Look up the type for a given extension
 // If not found, return the extension - which we'll attempt to use as the type
 haste.prototype.lookupTypeByExtension = function (ext) {
-    let result = haste.extensionMap[ext] || ext;
+    let result = ext in haste.extensionMap ? (haste.extensionMap[ext] || ext) : (haste.languages[ext] || ext);
     console.log("Found type", result, "for extension", ext);
     return result;
 };
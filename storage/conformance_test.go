@@ -0,0 +1,167 @@
+package storage_test
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/armbian/ansi-hastebin/storage/storagetest"
+)
+
+func TestFileStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, expiration time.Duration) storage.Storage {
+		return storage.NewFileStorage(t.TempDir(), expiration)
+	}, storagetest.Capabilities{})
+}
+
+func TestGitStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, expiration time.Duration) storage.Storage {
+		return storage.NewGitStorage(t.TempDir(), expiration)
+	}, storagetest.Capabilities{Expiration: true})
+}
+
+func TestShardedStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, expiration time.Duration) storage.Storage {
+		// Keys are random, so nodes implement the same interfaces and every key gets them tested
+		return storage.NewShardedStorage([]storage.ShardNode{
+			{Name: "first", Storage: storage.NewFileStorage(t.TempDir(), expiration)},
+			{Name: "second", Storage: storage.NewFileStorage(t.TempDir(), expiration)},
+		})
+	}, storagetest.Capabilities{})
+}
+
+func TestRedisStorageConformance(t *testing.T) {
+	host, port, cleanup := storage.SetupRedisContainer(t)
+	defer cleanup()
+
+	storagetest.Run(t, func(t *testing.T, expiration time.Duration) storage.Storage {
+		return storage.NewRedisStorage(host, port, "", "", expiration)
+	}, storagetest.Capabilities{Expiration: true, SlidingExpiration: true})
+}
+
+func TestMemcachedStorageConformance(t *testing.T) {
+	host, port, cleanup := storage.SetupMemcachedContainer(t)
+	defer cleanup()
+
+	storagetest.Run(t, func(t *testing.T, expiration time.Duration) storage.Storage {
+		return storage.NewMemcachedStorage(host, port, int(expiration/time.Second))
+	}, storagetest.Capabilities{
+		Expiration:        true,
+		SlidingExpiration: true,
+		// Memcached limits items to 1 MiB by default
+		MaxValueSize: 512 * 1024,
+	})
+}
+
+func TestMongoDBStorageConformance(t *testing.T) {
+	host, port, cleanup := storage.SetupMongoContainer(t)
+	defer cleanup()
+
+	storagetest.Run(t, func(t *testing.T, expiration time.Duration) storage.Storage {
+		return storage.NewMongoDBStorage(host, port, "", "", "testdb", expiration)
+	}, storagetest.Capabilities{Expiration: true, SlidingExpiration: true})
+}
+
+func TestPostgresStorageConformance(t *testing.T) {
+	host, port, cleanup := storage.SetupPostgresContainer(t)
+	defer cleanup()
+
+	storagetest.Run(t, func(t *testing.T, expiration time.Duration) storage.Storage {
+		return storage.NewPostgresStorage(host, port, "test", "test", "testdb", int(expiration/time.Second))
+	}, storagetest.Capabilities{Expiration: true, SlidingExpiration: true})
+}
+
+func TestMySQLStorageConformance(t *testing.T) {
+	host, port, cleanup := storage.SetupMySQLContainer(t)
+	defer cleanup()
+
+	storagetest.Run(t, func(t *testing.T, expiration time.Duration) storage.Storage {
+		return storage.NewMySQLStorage(host, port, "root", "", "testdb", expiration)
+	}, storagetest.Capabilities{Expiration: true, SlidingExpiration: true})
+}
+
+// The in-memory server runs without Docker, the container covers what it can't handle
+func TestMySQLMemoryStorageConformance(t *testing.T) {
+	host, port, cleanup := storage.SetupMySQLServer(t)
+	defer cleanup()
+
+	storagetest.Run(t, func(t *testing.T, expiration time.Duration) storage.Storage {
+		return &lockedStorage{MySQLStorage: storage.NewMySQLStorage(host, port, "root", "", "testdb", expiration)}
+	}, storagetest.Capabilities{Expiration: true, SlidingExpiration: true})
+}
+
+func TestS3StorageConformance(t *testing.T) {
+	host, port, cleanup := storage.SetupMinio(t)
+	defer cleanup()
+
+	storagetest.Run(t, func(t *testing.T, expiration time.Duration) storage.Storage {
+		return storage.NewS3Storage(storage.S3Options{
+			Endpoint:     "http://" + host + ":" + strconv.Itoa(port),
+			UsePathStyle: true,
+			Region:       storage.MinioRegion,
+			Bucket:       storage.MinioBucket,
+			AccessKey:    storage.MinioUser,
+			SecretKey:    storage.MinioPass,
+			Expiration:   expiration,
+		})
+	}, storagetest.Capabilities{Expiration: true, SlidingExpiration: true})
+}
+
+func TestGCSStorageConformance(t *testing.T) {
+	endpoint, cleanup := storage.SetupFakeGCS(t)
+	defer cleanup()
+
+	storagetest.Run(t, func(t *testing.T, expiration time.Duration) storage.Storage {
+		return storage.NewGCSStorage(endpoint, "", storage.GCSBucket, expiration)
+	}, storagetest.Capabilities{Expiration: true, SlidingExpiration: true})
+}
+
+func TestWebDAVStorageConformance(t *testing.T) {
+	server := httptest.NewServer(storage.NewWebDAVHandler())
+	defer server.Close()
+
+	storagetest.Run(t, func(t *testing.T, expiration time.Duration) storage.Storage {
+		return storage.NewWebDAVStorage(storage.WebDAVOptions{
+			Endpoint:   server.URL + "/pastes",
+			Username:   storage.WebDAVUser,
+			Password:   storage.WebDAVPass,
+			Expiration: expiration,
+		})
+	}, storagetest.Capabilities{Expiration: true, SlidingExpiration: true})
+}
+
+// lockedStorage serializes requests the in-memory test server can't handle concurrently. It
+// loses rows when sessions upsert the same key concurrently and reads miss rows being upserted,
+// and it doesn't lock rows, so views are taken one at a time. Other methods of the storage,
+// optional interfaces among them, are promoted.
+type lockedStorage struct {
+	*storage.MySQLStorage
+	mu sync.RWMutex
+}
+
+func (s *lockedStorage) Set(key string, value string, skip_expiration bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.MySQLStorage.Set(key, value, skip_expiration)
+}
+
+func (s *lockedStorage) SetEntry(entry storage.Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.MySQLStorage.SetEntry(entry)
+}
+
+func (s *lockedStorage) Consume(key string) (string, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.MySQLStorage.Consume(key)
+}
+
+func (s *lockedStorage) Get(key string, skip_expiration bool) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.MySQLStorage.Get(key, skip_expiration)
+}
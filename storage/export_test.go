@@ -0,0 +1,24 @@
+package storage
+
+// Test servers shared with the conformance tests in package storage_test
+var (
+	SetupRedisContainer     = setupRedisContainer
+	SetupMemcachedContainer = setupMemcachedContainer
+	SetupMongoContainer     = setupMongoContainer
+	SetupPostgresContainer  = setupTestContainer
+	SetupMinio              = setupMinio
+	SetupFakeGCS            = setupFakeGCS
+	SetupMySQLServer        = setupMySQLServer
+	SetupMySQLContainer     = setupMySQLContainer
+	NewWebDAVHandler        = newWebDAVHandler
+)
+
+const (
+	GCSBucket   = gcsBucket
+	WebDAVUser  = webdavUser
+	WebDAVPass  = webdavPass
+	MinioRegion = minioRegion
+	MinioBucket = minioBucket
+	MinioUser   = minioUser
+	MinioPass   = minioPass
+)
@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// metaFileSuffix is the suffix of sidecar files holding the original key of a document
+const metaFileSuffix = ".meta"
+
+// fileTempPattern is the pattern of temporary files documents are written to before being renamed
+const fileTempPattern = ".tmp-*"
+
+// fileLockStripes is the number of locks keys of file storage are spread over
+const fileLockStripes = 64
+
+type FileStorage struct {
+	path string
+
+	// locks guard documents and their sidecar files by hashes of their keys, so views are
+	// taken one at a time
+	locks [fileLockStripes]sync.Mutex
+}
+
+type fileMeta struct {
+	Key string `json:"key"`
+
+	// Views is the number of reads left, 0 means unlimited
+	Views int `json:"views,omitempty"`
+}
+
+var (
+	_ Storage      = (*FileStorage)(nil)
+	_ Iterator     = (*FileStorage)(nil)
+	_ EntrySetter  = (*FileStorage)(nil)
+	_ Deleter      = (*FileStorage)(nil)
+	_ RangeReader  = (*FileStorage)(nil)
+	_ Appender     = (*FileStorage)(nil)
+	_ ViewConsumer = (*FileStorage)(nil)
+)
+
+func md5Hex(input string) string {
+	sum := md5.Sum([]byte(input))
+	return hex.EncodeToString(sum[:])
+}
+
+// FileConfig is the configuration block of "file" and "git" storage
+type FileConfig struct {
+	FilePath string `yaml:"file_path"`
+}
+
+func init() {
+	Register("file", func(cfg FileConfig, opts Options) (Storage, error) {
+		return NewFileStorage(cfg.FilePath, opts.Expiration), nil
+	})
+}
+
+func NewFileStorage(path string, _ time.Duration) Storage {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		os.Mkdir(path, 0700)
+	}
+
+	return &FileStorage{path: path}
+}
+
+// Locks the document of the hashed key and returns the function unlocking it
+func (fs *FileStorage) lock(hash string) func() {
+	stripe, _ := strconv.ParseUint(hash[:4], 16, 16)
+	mu := &fs.locks[stripe%fileLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+func (fs *FileStorage) Set(key string, value string, skip_expiration bool) error {
+	return fs.set(key, value, 0)
+}
+
+func (fs *FileStorage) set(key string, value string, views int) error {
+	hash := md5Hex(key)
+	dst := filepath.Join(fs.path, hash)
+
+	// Write into a temporary file first, so readers never see a partially written document
+	file, err := os.CreateTemp(fs.path, fileTempPattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err = file.WriteString(value); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	defer fs.lock(hash)()
+
+	if err := os.Rename(file.Name(), dst); err != nil {
+		return err
+	}
+
+	// File names are hashed, so keep the original key next to the document
+	return writeFileMeta(dst, fileMeta{Key: key, Views: views})
+}
+
+// Writes the sidecar file of the document through a temporary file, so views are never read partially
+func writeFileMeta(dst string, meta fileMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(dst), fileTempPattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), dst+metaFileSuffix)
+}
+
+func (fs *FileStorage) Get(key string, skip_expiration bool) (string, error) {
+	dst := filepath.Join(fs.path, md5Hex(key))
+	file, err := os.ReadFile(dst)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	return string(file), nil
+}
+
+func (fs *FileStorage) GetRange(key string, offset int64, length int64) (string, error) {
+	file, err := os.Open(filepath.Join(fs.path, md5Hex(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var reader io.Reader = io.NewSectionReader(file, offset, math.MaxInt64-offset)
+	if length >= 0 {
+		reader = io.LimitReader(reader, length)
+	}
+
+	value, err := io.ReadAll(reader)
+	return string(value), err
+}
+
+// Append writes value at the end of the document, readers may see it partially written
+func (fs *FileStorage) Append(key string, value string) error {
+	file, err := os.OpenFile(filepath.Join(fs.path, md5Hex(key)), os.O_WRONLY|os.O_APPEND, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := file.WriteString(value); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Iterate walks all documents in the storage directory
+// Documents written before keys were recorded in sidecar files are skipped.
+func (fs *FileStorage) Iterate(fn func(entry Entry) error) error {
+	files, err := os.ReadDir(fs.path)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || strings.HasSuffix(file.Name(), metaFileSuffix) || strings.HasPrefix(file.Name(), ".tmp-") {
+			continue
+		}
+
+		dst := filepath.Join(fs.path, file.Name())
+
+		data, err := os.ReadFile(dst + metaFileSuffix)
+		if errors.Is(err, os.ErrNotExist) {
+			log.Warn().Str("file", dst).Msg("Skipping document without key metadata")
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		var meta fileMeta
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return err
+		}
+
+		value, err := os.ReadFile(dst)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(Entry{Key: meta.Key, Value: string(value), Views: meta.Views}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetEntry stores entry, file storage doesn't support expiration so it is ignored
+func (fs *FileStorage) SetEntry(entry Entry) error {
+	return fs.set(entry.Key, entry.Value, entry.Views)
+}
+
+// Consume takes a view of the document, views are kept in its sidecar file
+// The last view moves the document away by a rename, so only one reader takes it even
+// when several instances share the directory.
+func (fs *FileStorage) Consume(key string) (string, int, error) {
+	hash := md5Hex(key)
+	dst := filepath.Join(fs.path, hash)
+	defer fs.lock(hash)()
+
+	var meta fileMeta
+	data, err := os.ReadFile(dst + metaFileSuffix)
+	if err == nil {
+		err = json.Unmarshal(data, &meta)
+	}
+
+	// Documents without a sidecar file have no limit
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", 0, err
+	}
+
+	if meta.Views == 0 {
+		value, err := fs.Get(key, true)
+		return value, -1, err
+	}
+
+	if meta.Views > 1 {
+		value, err := fs.Get(key, true)
+		if err != nil {
+			return "", 0, err
+		}
+
+		meta.Views--
+		return value, meta.Views, writeFileMeta(dst, meta)
+	}
+
+	taken := filepath.Join(fs.path, strings.TrimSuffix(fileTempPattern, "*")+"consumed-"+hash)
+	if err := os.Rename(dst, taken); errors.Is(err, os.ErrNotExist) {
+		return "", 0, ErrNotFound
+	} else if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(taken)
+
+	value, err := os.ReadFile(taken)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := os.Remove(dst + metaFileSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", 0, err
+	}
+
+	return string(value), 0, nil
+}
+
+func (fs *FileStorage) Delete(key string) error {
+	hash := md5Hex(key)
+	dst := filepath.Join(fs.path, hash)
+	defer fs.lock(hash)()
+
+	for _, name := range []string{dst, dst + metaFileSuffix} {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (fs *FileStorage) Close() error {
+	return nil
+}
@@ -34,7 +34,7 @@ func TestFileStorage(t *testing.T) {
 	require.NoError(t, err)
 
 	_, err = store.Get("testKey2", false)
-	require.True(t, os.IsNotExist(err))
+	require.ErrorIs(t, err, ErrNotFound)
 
 	require.NoError(t, store.Close())
 }
@@ -57,3 +57,22 @@ func TestFileStorageSkipExpiration(t *testing.T) {
 
 	require.NoError(t, store.Close())
 }
+
+func TestFileStorageIterate(t *testing.T) {
+	dir, cleanup := setupTempDir(t)
+	t.Cleanup(cleanup)
+
+	store := NewFileStorage(dir, 0)
+	require.NoError(t, store.Set("firstKey", "firstValue", false))
+	require.NoError(t, store.(EntrySetter).SetEntry(Entry{Key: "secondKey", Value: "secondValue"}))
+
+	entries := map[string]string{}
+	err := store.(Iterator).Iterate(func(entry Entry) error {
+		entries[entry.Key] = entry.Value
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"firstKey": "firstValue", "secondKey": "secondValue"}, entries)
+
+	require.NoError(t, store.Close())
+}
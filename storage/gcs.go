@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// gcsExpiresAtKey is the object metadata key holding the expiration unix timestamp
+const gcsExpiresAtKey = "expires-at"
+
+// gcsTTLKey is the object metadata key holding TTL of objects stored with their own one in seconds
+const gcsTTLKey = "ttl"
+
+type GCSStorage struct {
+	client     *gcs.Client
+	bucket     *gcs.BucketHandle
+	expiration time.Duration
+}
+
+var (
+	_ Storage     = (*GCSStorage)(nil)
+	_ Iterator    = (*GCSStorage)(nil)
+	_ EntrySetter = (*GCSStorage)(nil)
+	_ Deleter     = (*GCSStorage)(nil)
+)
+
+// GCSConfig is the configuration block of "gcs" storage
+type GCSConfig struct {
+	Endpoint        string `yaml:"endpoint"`
+	CredentialsFile string `yaml:"credentials_file"`
+	Bucket          string `yaml:"bucket"`
+}
+
+func init() {
+	Register("gcs", func(cfg GCSConfig, opts Options) (Storage, error) {
+		return NewGCSStorage(cfg.Endpoint, cfg.CredentialsFile, cfg.Bucket, opts.Expiration), nil
+	})
+}
+
+// NewGCSStorage creates Google Cloud Storage backed storage
+// Empty endpoint means the default Google endpoint. When credentials file is empty,
+// application default credentials are used, unless a custom endpoint is set, in that
+// case requests are sent without authentication (e.g. for emulators).
+func NewGCSStorage(endpoint string, credentialsFile string, bucket string, expiration time.Duration) *GCSStorage {
+	ctx := context.Background()
+
+	var opts []option.ClientOption
+	if endpoint != "" {
+		// Emulators usually implement only the JSON API, so use it for reads too
+		opts = append(opts, option.WithEndpoint(endpoint), gcs.WithJSONReads())
+	}
+
+	if credentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(credentialsFile))
+	} else if endpoint != "" {
+		opts = append(opts, option.WithoutAuthentication())
+	}
+
+	client, err := gcs.NewClient(ctx, opts...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create GCS client")
+	}
+
+	// Check if connection is established and bucket exists
+	handle := client.Bucket(bucket)
+	if _, err := handle.Attrs(ctx); err != nil {
+		log.Fatal().Err(err).Str("bucket", bucket).Msg("Failed to access GCS bucket")
+	}
+
+	return &GCSStorage{client: client, bucket: handle, expiration: expiration}
+}
+
+func (s *GCSStorage) Set(key string, value string, skip_expiration bool) error {
+	var expiration time.Time
+	if !skip_expiration && s.expiration > 0 {
+		expiration = time.Now().Add(s.expiration)
+	}
+
+	return s.SetEntry(Entry{Key: key, Value: value, Expiration: expiration})
+}
+
+func (s *GCSStorage) Get(key string, skip_expiration bool) (string, error) {
+	ctx := context.Background() // TODO: Add timeout control
+
+	object := s.bucket.Object(key)
+	attrs, err := object.Attrs(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	expiration := gcsExpiration(attrs)
+	if !expiration.IsZero() && !expiration.After(time.Now()) {
+		if err := object.Delete(ctx); err != nil && !errors.Is(err, gcs.ErrObjectNotExist) {
+			return "", err
+		}
+
+		return "", ErrNotFound
+	}
+
+	reader, err := object.NewReader(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	value, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	// Update expiration
+	if ttl := entryTTL(gcsTTL(attrs), s.expiration); !skip_expiration && !expiration.IsZero() && ttl > 0 {
+		_, err := object.Update(ctx, gcs.ObjectAttrsToUpdate{
+			Metadata: map[string]string{
+				gcsExpiresAtKey: strconv.FormatInt(time.Now().Add(ttl).Unix(), 10),
+			},
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return string(value), nil
+}
+
+func (s *GCSStorage) Iterate(fn func(entry Entry) error) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	now := time.Now()
+	objects := s.bucket.Objects(ctx, nil)
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		expiration := gcsExpiration(attrs)
+		if !expiration.IsZero() && !expiration.After(now) {
+			continue
+		}
+
+		value, err := s.Get(attrs.Name, true)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := fn(Entry{Key: attrs.Name, Value: value, Expiration: expiration, TTL: gcsTTL(attrs)}); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *GCSStorage) SetEntry(entry Entry) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	writer := s.bucket.Object(entry.Key).NewWriter(ctx)
+	writer.ContentType = "text/plain; charset=UTF-8"
+	if !entry.Expiration.IsZero() {
+		writer.Metadata = map[string]string{
+			gcsExpiresAtKey: strconv.FormatInt(entry.Expiration.Unix(), 10),
+		}
+
+		if entry.TTL > 0 {
+			writer.Metadata[gcsTTLKey] = strconv.FormatInt(int64(entry.TTL/time.Second), 10)
+		}
+	}
+
+	if _, err := io.Copy(writer, bytes.NewReader([]byte(entry.Value))); err != nil {
+		writer.Close()
+		return err
+	}
+
+	return writer.Close()
+}
+
+func (s *GCSStorage) Delete(key string) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	if err := s.bucket.Object(key).Delete(ctx); err != nil && !errors.Is(err, gcs.ErrObjectNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *GCSStorage) Close() error {
+	return s.client.Close()
+}
+
+// Returns expiration stored in object metadata, zero time means no expiration
+func gcsExpiration(attrs *gcs.ObjectAttrs) time.Time {
+	value, ok := attrs.Metadata[gcsExpiresAtKey]
+	if !ok {
+		return time.Time{}
+	}
+
+	unix, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(unix, 0)
+}
+
+// Returns TTL stored in object metadata, 0 means the storage-wide expiration
+func gcsTTL(attrs *gcs.ObjectAttrs) time.Duration {
+	seconds, err := strconv.ParseInt(attrs.Metadata[gcsTTLKey], 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
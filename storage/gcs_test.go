@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/stretchr/testify/require"
+)
+
+const gcsBucket string = "test-bucket"
+
+func setupFakeGCS(t *testing.T) (string, func()) {
+	server, err := fakestorage.NewServerWithOptions(fakestorage.Options{
+		Scheme: "http",
+		Host:   "127.0.0.1",
+	})
+	require.NoError(t, err)
+
+	server.CreateBucketWithOpts(fakestorage.CreateBucketOpts{Name: gcsBucket})
+
+	return server.URL() + "/storage/v1/", server.Stop
+}
+
+func TestGCSStorage(t *testing.T) {
+	endpoint, cleanup := setupFakeGCS(t)
+	defer cleanup()
+
+	store := NewGCSStorage(endpoint, "", gcsBucket, 2*time.Second)
+
+	// Test Set
+	err := store.Set("testKey", "testValue", false)
+	require.NoError(t, err)
+
+	// Test Get
+	val, err := store.Get("testKey", false)
+	require.NoError(t, err)
+	require.Equal(t, "testValue", val)
+
+	// Test Get not existing key
+	val, err = store.Get("nonExistingKey", false)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Equal(t, "", val)
+
+	// Test expiration mechanism
+	time.Sleep(3 * time.Second)
+	val, err = store.Get("testKey", false)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Equal(t, "", val)
+
+	require.NoError(t, store.Close())
+}
+
+func TestGCSStorageSkipExpiration(t *testing.T) {
+	endpoint, cleanup := setupFakeGCS(t)
+	defer cleanup()
+
+	store := NewGCSStorage(endpoint, "", gcsBucket, time.Second)
+
+	err := store.Set("persistentKey", "persistentValue", true)
+	require.NoError(t, err)
+
+	time.Sleep(2 * time.Second)
+	val, err := store.Get("persistentKey", true)
+	require.NoError(t, err)
+	require.Equal(t, "persistentValue", val)
+
+	entries := map[string]string{}
+	err = store.Iterate(func(entry Entry) error {
+		entries[entry.Key] = entry.Value
+		require.True(t, entry.Expiration.IsZero())
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"persistentKey": "persistentValue"}, entries)
+
+	require.NoError(t, store.Close())
+}
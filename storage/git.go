@@ -0,0 +1,433 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/rs/zerolog/log"
+)
+
+// gitMetaSuffix is the suffix of sidecar files holding document expiration
+const gitMetaSuffix = ".meta"
+
+// GitStorage stores documents in a local bare git repository
+// Every change of a document is a separate commit, so the whole history is kept
+// and the repository can be replicated with "git push". Documents are stored as
+// "<xx>/<key>" where "xx" is derived from the key hash to keep trees small.
+// Expiration is checked on read but not refreshed, as that would need a commit for every view.
+type GitStorage struct {
+	mu         sync.Mutex
+	repo       *git.Repository
+	expiration time.Duration
+}
+
+type gitMeta struct {
+	// ExpiresAt is the expiration unix timestamp
+	ExpiresAt int64 `json:"expires_at"`
+
+	// TTL is the own lifetime of the document in seconds, kept for exports as expiration is never refreshed
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+var gitSignature = object.Signature{Name: "hastebin", Email: "hastebin@localhost"}
+
+var (
+	_ Storage     = (*GitStorage)(nil)
+	_ Iterator    = (*GitStorage)(nil)
+	_ EntrySetter = (*GitStorage)(nil)
+	_ Deleter     = (*GitStorage)(nil)
+)
+
+func init() {
+	Register("git", func(cfg FileConfig, opts Options) (Storage, error) {
+		return NewGitStorage(cfg.FilePath, opts.Expiration), nil
+	})
+}
+
+func NewGitStorage(path string, expiration time.Duration) *GitStorage {
+	repo, err := git.PlainOpen(path)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		repo, err = git.PlainInit(path, true)
+	}
+
+	if err != nil {
+		log.Fatal().Err(err).Str("path", path).Msg("Failed to open git repository")
+	}
+
+	return &GitStorage{repo: repo, expiration: expiration}
+}
+
+func (s *GitStorage) Set(key string, value string, skip_expiration bool) error {
+	var expiration time.Time
+	if !skip_expiration && s.expiration > 0 {
+		expiration = time.Now().Add(s.expiration)
+	}
+
+	return s.SetEntry(Entry{Key: key, Value: value, Expiration: expiration})
+}
+
+func (s *GitStorage) Get(key string, skip_expiration bool) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	root, _, err := s.head()
+	if err != nil {
+		return "", err
+	}
+
+	dir := gitDir(key)
+	tree, err := s.tree(root, dir)
+	if err != nil {
+		return "", err
+	}
+
+	expiration, _, err := s.readExpiration(tree, key)
+	if err != nil {
+		return "", err
+	}
+
+	if !expiration.IsZero() && !expiration.After(time.Now()) {
+		err := s.commit(dir, map[string]*plumbing.Hash{key: nil, key + gitMetaSuffix: nil}, "Expire "+key)
+		if err != nil {
+			return "", err
+		}
+
+		return "", ErrNotFound
+	}
+
+	value, err := s.read(tree, key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(value), nil
+}
+
+func (s *GitStorage) Iterate(fn func(entry Entry) error) error {
+	s.mu.Lock()
+	root, _, err := s.head()
+	s.mu.Unlock()
+
+	if err != nil || root == plumbing.ZeroHash {
+		return err
+	}
+
+	rootTree, err := object.GetTree(s.repo.Storer, root)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, dirEntry := range rootTree.Entries {
+		if dirEntry.Mode != filemode.Dir {
+			continue
+		}
+
+		tree, err := object.GetTree(s.repo.Storer, dirEntry.Hash)
+		if err != nil {
+			return err
+		}
+
+		for _, fileEntry := range tree.Entries {
+			if strings.HasSuffix(fileEntry.Name, gitMetaSuffix) {
+				continue
+			}
+
+			expiration, ttl, err := s.readExpiration(tree, fileEntry.Name)
+			if err != nil {
+				return err
+			}
+
+			if !expiration.IsZero() && !expiration.After(now) {
+				continue
+			}
+
+			value, err := s.read(tree, fileEntry.Name)
+			if err != nil {
+				return err
+			}
+
+			if err := fn(Entry{Key: fileEntry.Name, Value: string(value), Expiration: expiration, TTL: ttl}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *GitStorage) SetEntry(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, err := s.writeBlob([]byte(entry.Value))
+	if err != nil {
+		return err
+	}
+
+	changes := map[string]*plumbing.Hash{entry.Key: &value, entry.Key + gitMetaSuffix: nil}
+	if !entry.Expiration.IsZero() {
+		data, err := json.Marshal(gitMeta{ExpiresAt: entry.Expiration.Unix(), TTL: int64(entry.TTL / time.Second)})
+		if err != nil {
+			return err
+		}
+
+		meta, err := s.writeBlob(data)
+		if err != nil {
+			return err
+		}
+		changes[entry.Key+gitMetaSuffix] = &meta
+	}
+
+	return s.commit(gitDir(entry.Key), changes, "Update "+entry.Key)
+}
+
+func (s *GitStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	root, _, err := s.head()
+	if err != nil {
+		return err
+	}
+
+	dir := gitDir(key)
+	tree, err := s.tree(root, dir)
+	if err != nil {
+		return err
+	}
+
+	// Avoid empty commits for keys which don't exist
+	if _, err := tree.FindEntry(key); err != nil {
+		return nil
+	}
+
+	return s.commit(dir, map[string]*plumbing.Hash{key: nil, key + gitMetaSuffix: nil}, "Delete "+key)
+}
+
+func (s *GitStorage) Close() error {
+	return nil
+}
+
+// Returns directory of the key, derived from its hash to spread keys evenly
+func gitDir(key string) string {
+	return md5Hex(key)[:2]
+}
+
+// Returns root tree and reference of the current branch, zero hash is returned for empty repository
+func (s *GitStorage) head() (plumbing.Hash, *plumbing.Reference, error) {
+	head, err := s.repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+
+	branch := head.Name()
+	if head.Type() == plumbing.SymbolicReference {
+		branch = head.Target()
+	}
+
+	ref, err := s.repo.Storer.Reference(branch)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return plumbing.ZeroHash, plumbing.NewSymbolicReference(branch, branch), nil
+	} else if err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+
+	commit, err := object.GetCommit(s.repo.Storer, ref.Hash())
+	if err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+
+	return commit.TreeHash, ref, nil
+}
+
+// Returns the tree of directory dir inside root, empty tree is returned if it doesn't exist
+func (s *GitStorage) tree(root plumbing.Hash, dir string) (*object.Tree, error) {
+	if root == plumbing.ZeroHash {
+		return &object.Tree{}, nil
+	}
+
+	rootTree, err := object.GetTree(s.repo.Storer, root)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := rootTree.FindEntry(dir)
+	if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+		return &object.Tree{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return object.GetTree(s.repo.Storer, entry.Hash)
+}
+
+func (s *GitStorage) read(tree *object.Tree, name string) ([]byte, error) {
+	for _, entry := range tree.Entries {
+		if entry.Name != name {
+			continue
+		}
+
+		blob, err := object.GetBlob(s.repo.Storer, entry.Hash)
+		if err != nil {
+			return nil, err
+		}
+
+		reader, err := blob.Reader()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		return io.ReadAll(reader)
+	}
+
+	return nil, ErrNotFound
+}
+
+// Reads expiration and TTL from the sidecar file, documents without one never expire
+func (s *GitStorage) readExpiration(tree *object.Tree, key string) (time.Time, time.Duration, error) {
+	data, err := s.read(tree, key+gitMetaSuffix)
+	if errors.Is(err, ErrNotFound) {
+		return time.Time{}, 0, nil
+	} else if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	var meta gitMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return time.Time{}, 0, err
+	}
+
+	return time.Unix(meta.ExpiresAt, 0), time.Duration(meta.TTL) * time.Second, nil
+}
+
+func (s *GitStorage) writeBlob(data []byte) (plumbing.Hash, error) {
+	obj := s.repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return s.repo.Storer.SetEncodedObject(obj)
+}
+
+func (s *GitStorage) writeTree(entries []object.TreeEntry) (plumbing.Hash, error) {
+	// Git orders entries by name, directories are compared as if they had a trailing slash
+	sortName := func(entry object.TreeEntry) string {
+		if entry.Mode == filemode.Dir {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return sortName(entries[i]) < sortName(entries[j])
+	})
+
+	obj := s.repo.Storer.NewEncodedObject()
+	if err := (&object.Tree{Entries: entries}).Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return s.repo.Storer.SetEncodedObject(obj)
+}
+
+// Replaces entries of dir with the changes and commits the result
+// Nil hash in changes removes the entry.
+func (s *GitStorage) commit(dir string, changes map[string]*plumbing.Hash, message string) error {
+	root, ref, err := s.head()
+	if err != nil {
+		return err
+	}
+
+	tree, err := s.tree(root, dir)
+	if err != nil {
+		return err
+	}
+
+	var files []object.TreeEntry
+	for _, entry := range tree.Entries {
+		if _, ok := changes[entry.Name]; !ok {
+			files = append(files, entry)
+		}
+	}
+
+	for name, hash := range changes {
+		if hash != nil {
+			files = append(files, object.TreeEntry{Name: name, Mode: filemode.Regular, Hash: *hash})
+		}
+	}
+
+	var dirs []object.TreeEntry
+	if root != plumbing.ZeroHash {
+		rootTree, err := object.GetTree(s.repo.Storer, root)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range rootTree.Entries {
+			if entry.Name != dir {
+				dirs = append(dirs, entry)
+			}
+		}
+	}
+
+	if len(files) > 0 {
+		dirHash, err := s.writeTree(files)
+		if err != nil {
+			return err
+		}
+		dirs = append(dirs, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: dirHash})
+	}
+
+	rootHash, err := s.writeTree(dirs)
+	if err != nil {
+		return err
+	}
+
+	signature := gitSignature
+	signature.When = time.Now()
+
+	commit := &object.Commit{
+		Author:    signature,
+		Committer: signature,
+		Message:   message,
+		TreeHash:  rootHash,
+	}
+
+	if ref.Type() == plumbing.HashReference {
+		commit.ParentHashes = []plumbing.Hash{ref.Hash()}
+	}
+
+	obj := s.repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return err
+	}
+
+	commitHash, err := s.repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.Storer.SetReference(plumbing.NewHashReference(ref.Name(), commitHash))
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitStorage(t *testing.T) {
+	dir := t.TempDir()
+	store := NewGitStorage(dir, 2*time.Second)
+
+	// Test Set
+	err := store.Set("testKey", "testValue", false)
+	require.NoError(t, err)
+
+	// Test Get
+	val, err := store.Get("testKey", false)
+	require.NoError(t, err)
+	require.Equal(t, "testValue", val)
+
+	// Test Get not existing key
+	val, err = store.Get("nonExistingKey", false)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Empty(t, val)
+
+	// Test expiration mechanism
+	time.Sleep(3 * time.Second)
+	val, err = store.Get("testKey", false)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Empty(t, val)
+
+	require.NoError(t, store.Close())
+}
+
+func TestGitStorageHistory(t *testing.T) {
+	dir := t.TempDir()
+	store := NewGitStorage(dir, 0)
+
+	require.NoError(t, store.Set("testKey", "first", true))
+	require.NoError(t, store.Set("otherKey", "other", true))
+	require.NoError(t, store.Set("testKey", "second", true))
+	require.NoError(t, store.Close())
+
+	// Reopen existing repository
+	store = NewGitStorage(dir, 0)
+
+	val, err := store.Get("testKey", true)
+	require.NoError(t, err)
+	require.Equal(t, "second", val)
+
+	val, err = store.Get("otherKey", true)
+	require.NoError(t, err)
+	require.Equal(t, "other", val)
+
+	entries := map[string]string{}
+	err = store.Iterate(func(entry Entry) error {
+		entries[entry.Key] = entry.Value
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"testKey": "second", "otherKey": "other"}, entries)
+
+	// Every update is a separate commit
+	repo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+
+	commits, err := repo.Log(&git.LogOptions{})
+	require.NoError(t, err)
+
+	var messages []string
+	require.NoError(t, commits.ForEach(func(c *object.Commit) error {
+		messages = append(messages, c.Message)
+		return nil
+	}))
+	require.Equal(t, []string{"Update testKey", "Update otherKey", "Update testKey"}, messages)
+
+	require.NoError(t, store.Close())
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/rs/zerolog/log"
+)
+
+// memcachedExpiresFlag marks items stored with expiration
+// Memcached doesn't report expiration of items, so the flag tells which ones to refresh on read.
+// Items stored with their own TTL keep it in seconds in the remaining bits of flags.
+const memcachedExpiresFlag = 1
+
+// memcachedMaxRelativeExpiration is the longest expiration memcached accepts in seconds,
+// longer ones must be passed as unix timestamps
+const memcachedMaxRelativeExpiration = 30 * 24 * 60 * 60
+
+type MemcachedStorage struct {
+	client     *memcache.Client
+	expiration int
+}
+
+func init() {
+	Register("memcached", func(cfg ServerConfig, opts Options) (Storage, error) {
+		return NewMemcachedStorage(cfg.Host, cfg.Port, int(opts.Expiration/time.Second)), nil
+	})
+}
+
+func NewMemcachedStorage(host string, port int, expiration int) *MemcachedStorage {
+	client := memcache.New(host + ":" + strconv.Itoa(port))
+
+	// Check if connection is established
+	if err := client.Ping(); err != nil {
+		log.Error().Err(err).Msg("Failed to connect to Memcached")
+	}
+
+	return &MemcachedStorage{client: client, expiration: expiration}
+}
+
+var (
+	_ Storage     = (*MemcachedStorage)(nil)
+	_ EntrySetter = (*MemcachedStorage)(nil)
+	_ Deleter     = (*MemcachedStorage)(nil)
+)
+
+func (s *MemcachedStorage) Set(key string, value string, skip_expiration bool) error {
+	item := &memcache.Item{
+		Key:   key,
+		Value: []byte(value),
+	}
+	if !skip_expiration && s.expiration > 0 {
+		item.Expiration = memcachedExpiration(s.expiration)
+		item.Flags = memcachedExpiresFlag
+	}
+	return s.client.Set(item)
+}
+
+func (s *MemcachedStorage) Get(key string, skip_expiration bool) (string, error) {
+	item, err := s.client.Get(key)
+	if err == memcache.ErrCacheMiss {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	if !skip_expiration && item.Flags&memcachedExpiresFlag != 0 {
+		if ttl := entryTTL(time.Duration(item.Flags>>1)*time.Second, time.Duration(s.expiration)*time.Second); ttl > 0 {
+			s.client.Touch(key, memcachedExpiration(int(ttl/time.Second)))
+		}
+	}
+
+	return string(item.Value), nil
+}
+
+// SetEntry stores entry using absolute expiration time
+// Memcached is not able to enumerate its keys, so it only supports being an import target.
+func (s *MemcachedStorage) SetEntry(entry Entry) error {
+	item := &memcache.Item{
+		Key:   entry.Key,
+		Value: []byte(entry.Value),
+	}
+
+	if !entry.Expiration.IsZero() {
+		if !entry.Expiration.After(time.Now()) {
+			return nil
+		}
+
+		// Memcached treats expiration values above 30 days as unix timestamps
+		item.Expiration = int32(entry.Expiration.Unix())
+		item.Flags = memcachedExpiresFlag | uint32(entry.TTL/time.Second)<<1
+	}
+
+	return s.client.Set(item)
+}
+
+func (s *MemcachedStorage) Delete(key string) error {
+	if err := s.client.Delete(key); err != nil && err != memcache.ErrCacheMiss {
+		return err
+	}
+
+	return nil
+}
+
+func (s *MemcachedStorage) Close() error {
+	return s.client.Close()
+}
+
+// Returns expiration of an item living for the given number of seconds
+func memcachedExpiration(seconds int) int32 {
+	if seconds > memcachedMaxRelativeExpiration {
+		return int32(time.Now().Unix()) + int32(seconds)
+	}
+
+	return int32(seconds)
+}
@@ -6,7 +6,6 @@ import (
 	"testing"
 	"time"
 
-	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -64,7 +63,7 @@ func TestMemcachedStorage(t *testing.T) {
 	require.NoError(t, err) // Should still exist due to refresh
 
 	_, err = store.Get("testKey2", false)
-	require.ErrorIs(t, memcache.ErrCacheMiss, err) // Should not exist
+	require.ErrorIs(t, err, ErrNotFound) // Should not exist
 
 	require.NoError(t, store.Close())
 }
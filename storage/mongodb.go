@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type MongoDBStorage struct {
+	db         *mongo.Database
+	collection *mongo.Collection
+	expiration time.Duration
+}
+
+type item struct {
+	ObjectID   any       `json:"_id,omitempty" bson:"_id,omitempty"`
+	Key        string    `json:"key" bson:"key"`
+	Value      []byte    `json:"value" bson:"value"`
+	Expiration time.Time `json:"expiration,omitempty" bson:"expiration,omitempty"`
+
+	// TTL is the own lifetime of the item in seconds, 0 means the storage-wide expiration
+	TTL int64 `json:"ttl,omitempty" bson:"ttl,omitempty"`
+
+	// Views is the number of reads left of items stored with a limit, nil means unlimited
+	Views *int64 `json:"views,omitempty" bson:"views,omitempty"`
+}
+
+var (
+	_ Storage      = (*MongoDBStorage)(nil)
+	_ Iterator     = (*MongoDBStorage)(nil)
+	_ EntrySetter  = (*MongoDBStorage)(nil)
+	_ Deleter      = (*MongoDBStorage)(nil)
+	_ ViewConsumer = (*MongoDBStorage)(nil)
+)
+
+func init() {
+	Register("mongodb", func(cfg ServerConfig, opts Options) (Storage, error) {
+		return NewMongoDBStorage(cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.Database, opts.Expiration), nil
+	})
+}
+
+func NewMongoDBStorage(host string, port int, username string, password string, database string, expiration time.Duration) *MongoDBStorage {
+	ctx := context.Background()
+
+	dsn := "mongodb://"
+	if username != "" {
+		dsn += url.QueryEscape(username)
+	}
+
+	if password != "" {
+		dsn += ":" + url.QueryEscape(password)
+	}
+
+	if username != "" || password != "" {
+		dsn += "@"
+	}
+
+	dsn += host + ":" + strconv.Itoa(port)
+
+	client, err := mongo.Connect(options.Client().ApplyURI(dsn))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to MongoDB")
+	}
+
+	// Check if connection is established
+	if err := client.Ping(ctx, nil); err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to MongoDB")
+	}
+
+	db := client.Database(database)
+
+	command := bson.M{"create": "entries"}
+	var result bson.M
+	if err := db.RunCommand(context.Background(), command).Decode(&result); err != nil {
+		panic(err)
+	}
+
+	// Create collection if not exists
+	collection := db.Collection("entries")
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.M{"expiration": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+
+	if _, err := collection.Indexes().CreateOne(ctx, indexModel); err != nil {
+		panic(err)
+	}
+
+	keyIndexModel := mongo.IndexModel{
+		Keys:    bson.M{"key": 1},
+		Options: options.Index().SetUnique(true),
+	}
+
+	if _, err := collection.Indexes().CreateOne(ctx, keyIndexModel); err != nil {
+		panic(err)
+	}
+
+	return &MongoDBStorage{db: db, collection: collection, expiration: expiration}
+}
+
+func (s *MongoDBStorage) Set(key string, value string, skip_expiration bool) error {
+	var expiration time.Time
+	if !skip_expiration && s.expiration > 0 {
+		expiration = time.Now().Add(s.expiration)
+	}
+
+	// Replace existing item or insert a new one
+	return s.SetEntry(Entry{Key: key, Value: value, Expiration: expiration})
+}
+
+func (s *MongoDBStorage) Get(key string, skip_expiration bool) (string, error) {
+	ctx := context.Background()
+
+	// Find item
+	filter := bson.M{"key": key}
+	var i item
+	if err := s.collection.FindOne(ctx, filter).Decode(&i); errors.Is(err, mongo.ErrNoDocuments) {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	if !i.Expiration.IsZero() && i.Expiration.Unix() <= time.Now().Unix() {
+		_, err := s.collection.DeleteOne(ctx, filter)
+		if err != nil {
+			return "", err
+		}
+
+		return "", ErrNotFound
+	}
+
+	// Update expiration, items stored without one must stay persistent
+	ttl := entryTTL(time.Duration(i.TTL)*time.Second, s.expiration)
+	if !skip_expiration && !i.Expiration.IsZero() && ttl > 0 {
+		i.Expiration = time.Now().Add(ttl)
+		update := bson.M{"$set": bson.M{"expiration": i.Expiration}}
+		if _, err := s.collection.UpdateOne(ctx, filter, update); err != nil {
+			return "", err
+		}
+	}
+
+	return string(i.Value), nil
+}
+
+func (s *MongoDBStorage) Iterate(fn func(entry Entry) error) error {
+	ctx := context.Background()
+
+	cursor, err := s.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	now := time.Now()
+	for cursor.Next(ctx) {
+		var i item
+		if err := cursor.Decode(&i); err != nil {
+			return err
+		}
+
+		// Skip items which are expired but not yet removed by TTL monitor
+		if !i.Expiration.IsZero() && i.Expiration.Before(now) {
+			continue
+		}
+
+		entry := Entry{Key: i.Key, Value: string(i.Value), Expiration: i.Expiration, TTL: time.Duration(i.TTL) * time.Second}
+		if i.Views != nil {
+			// Skip items which have no views left but are not yet removed
+			if *i.Views <= 0 {
+				continue
+			}
+
+			entry.Views = int(*i.Views)
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+func (s *MongoDBStorage) SetEntry(entry Entry) error {
+	ctx := context.Background()
+
+	i := item{
+		Key:        entry.Key,
+		Value:      []byte(entry.Value),
+		Expiration: entry.Expiration,
+		TTL:        int64(entry.TTL / time.Second),
+	}
+
+	if entry.Views > 0 {
+		views := int64(entry.Views)
+		i.Views = &views
+	}
+
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"key": entry.Key}, i, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoDBStorage) Delete(key string) error {
+	ctx := context.Background()
+
+	_, err := s.collection.DeleteOne(ctx, bson.M{"key": key})
+	return err
+}
+
+func (s *MongoDBStorage) Consume(key string) (string, int, error) {
+	ctx := context.Background()
+
+	// Take one view, the update is atomic so concurrent readers never take the same one
+	var i item
+	filter := bson.M{"key": key, "views": bson.M{"$gt": 0}}
+	update := bson.M{"$inc": bson.M{"views": -1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&i)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// Either the item has no limit, or it doesn't exist or has no views left
+		filter := bson.M{"key": key, "views": bson.M{"$exists": false}}
+		if err := s.collection.FindOne(ctx, filter).Decode(&i); errors.Is(err, mongo.ErrNoDocuments) {
+			return "", 0, ErrNotFound
+		} else if err != nil {
+			return "", 0, err
+		}
+	} else if err != nil {
+		return "", 0, err
+	}
+
+	if !i.Expiration.IsZero() && i.Expiration.Unix() <= time.Now().Unix() {
+		return "", 0, ErrNotFound
+	}
+
+	if i.Views == nil {
+		return string(i.Value), -1, nil
+	}
+
+	// No reader can take a view of the item anymore, so it is removed after the update
+	if *i.Views == 0 {
+		if _, err := s.collection.DeleteOne(ctx, bson.M{"_id": i.ObjectID}); err != nil {
+			return "", 0, err
+		}
+	}
+
+	return string(i.Value), int(*i.Views), nil
+}
+
+func (s *MongoDBStorage) Close() error {
+	return s.db.Client().Disconnect(context.Background())
+}
@@ -73,7 +73,7 @@ func TestMongoDBStorage(t *testing.T) {
 	// Test key not existing
 	val, err = store.Get("testKey2", false)
 	require.Equal(t, "", val)
-	require.ErrorIs(t, mongo.ErrNoDocuments, err)
+	require.ErrorIs(t, err, ErrNotFound)
 
 	require.NoError(t, store.Close())
 }
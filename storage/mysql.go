@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/rs/zerolog/log"
+)
+
+const mysqlCreateTableQuery = "CREATE TABLE IF NOT EXISTS entries (id BIGINT AUTO_INCREMENT PRIMARY KEY, `key` VARCHAR(255) NOT NULL UNIQUE, value LONGBLOB, expiration BIGINT, ttl BIGINT NOT NULL DEFAULT 0, views BIGINT)"
+const mysqlSetQuery = "INSERT INTO entries (`key`, value, expiration, ttl, views) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE value = VALUES(value), expiration = VALUES(expiration), ttl = VALUES(ttl), views = VALUES(views)"
+const mysqlGetQuery = "SELECT id, value, expiration, ttl FROM entries WHERE `key` = ?"
+const mysqlDeleteQuery = "DELETE FROM entries WHERE id = ?"
+const mysqlDeleteByKeyQuery = "DELETE FROM entries WHERE `key` = ?"
+const mysqlUpdateQuery = "UPDATE entries SET expiration = ? WHERE id = ?"
+const mysqlIterateQuery = "SELECT `key`, value, expiration, ttl, views FROM entries WHERE (expiration = 0 OR expiration >= ?) AND (views IS NULL OR views > 0)"
+
+// The row stays locked until views are taken, MySQL has no UPDATE ... RETURNING
+const mysqlConsumeQuery = "SELECT id, value, views FROM entries WHERE `key` = ? AND (expiration = 0 OR expiration >= ?) FOR UPDATE"
+const mysqlUpdateViewsQuery = "UPDATE entries SET views = ? WHERE id = ?"
+
+// TTL of entries stored with their own one in seconds, 0 means the storage-wide expiration
+// MySQL has no ADD COLUMN IF NOT EXISTS, so the column is looked up first.
+const mysqlHasTTLColumnQuery = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'entries' AND column_name = 'ttl'"
+const mysqlAddTTLColumnQuery = "ALTER TABLE entries ADD COLUMN ttl BIGINT NOT NULL DEFAULT 0"
+
+// Views left of entries stored with a limit, NULL means unlimited
+const mysqlHasViewsColumnQuery = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'entries' AND column_name = 'views'"
+const mysqlAddViewsColumnQuery = "ALTER TABLE entries ADD COLUMN views BIGINT"
+
+type MySQLStorage struct {
+	db         *sql.DB
+	expiration time.Duration
+}
+
+var (
+	_ Storage      = (*MySQLStorage)(nil)
+	_ Iterator     = (*MySQLStorage)(nil)
+	_ EntrySetter  = (*MySQLStorage)(nil)
+	_ Deleter      = (*MySQLStorage)(nil)
+	_ ViewConsumer = (*MySQLStorage)(nil)
+)
+
+func init() {
+	Register("mysql", func(cfg ServerConfig, opts Options) (Storage, error) {
+		return NewMySQLStorage(cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.Database, opts.Expiration), nil
+	})
+}
+
+// NewMySQLStorage creates MySQL or MariaDB backed storage
+func NewMySQLStorage(host string, port int, username string, password string, database string, expiration time.Duration) *MySQLStorage {
+	cfg := mysql.NewConfig()
+	cfg.Net = "tcp"
+	cfg.Addr = host + ":" + strconv.Itoa(port)
+	cfg.User = username
+	cfg.Passwd = password
+	cfg.DBName = database
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to MySQL")
+	}
+
+	// Check if connection is established
+	if err := db.Ping(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to MySQL")
+	}
+
+	// Create table if not exists
+	if _, err := db.Exec(mysqlCreateTableQuery); err != nil {
+		log.Fatal().Err(err).Msg("Failed to create table")
+	}
+
+	if err := mysqlAddColumn(db, mysqlHasTTLColumnQuery, mysqlAddTTLColumnQuery); err != nil {
+		log.Fatal().Err(err).Msg("Failed to migrate table")
+	}
+
+	if err := mysqlAddColumn(db, mysqlHasViewsColumnQuery, mysqlAddViewsColumnQuery); err != nil {
+		log.Fatal().Err(err).Msg("Failed to migrate table")
+	}
+
+	return &MySQLStorage{db: db, expiration: expiration}
+}
+
+func (s *MySQLStorage) Set(key string, value string, skip_expiration bool) error {
+	var expiration time.Time
+	if !skip_expiration && s.expiration > 0 {
+		expiration = time.Now().Add(s.expiration)
+	}
+
+	return s.SetEntry(Entry{Key: key, Value: value, Expiration: expiration})
+}
+
+func (s *MySQLStorage) Get(key string, skip_expiration bool) (string, error) {
+	ctx := context.Background() // TODO: Add timeout control
+
+	var id int64
+	var value []byte
+	var expiration int64
+	var ttl int64
+
+	err := s.db.QueryRowContext(ctx, mysqlGetQuery, key).Scan(&id, &value, &expiration, &ttl)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	// Delete if expired
+	if expiration != 0 && time.Now().Unix() > expiration {
+		if _, err := s.db.ExecContext(ctx, mysqlDeleteQuery, id); err != nil {
+			return "", err
+		}
+		return "", ErrNotFound
+	}
+
+	// Update expiration
+	refresh := entryTTL(time.Duration(ttl)*time.Second, s.expiration)
+	if !skip_expiration && expiration != 0 && refresh > 0 {
+		if _, err := s.db.ExecContext(ctx, mysqlUpdateQuery, time.Now().Add(refresh).Unix(), id); err != nil {
+			return "", err
+		}
+	}
+
+	return string(value), nil
+}
+
+func (s *MySQLStorage) Iterate(fn func(entry Entry) error) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	rows, err := s.db.QueryContext(ctx, mysqlIterateQuery, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var value []byte
+		var expiration int64
+		var ttl int64
+		var views sql.NullInt64
+
+		if err := rows.Scan(&key, &value, &expiration, &ttl, &views); err != nil {
+			return err
+		}
+
+		entry := Entry{Key: key, Value: string(value), Views: int(views.Int64)}
+		if expiration != 0 {
+			entry.Expiration = time.Unix(expiration, 0)
+			entry.TTL = time.Duration(ttl) * time.Second
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *MySQLStorage) SetEntry(entry Entry) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	var expiration int64
+	if !entry.Expiration.IsZero() {
+		expiration = entry.Expiration.Unix()
+	}
+
+	views := sql.NullInt64{Int64: int64(entry.Views), Valid: entry.Views > 0}
+
+	_, err := s.db.ExecContext(ctx, mysqlSetQuery, entry.Key, []byte(entry.Value), expiration, int64(entry.TTL/time.Second), views)
+	return err
+}
+
+func (s *MySQLStorage) Delete(key string) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	_, err := s.db.ExecContext(ctx, mysqlDeleteByKeyQuery, key)
+	return err
+}
+
+func (s *MySQLStorage) Consume(key string) (string, int, error) {
+	ctx := context.Background() // TODO: Add timeout control
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var value []byte
+	var views sql.NullInt64
+
+	err = tx.QueryRowContext(ctx, mysqlConsumeQuery, key, time.Now().Unix()).Scan(&id, &value, &views)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", 0, ErrNotFound
+	} else if err != nil {
+		return "", 0, err
+	}
+
+	if !views.Valid {
+		return string(value), -1, nil
+	} else if views.Int64 <= 0 {
+		return "", 0, ErrNotFound
+	}
+
+	left := views.Int64 - 1
+	if left == 0 {
+		_, err = tx.ExecContext(ctx, mysqlDeleteQuery, id)
+	} else {
+		_, err = tx.ExecContext(ctx, mysqlUpdateViewsQuery, left, id)
+	}
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", 0, err
+	}
+
+	return string(value), int(left), nil
+}
+
+func (s *MySQLStorage) Close() error {
+	return s.db.Close()
+}
+
+// Adds a column unless the lookup query finds it, MySQL has no ADD COLUMN IF NOT EXISTS
+func mysqlAddColumn(db *sql.DB, lookup string, add string) error {
+	var columns int
+	if err := db.QueryRow(lookup).Scan(&columns); err != nil {
+		return err
+	}
+
+	if columns > 0 {
+		return nil
+	}
+
+	_, err := db.Exec(add)
+	return err
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/server"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+func setupMySQLServer(t *testing.T) (string, int, func()) {
+	db := memory.NewDatabase("testdb")
+	db.BaseDatabase.EnablePrimaryKeyIndexes()
+
+	provider := memory.NewDBProvider(db)
+	engine := sqle.NewDefault(provider)
+
+	srv, err := server.NewServer(server.Config{
+		Protocol: "tcp",
+		Address:  "127.0.0.1:0",
+	}, engine, memory.NewSessionBuilder(provider), nil)
+	require.NoError(t, err)
+
+	go srv.Start()
+
+	addr := srv.Listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, func() {
+		require.NoError(t, srv.Close())
+	}
+}
+
+// Starts a MySQL server, unlike the in-memory one it locks rows taken in transactions
+func setupMySQLContainer(t *testing.T) (string, int, func()) {
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "mysql:8.4",
+		ExposedPorts: []string{"3306/tcp"},
+		Env:          map[string]string{"MYSQL_ALLOW_EMPTY_PASSWORD": "yes", "MYSQL_DATABASE": "testdb"},
+		// The server listens on the port only once initialization finishes
+		WaitingFor: wait.ForListeningPort("3306/tcp").WithStartupTimeout(2 * time.Minute),
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	require.NoError(t, err)
+
+	host, err := container.Host(ctx)
+	require.NoError(t, err)
+
+	port, err := container.MappedPort(ctx, "3306")
+	require.NoError(t, err)
+
+	return host, port.Int(), func() {
+		require.NoError(t, container.Terminate(ctx))
+	}
+}
+
+func TestMySQLStorage(t *testing.T) {
+	host, port, cleanup := setupMySQLServer(t)
+	defer cleanup()
+
+	store := NewMySQLStorage(host, port, "root", "", "testdb", 2*time.Second)
+
+	err := store.Set("key1", "value1", false)
+	require.NoError(t, err)
+
+	val, err := store.Get("key1", false)
+	require.NoError(t, err)
+	require.Equal(t, "value1", val)
+
+	// Test upsert
+	err = store.Set("key1", "value2", false)
+	require.NoError(t, err)
+
+	val, err = store.Get("key1", false)
+	require.NoError(t, err)
+	require.Equal(t, "value2", val)
+
+	// Test binary content
+	err = store.Set("binary", "\x00\xff\x1b[0m", false)
+	require.NoError(t, err)
+
+	val, err = store.Get("binary", false)
+	require.NoError(t, err)
+	require.Equal(t, "\x00\xff\x1b[0m", val)
+
+	// Test key not existing
+	val, err = store.Get("key2", false)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Empty(t, val)
+
+	time.Sleep(3 * time.Second)
+
+	val, err = store.Get("key1", false)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Empty(t, val)
+
+	require.NoError(t, store.Close())
+}
+
+func TestMySQLStorageSkipExpiration(t *testing.T) {
+	host, port, cleanup := setupMySQLServer(t)
+	defer cleanup()
+
+	store := NewMySQLStorage(host, port, "root", "", "testdb", time.Second)
+
+	err := store.Set("persistentKey", "persistentValue", true)
+	require.NoError(t, err)
+
+	time.Sleep(2 * time.Second)
+
+	val, err := store.Get("persistentKey", true)
+	require.NoError(t, err)
+	require.Equal(t, "persistentValue", val)
+
+	entries := map[string]string{}
+	err = store.Iterate(func(entry Entry) error {
+		entries[entry.Key] = entry.Value
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"persistentKey": "persistentValue"}, entries)
+
+	require.NoError(t, store.Close())
+}
+
+func TestMySQLStorageMigrateTTL(t *testing.T) {
+	host, port, cleanup := setupMySQLServer(t)
+	defer cleanup()
+
+	// Table created before entries had their own TTL
+	cfg := mysql.NewConfig()
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	cfg.User = "root"
+	cfg.DBName = "testdb"
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE entries (id BIGINT AUTO_INCREMENT PRIMARY KEY, `key` VARCHAR(255) NOT NULL UNIQUE, value LONGBLOB, expiration BIGINT)")
+	require.NoError(t, err)
+
+	_, err = db.Exec("INSERT INTO entries (`key`, value, expiration) VALUES ('old', 'old value', 0)")
+	require.NoError(t, err)
+
+	store := NewMySQLStorage(host, port, "root", "", "testdb", 0)
+	defer store.Close()
+
+	val, err := store.Get("old", false)
+	require.NoError(t, err)
+	require.Equal(t, "old value", val)
+
+	expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.NoError(t, store.SetEntry(Entry{Key: "new", Value: "new value", Expiration: expiration, TTL: time.Hour}))
+
+	var entries []Entry
+	require.NoError(t, store.Iterate(func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	require.ElementsMatch(t, []Entry{
+		{Key: "old", Value: "old value"},
+		{Key: "new", Value: "new value", Expiration: expiration, TTL: time.Hour},
+	}, entries)
+}
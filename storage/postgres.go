@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+const setSQLQuery = "INSERT INTO entries (key, value, expiration, ttl, views) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expiration = EXCLUDED.expiration, ttl = EXCLUDED.ttl, views = EXCLUDED.views"
+const getSQLQuery = "SELECT id, value, expiration, ttl FROM entries WHERE key = $1"
+const deleteSQLQuery = "DELETE FROM entries WHERE id = $1"
+const deleteByKeySQLQuery = "DELETE FROM entries WHERE key = $1"
+const updateSQLQuery = "UPDATE entries SET expiration = $1 WHERE id = $2"
+const iterateSQLQuery = "SELECT key, value, expiration, ttl, views FROM entries WHERE (expiration = 0 OR expiration >= $1) AND (views IS NULL OR views > 0)"
+
+// Takes one view of an entry stored with a limit, the row lock serializes concurrent readers
+const consumeSQLQuery = "UPDATE entries SET views = views - 1 WHERE key = $1 AND views > 0 AND (expiration = 0 OR expiration >= $2) RETURNING id, value, views"
+const getUnlimitedSQLQuery = "SELECT value FROM entries WHERE key = $1 AND views IS NULL AND (expiration = 0 OR expiration >= $2)"
+
+// TTL of entries stored with their own one in seconds, 0 means the storage-wide expiration
+const migrateTTLSQLQuery = "ALTER TABLE entries ADD COLUMN IF NOT EXISTS ttl BIGINT NOT NULL DEFAULT 0"
+
+// Views left of entries stored with a limit, NULL means unlimited
+const migrateViewsSQLQuery = "ALTER TABLE entries ADD COLUMN IF NOT EXISTS views BIGINT"
+
+// Values used to be stored as TEXT, which rejects NUL bytes and invalid UTF-8
+const migrateValueSQLQuery = `DO $$ BEGIN
+	IF (SELECT data_type FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'entries' AND column_name = 'value') = 'text' THEN
+		ALTER TABLE entries ALTER COLUMN value TYPE BYTEA USING convert_to(value, 'UTF8');
+	END IF;
+END $$`
+
+type PostgresStorage struct {
+	pool       *pgxpool.Pool
+	expiration int
+}
+
+var (
+	_ Storage      = (*PostgresStorage)(nil)
+	_ Iterator     = (*PostgresStorage)(nil)
+	_ EntrySetter  = (*PostgresStorage)(nil)
+	_ Deleter      = (*PostgresStorage)(nil)
+	_ ViewConsumer = (*PostgresStorage)(nil)
+)
+
+func init() {
+	Register("postgres", func(cfg ServerConfig, opts Options) (Storage, error) {
+		return NewPostgresStorage(cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.Database, int(opts.Expiration/time.Second)), nil
+	})
+}
+
+func NewPostgresStorage(host string, port int, username string, passowrd string, database string, expiration int) *PostgresStorage {
+	dsn := "postgres://" + username + ":" + passowrd + "@" + host + ":" + strconv.Itoa(port) + "/" + database
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to PostgreSQL")
+	}
+
+	// Check if connection is established
+	if err := pool.Ping(context.Background()); err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to PostgreSQL")
+	}
+
+	// Create table if not exists
+	_, err = pool.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS entries (id SERIAL PRIMARY KEY, key VARCHAR(255) NOT NULL UNIQUE, value BYTEA, expiration BIGINT, ttl BIGINT NOT NULL DEFAULT 0, views BIGINT)")
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create table")
+	}
+
+	if _, err := pool.Exec(context.Background(), migrateValueSQLQuery); err != nil {
+		log.Fatal().Err(err).Msg("Failed to migrate table")
+	}
+
+	if _, err := pool.Exec(context.Background(), migrateTTLSQLQuery); err != nil {
+		log.Fatal().Err(err).Msg("Failed to migrate table")
+	}
+
+	if _, err := pool.Exec(context.Background(), migrateViewsSQLQuery); err != nil {
+		log.Fatal().Err(err).Msg("Failed to migrate table")
+	}
+
+	return &PostgresStorage{pool: pool, expiration: expiration}
+}
+
+func (s *PostgresStorage) Set(key string, value string, skip_expiration bool) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	var expiration int64
+	if !skip_expiration && s.expiration > 0 {
+		expiration = time.Now().Add(time.Duration(s.expiration) * time.Second).Unix()
+	}
+
+	_, err := s.pool.Exec(ctx, setSQLQuery, key, []byte(value), expiration, 0, nil)
+	return err
+}
+
+func (s *PostgresStorage) Get(key string, skip_expiration bool) (string, error) {
+	ctx := context.Background() // TODO: Add timeout control
+
+	var id int
+	var value []byte
+	var expiration int64
+	var ttl int64
+
+	err := s.pool.QueryRow(ctx, getSQLQuery, key).Scan(&id, &value, &expiration, &ttl)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	// Delete if expired
+	if expiration != 0 && time.Now().Unix() > expiration {
+		_, err = s.pool.Exec(ctx, deleteSQLQuery, id)
+		if err != nil {
+			return "", err
+		}
+		return "", ErrNotFound
+	}
+
+	// Update expiration, entries stored without one must stay persistent
+	refresh := entryTTL(time.Duration(ttl)*time.Second, time.Duration(s.expiration)*time.Second)
+	if !skip_expiration && expiration != 0 && refresh > 0 {
+		_, err = s.pool.Exec(ctx, updateSQLQuery, time.Now().Add(refresh).Unix(), id)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return string(value), nil
+}
+
+func (s *PostgresStorage) Iterate(fn func(entry Entry) error) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	rows, err := s.pool.Query(ctx, iterateSQLQuery, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry Entry
+		var value []byte
+		var expiration int64
+		var ttl int64
+		var views *int64
+
+		if err := rows.Scan(&entry.Key, &value, &expiration, &ttl, &views); err != nil {
+			return err
+		}
+		entry.Value = string(value)
+
+		if views != nil {
+			entry.Views = int(*views)
+		}
+
+		if expiration != 0 {
+			entry.Expiration = time.Unix(expiration, 0)
+			entry.TTL = time.Duration(ttl) * time.Second
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *PostgresStorage) SetEntry(entry Entry) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	var expiration int64
+	if !entry.Expiration.IsZero() {
+		expiration = entry.Expiration.Unix()
+	}
+
+	var views *int64
+	if entry.Views > 0 {
+		n := int64(entry.Views)
+		views = &n
+	}
+
+	_, err := s.pool.Exec(ctx, setSQLQuery, entry.Key, []byte(entry.Value), expiration, int64(entry.TTL/time.Second), views)
+	return err
+}
+
+func (s *PostgresStorage) Delete(key string) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	_, err := s.pool.Exec(ctx, deleteByKeySQLQuery, key)
+	return err
+}
+
+func (s *PostgresStorage) Consume(key string) (string, int, error) {
+	ctx := context.Background() // TODO: Add timeout control
+
+	var id int
+	var value []byte
+	var views int64
+
+	now := time.Now().Unix()
+	err := s.pool.QueryRow(ctx, consumeSQLQuery, key, now).Scan(&id, &value, &views)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Either the entry has no limit, or it doesn't exist or has no views left
+		err := s.pool.QueryRow(ctx, getUnlimitedSQLQuery, key, now).Scan(&value)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", 0, ErrNotFound
+		} else if err != nil {
+			return "", 0, err
+		}
+
+		return string(value), -1, nil
+	} else if err != nil {
+		return "", 0, err
+	}
+
+	// No reader can take a view of the entry anymore, so it is removed after the update
+	if views == 0 {
+		if _, err := s.pool.Exec(ctx, deleteSQLQuery, id); err != nil {
+			return "", 0, err
+		}
+	}
+
+	return string(value), int(views), nil
+}
+
+func (s *PostgresStorage) Close() error {
+	s.pool.Close()
+	return nil
+}
@@ -51,7 +51,7 @@ func TestPostgresStorage(t *testing.T) {
 	time.Sleep(3 * time.Second)
 
 	val, err = store.Get("key1", false)
-	require.NoError(t, err)
+	require.ErrorIs(t, err, ErrNotFound)
 	require.Empty(t, val)
 
 	// Test with skip expiration
@@ -62,10 +62,10 @@ func TestPostgresStorage(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "value1", val)
 
-	time.Sleep(2 * time.Second)
+	time.Sleep(3 * time.Second)
 
 	val, err = store.Get("key1", false)
-	require.NoError(t, err)
+	require.ErrorIs(t, err, ErrNotFound)
 	require.Empty(t, val)
 
 	require.NoError(t, store.Close())
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PrefixRoute is a storage holding keys starting with the prefix
+type PrefixRoute struct {
+	Prefix  string
+	Storage Storage
+}
+
+// PrefixStorage stores keys in the storage of the longest matching prefix
+// Keys without a matching prefix are kept in the fallback storage. Reads of a key
+// missing in the matching storage fall back too, so keys of the fallback storage may
+// start with any prefix.
+type PrefixStorage struct {
+	fallback Storage
+	routes   []PrefixRoute
+}
+
+var (
+	_ Storage      = (*PrefixStorage)(nil)
+	_ Iterator     = (*PrefixStorage)(nil)
+	_ EntrySetter  = (*PrefixStorage)(nil)
+	_ Deleter      = (*PrefixStorage)(nil)
+	_ ViewConsumer = (*PrefixStorage)(nil)
+	_ RangeReader  = (*PrefixStorage)(nil)
+	_ Appender     = (*PrefixStorage)(nil)
+)
+
+func NewPrefixStorage(fallback Storage, routes []PrefixRoute) *PrefixStorage {
+	routes = slices.Clone(routes)
+
+	// Longest prefix wins
+	slices.SortStableFunc(routes, func(a, b PrefixRoute) int {
+		return len(b.Prefix) - len(a.Prefix)
+	})
+
+	return &PrefixStorage{fallback: fallback, routes: routes}
+}
+
+// Storage returns the storage of the key
+func (s *PrefixStorage) Storage(key string) Storage {
+	for _, route := range s.routes {
+		if strings.HasPrefix(key, route.Prefix) {
+			return route.Storage
+		}
+	}
+
+	return s.fallback
+}
+
+func (s *PrefixStorage) Set(key string, value string, skip_expiration bool) error {
+	return s.Storage(key).Set(key, value, skip_expiration)
+}
+
+func (s *PrefixStorage) Get(key string, skip_expiration bool) (string, error) {
+	store := s.Storage(key)
+
+	value, err := store.Get(key, skip_expiration)
+	if errors.Is(err, ErrNotFound) && store != s.fallback {
+		return s.fallback.Get(key, skip_expiration)
+	}
+
+	return value, err
+}
+
+// Iterate walks the fallback storage and then storages of all prefixes
+func (s *PrefixStorage) Iterate(fn func(entry Entry) error) error {
+	for _, store := range s.storages() {
+		iterator, ok := store.(Iterator)
+		if !ok {
+			return fmt.Errorf("storage %T doesn't support iteration", store)
+		}
+
+		if err := iterator.Iterate(fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *PrefixStorage) SetEntry(entry Entry) error {
+	store := s.Storage(entry.Key)
+
+	setter, ok := store.(EntrySetter)
+	if !ok {
+		return fmt.Errorf("storage %T doesn't support setting entries", store)
+	}
+
+	if err := checkViews(store, entry); err != nil {
+		return err
+	}
+
+	return setter.SetEntry(entry)
+}
+
+// Delete removes the key from its storage and from the fallback storage
+func (s *PrefixStorage) Delete(key string) error {
+	stores := []Storage{s.Storage(key)}
+	if stores[0] != s.fallback {
+		stores = append(stores, s.fallback)
+	}
+
+	for _, store := range stores {
+		deleter, ok := store.(Deleter)
+		if !ok {
+			return fmt.Errorf("storage %T doesn't support delete", store)
+		}
+
+		if err := deleter.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Consume takes a view of the key from its storage, falling back like Get does
+func (s *PrefixStorage) Consume(key string) (string, int, error) {
+	store := s.Storage(key)
+
+	value, views, err := consume(store, key)
+	if errors.Is(err, ErrNotFound) && store != s.fallback {
+		return consume(s.fallback, key)
+	}
+
+	return value, views, err
+}
+
+func (s *PrefixStorage) GetRange(key string, offset int64, length int64) (string, error) {
+	store := s.Storage(key)
+
+	value, err := getRange(store, key, offset, length)
+	if errors.Is(err, ErrNotFound) && store != s.fallback {
+		return getRange(s.fallback, key, offset, length)
+	}
+
+	return value, err
+}
+
+func (s *PrefixStorage) Append(key string, value string) error {
+	store := s.Storage(key)
+
+	err := appendTo(store, key, value)
+	if errors.Is(err, ErrNotFound) && store != s.fallback {
+		return appendTo(s.fallback, key, value)
+	}
+
+	return err
+}
+
+func (s *PrefixStorage) Close() error {
+	var errs []error
+	for _, store := range s.storages() {
+		if err := store.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Returns every distinct storage, the fallback one first
+func (s *PrefixStorage) storages() []Storage {
+	stores := []Storage{s.fallback}
+	for _, route := range s.routes {
+		if !slices.Contains(stores, route.Storage) {
+			stores = append(stores, route.Storage)
+		}
+	}
+
+	return stores
+}
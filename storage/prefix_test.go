@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixStorage(t *testing.T) {
+	fallback := NewFileStorage(t.TempDir(), 0)
+	logs := NewFileStorage(t.TempDir(), 0)
+	errors := NewFileStorage(t.TempDir(), 0)
+
+	store := NewPrefixStorage(fallback, []PrefixRoute{
+		{Prefix: "l", Storage: logs},
+		{Prefix: "le", Storage: errors},
+	})
+	defer store.Close()
+
+	require.Same(t, fallback, store.Storage("abc"))
+	require.Same(t, logs, store.Storage("labc"))
+	require.Same(t, errors, store.Storage("leabc"))
+
+	require.NoError(t, store.Set("abc", "document", false))
+	require.NoError(t, store.Set("labc", "log", false))
+	require.NoError(t, store.Set("leabc", "error log", false))
+
+	val, err := logs.Get("labc", false)
+	require.NoError(t, err)
+	require.Equal(t, "log", val)
+
+	val, err = errors.Get("leabc", false)
+	require.NoError(t, err)
+	require.Equal(t, "error log", val)
+
+	_, err = fallback.Get("labc", false)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	for key, want := range map[string]string{"abc": "document", "labc": "log", "leabc": "error log"} {
+		val, err := store.Get(key, false)
+		require.NoError(t, err)
+		require.Equal(t, want, val)
+	}
+
+	// Documents stored before the profile existed stay readable
+	require.NoError(t, fallback.Set("lold", "old log", false))
+	val, err = store.Get("lold", false)
+	require.NoError(t, err)
+	require.Equal(t, "old log", val)
+
+	_, err = store.Get("lmissing", false)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	var keys []string
+	require.NoError(t, store.Iterate(func(entry Entry) error {
+		keys = append(keys, entry.Key)
+		return nil
+	}))
+	require.ElementsMatch(t, []string{"abc", "lold", "labc", "leabc"}, keys)
+
+	require.NoError(t, store.Delete("lold"))
+	_, err = store.Get("lold", false)
+	require.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTTLSuffix is the suffix of keys holding TTL of entries stored with their own one
+const redisTTLSuffix = ":ttl"
+
+// redisViewsSuffix is the suffix of keys holding views left of entries stored with a limit
+const redisViewsSuffix = ":views"
+
+// redisConsumeScript reads the entry and takes one of its views, the entry is deleted
+// together with its last view. Entries without a limit are returned with -1 views left.
+var redisConsumeScript = redis.NewScript(`
+local value = redis.call('GET', KEYS[1])
+if not value then
+	return false
+end
+
+local views = tonumber(redis.call('GET', KEYS[2]))
+if not views then
+	return {value, -1}
+end
+
+views = views - 1
+if views <= 0 then
+	redis.call('DEL', KEYS[1], KEYS[2], KEYS[3])
+else
+	redis.call('DECR', KEYS[2])
+end
+
+return {value, views}
+`)
+
+// redisAppendScript appends to the entry only when it exists, APPEND alone would create it
+// without expiration. Missing entries return -1.
+var redisAppendScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+
+return redis.call('APPEND', KEYS[1], ARGV[1])
+`)
+
+type RedisStorage struct {
+	client     *redis.Client
+	expiration time.Duration
+}
+
+func init() {
+	Register("redis", func(cfg ServerConfig, opts Options) (Storage, error) {
+		return NewRedisStorage(cfg.Host, cfg.Port, cfg.Username, cfg.Password, opts.Expiration), nil
+	})
+}
+
+func NewRedisStorage(host string, port int, username string, password string, expiration time.Duration) *RedisStorage {
+	client := redis.NewClient(&redis.Options{
+		Addr:     host + ":" + strconv.Itoa(port),
+		Username: username,
+		Password: password,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Check if connection is established with 5s timeout
+	if status := client.Ping(ctx); status.Err() != nil {
+		log.Fatal().Err(status.Err()).Msg("Failed to connect to Redis")
+	}
+
+	return &RedisStorage{client: client, expiration: expiration}
+}
+
+var (
+	_ Storage      = (*RedisStorage)(nil)
+	_ Iterator     = (*RedisStorage)(nil)
+	_ EntrySetter  = (*RedisStorage)(nil)
+	_ Deleter      = (*RedisStorage)(nil)
+	_ ViewConsumer = (*RedisStorage)(nil)
+	_ RangeReader  = (*RedisStorage)(nil)
+	_ Appender     = (*RedisStorage)(nil)
+)
+
+func (s *RedisStorage) Set(key string, value string, skip_expiration bool) error {
+	var expiration time.Time
+	if !skip_expiration && s.expiration > 0 {
+		expiration = time.Now().Add(s.expiration)
+	}
+
+	return s.SetEntry(Entry{Key: key, Value: value, Expiration: expiration})
+}
+
+func (s *RedisStorage) Get(key string, skip_expiration bool) (string, error) {
+	ctx := context.Background() // TODO: Add timeout control
+
+	pipe := s.client.Pipeline()
+	get := pipe.Get(ctx, key)
+	pttl := pipe.PTTL(ctx, key)
+	custom := pipe.Get(ctx, key+redisTTLSuffix)
+	pipe.Exec(ctx)
+
+	res, err := get.Result()
+	if err == redis.Nil {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	// Update expiration, keys stored without one must stay persistent
+	if !skip_expiration && pttl.Err() == nil && pttl.Val() > 0 {
+		if ttl := entryTTL(redisTTL(custom), s.expiration); ttl > 0 {
+			pipe := s.client.Pipeline()
+			pipe.PExpire(ctx, key, ttl)
+			pipe.PExpire(ctx, key+redisTTLSuffix, ttl)
+			pipe.PExpire(ctx, key+redisViewsSuffix, ttl)
+			pipe.Exec(ctx)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *RedisStorage) GetRange(key string, offset int64, length int64) (string, error) {
+	ctx := context.Background() // TODO: Add timeout control
+
+	// Ends of ranges are inclusive, -1 is the last byte
+	end := int64(-1)
+	if length >= 0 {
+		end = offset + length - 1
+	}
+
+	// Ranges of missing keys are empty, so existence is checked in the same round trip
+	pipe := s.client.Pipeline()
+	exists := pipe.Exists(ctx, key)
+	value := pipe.GetRange(ctx, key, offset, end)
+	pipe.Exec(ctx)
+
+	if err := exists.Err(); err != nil {
+		return "", err
+	} else if exists.Val() == 0 {
+		return "", ErrNotFound
+	}
+
+	if length == 0 {
+		return "", nil
+	}
+
+	return value.Result()
+}
+
+func (s *RedisStorage) Append(key string, value string) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	length, err := redisAppendScript.Run(ctx, s.client, []string{key}, value).Int64()
+	if err != nil {
+		return err
+	} else if length < 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *RedisStorage) Iterate(fn func(entry Entry) error) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	iter := s.client.Scan(ctx, 0, "*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if strings.HasSuffix(key, redisTTLSuffix) || strings.HasSuffix(key, redisViewsSuffix) {
+			continue
+		}
+
+		pipe := s.client.Pipeline()
+		get := pipe.Get(ctx, key)
+		pttl := pipe.PTTL(ctx, key)
+		custom := pipe.Get(ctx, key+redisTTLSuffix)
+		views := pipe.Get(ctx, key+redisViewsSuffix)
+		pipe.Exec(ctx)
+
+		value, err := get.Result()
+		if err == redis.Nil {
+			// Key expired in the meantime
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		ttl, err := pttl.Result()
+		if err != nil {
+			return err
+		}
+
+		entry := Entry{Key: key, Value: value}
+		if n, err := views.Int(); err == nil {
+			entry.Views = n
+		}
+
+		if ttl > 0 {
+			entry.Expiration = time.Now().Add(ttl)
+			entry.TTL = redisTTL(custom)
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return iter.Err()
+}
+
+func (s *RedisStorage) SetEntry(entry Entry) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	var expiry time.Duration
+	if !entry.Expiration.IsZero() {
+		expiry = time.Until(entry.Expiration)
+		if expiry <= 0 {
+			return nil
+		}
+	}
+
+	// TTL and views are kept in separate keys expiring together with the entry
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, entry.Key, entry.Value, expiry)
+	if expiry > 0 && entry.TTL > 0 {
+		pipe.Set(ctx, entry.Key+redisTTLSuffix, entry.TTL.Milliseconds(), expiry)
+	} else {
+		pipe.Del(ctx, entry.Key+redisTTLSuffix)
+	}
+
+	if entry.Views > 0 {
+		pipe.Set(ctx, entry.Key+redisViewsSuffix, entry.Views, expiry)
+	} else {
+		pipe.Del(ctx, entry.Key+redisViewsSuffix)
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStorage) Delete(key string) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	return s.client.Del(ctx, key, key+redisTTLSuffix, key+redisViewsSuffix).Err()
+}
+
+func (s *RedisStorage) Consume(key string) (string, int, error) {
+	ctx := context.Background() // TODO: Add timeout control
+
+	res, err := redisConsumeScript.Run(ctx, s.client, []string{key, key + redisViewsSuffix, key + redisTTLSuffix}).Slice()
+	if err == redis.Nil {
+		return "", 0, ErrNotFound
+	} else if err != nil {
+		return "", 0, err
+	}
+
+	value, _ := res[0].(string)
+	views, _ := res[1].(int64)
+	return value, int(views), nil
+}
+
+func (s *RedisStorage) Close() error {
+	return s.client.Close()
+}
+
+// Returns TTL of an entry stored with its own one, 0 means the storage-wide expiration
+func redisTTL(cmd *redis.StringCmd) time.Duration {
+	ms, err := cmd.Int64()
+	if err != nil {
+		return 0
+	}
+
+	return time.Duration(ms) * time.Millisecond
+}
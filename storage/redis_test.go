@@ -5,7 +5,6 @@ import (
 	"testing"
 	"time"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -97,8 +96,7 @@ func TestRedisStorage_GetNonExistentKey(t *testing.T) {
 	storage := NewRedisStorage(host, port, "", "", expiration)
 
 	_, err := storage.Get("nonExistentKey", false)
-	require.Error(t, err)
-	require.Equal(t, redis.Nil, err)
+	require.ErrorIs(t, err, ErrNotFound)
 
 	require.NoError(t, storage.Close())
 }
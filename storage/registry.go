@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Options are settings shared by every storage backend
+type Options struct {
+	// Expiration is the lifetime of entries, 0 means entries never expire
+	Expiration time.Duration
+}
+
+// Decoder decodes the YAML configuration block of a storage backend into v
+type Decoder func(v any) error
+
+// ServerConfig is the configuration block of backends connecting to a database server
+type ServerConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Database string `yaml:"database"`
+}
+
+type factory func(decode Decoder, opts Options) (Storage, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]factory{}
+)
+
+// Register makes a storage backend available under the given name
+// The configuration block of the backend is decoded into C before the factory is called.
+// Register panics if the name is already taken, it is meant to be called from init functions.
+func Register[C any](name string, fn func(cfg C, opts Options) (Storage, error)) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic("storage: backend " + name + " registered twice")
+	}
+
+	registry[name] = func(decode Decoder, opts Options) (Storage, error) {
+		var cfg C
+		if err := decode(&cfg); err != nil {
+			return nil, fmt.Errorf("failed to decode %s storage configuration: %w", name, err)
+		}
+
+		return fn(cfg, opts)
+	}
+}
+
+// New creates the storage backend registered under the given name
+func New(name string, decode Decoder, opts Options) (Storage, error) {
+	registryMu.RLock()
+	fn, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown storage type %q", name)
+	}
+
+	return fn(decode, opts)
+}
+
+// Registered returns sorted names of all registered storage backends
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
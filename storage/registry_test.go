@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+type registryTestConfig struct {
+	Greeting string `yaml:"greeting"`
+}
+
+type registryTestStorage struct {
+	FileStorage
+	greeting   string
+	expiration time.Duration
+}
+
+func yamlDecoder(t *testing.T, data string) Decoder {
+	var node yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(data), &node))
+
+	return func(v any) error {
+		return node.Decode(v)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("registry-test", func(cfg registryTestConfig, opts Options) (Storage, error) {
+		return &registryTestStorage{greeting: cfg.Greeting, expiration: opts.Expiration}, nil
+	})
+
+	require.Contains(t, Registered(), "registry-test")
+	require.Panics(t, func() {
+		Register("registry-test", func(cfg struct{}, opts Options) (Storage, error) { return nil, nil })
+	})
+
+	store, err := New("registry-test", yamlDecoder(t, "greeting: hello"), Options{Expiration: time.Minute})
+	require.NoError(t, err)
+	require.Equal(t, "hello", store.(*registryTestStorage).greeting)
+	require.Equal(t, time.Minute, store.(*registryTestStorage).expiration)
+
+	_, err = New("registry-test", yamlDecoder(t, "greeting: [not, a, string]"), Options{})
+	require.Error(t, err)
+
+	_, err = New("nonexistent", yamlDecoder(t, "{}"), Options{})
+	require.ErrorContains(t, err, "unknown storage type")
+}
+
+func TestRegister_Builtin(t *testing.T) {
+	for _, name := range []string{"file", "redis", "memcached", "mongodb", "postgres", "mysql", "s3", "gcs", "webdav", "git", "sharded"} {
+		require.Contains(t, Registered(), name)
+	}
+}
+
+func TestNew_Sharded(t *testing.T) {
+	dir := t.TempDir()
+	decode := yamlDecoder(t, `
+type: sharded
+nodes:
+  - name: first
+    type: file
+    file_path: `+dir+`/first
+  - type: git
+    file_path: `+dir+`/second
+`)
+
+	store, err := New("sharded", decode, Options{})
+	require.NoError(t, err)
+	defer store.Close()
+
+	sharded := store.(*ShardedStorage)
+	require.Len(t, sharded.nodes, 2)
+	require.Equal(t, "first", sharded.nodes[0].Name)
+	require.IsType(t, &FileStorage{}, sharded.nodes[0].Storage)
+	require.Equal(t, "node1", sharded.nodes[1].Name)
+	require.IsType(t, &GitStorage{}, sharded.nodes[1].Storage)
+
+	_, err = New("sharded", yamlDecoder(t, "nodes: []"), Options{})
+	require.Error(t, err)
+
+	_, err = New("sharded", yamlDecoder(t, "nodes: [{type: nonexistent}]"), Options{})
+	require.ErrorContains(t, err, "node0")
+}
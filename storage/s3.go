@@ -0,0 +1,410 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/rs/zerolog/log"
+)
+
+// s3ExpiresAtKey is the object metadata key holding the expiration unix timestamp
+const s3ExpiresAtKey = "expires-at"
+
+// s3TTLKey is the object metadata key holding TTL of objects stored with their own one in seconds
+const s3TTLKey = "ttl"
+
+// S3Options configures S3 storage
+type S3Options struct {
+	// Endpoint is the base URL of S3 API, empty value means AWS endpoint of the region
+	Endpoint string
+
+	// UsePathStyle forces path-style addressing instead of virtual-hosted buckets
+	UsePathStyle bool
+
+	Region string
+	Bucket string
+
+	// AccessKey and SecretKey are static credentials
+	// When empty, the default AWS credential chain (environment, web identity, instance profile...) is used.
+	AccessKey string
+	SecretKey string
+
+	// Prefix is prepended to every object key
+	Prefix string
+
+	// ServerSideEncryption is the server-side encryption algorithm, e.g. "AES256" or "aws:kms"
+	ServerSideEncryption string
+
+	// SSEKMSKeyID is the KMS key used with "aws:kms" server-side encryption
+	SSEKMSKeyID string
+
+	// Expiration is the lifetime of objects, 0 means no expiration
+	Expiration time.Duration
+}
+
+type S3Storage struct {
+	svc        *s3.Client
+	uploader   *manager.Uploader
+	bucket     string
+	prefix     string
+	sse        types.ServerSideEncryption
+	sseKMSKey  *string
+	expiration time.Duration
+}
+
+// S3Config is the configuration block of "s3" storage
+// Endpoint takes precedence over host and port, username and password are static credentials.
+type S3Config struct {
+	Endpoint             string `yaml:"endpoint"`
+	Host                 string `yaml:"host"`
+	Port                 int    `yaml:"port"`
+	TLS                  bool   `yaml:"tls"`
+	PathStyle            bool   `yaml:"path_style"`
+	AWSRegion            string `yaml:"aws_region"`
+	Bucket               string `yaml:"bucket"`
+	Username             string `yaml:"username"`
+	Password             string `yaml:"password"`
+	Prefix               string `yaml:"prefix"`
+	ServerSideEncryption string `yaml:"server_side_encryption"`
+	SSEKMSKeyID          string `yaml:"sse_kms_key_id"`
+}
+
+func init() {
+	Register("s3", func(cfg S3Config, opts Options) (Storage, error) {
+		endpoint := cfg.Endpoint
+		if endpoint == "" && cfg.Host != "" {
+			scheme := "http://"
+			if cfg.TLS {
+				scheme = "https://"
+			}
+			endpoint = scheme + cfg.Host + ":" + strconv.Itoa(cfg.Port)
+		}
+
+		return NewS3Storage(S3Options{
+			Endpoint:             endpoint,
+			UsePathStyle:         cfg.PathStyle || cfg.Host != "",
+			Region:               cfg.AWSRegion,
+			Bucket:               cfg.Bucket,
+			AccessKey:            cfg.Username,
+			SecretKey:            cfg.Password,
+			Prefix:               cfg.Prefix,
+			ServerSideEncryption: cfg.ServerSideEncryption,
+			SSEKMSKeyID:          cfg.SSEKMSKeyID,
+			Expiration:           opts.Expiration,
+		}), nil
+	})
+}
+
+func NewS3Storage(opts S3Options) *S3Storage {
+	ctx := context.Background()
+
+	loadOpts := []func(*config.LoadOptions) error{
+		config.WithRegion(opts.Region),
+		config.WithRetryer(func() aws.Retryer {
+			return retry.AddWithMaxAttempts(retry.NewStandard(), 3)
+		}),
+	}
+
+	if opts.AccessKey != "" || opts.SecretKey != "" {
+		creds := credentials.NewStaticCredentialsProvider(opts.AccessKey, opts.SecretKey, "")
+		loadOpts = append(loadOpts, config.WithCredentialsProvider(creds))
+	}
+
+	awscfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load SDK config")
+	}
+
+	svc := s3.NewFromConfig(awscfg, func(o *s3.Options) {
+		if opts.Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.Endpoint)
+		}
+		o.UsePathStyle = opts.UsePathStyle
+	})
+
+	s := &S3Storage{
+		svc:        svc,
+		uploader:   manager.NewUploader(svc),
+		bucket:     opts.Bucket,
+		prefix:     opts.Prefix,
+		sse:        types.ServerSideEncryption(opts.ServerSideEncryption),
+		expiration: opts.Expiration,
+	}
+
+	if opts.SSEKMSKeyID != "" {
+		s.sseKMSKey = aws.String(opts.SSEKMSKeyID)
+	}
+
+	// Check if connection is established and create bucket only if it doesn't exist
+	_, err = svc.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: &s.bucket})
+
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		input := &s3.CreateBucketInput{Bucket: &s.bucket}
+		if opts.Region != "" && opts.Region != "us-east-1" {
+			input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+				LocationConstraint: types.BucketLocationConstraint(opts.Region),
+			}
+		}
+
+		var owned *types.BucketAlreadyOwnedByYou
+		if _, err := svc.CreateBucket(ctx, input); err != nil && !errors.As(err, &owned) {
+			log.Fatal().Err(err).Str("bucket", s.bucket).Msg("Failed to create bucket")
+		}
+	} else if err != nil {
+		log.Fatal().Err(err).Str("bucket", s.bucket).Msg("Failed to connect to S3")
+	}
+
+	return s
+}
+
+var (
+	_ Storage     = (*S3Storage)(nil)
+	_ Iterator    = (*S3Storage)(nil)
+	_ EntrySetter = (*S3Storage)(nil)
+	_ Deleter     = (*S3Storage)(nil)
+	_ RangeReader = (*S3Storage)(nil)
+)
+
+func (s *S3Storage) Set(key string, value string, skip_expiration bool) error {
+	var expiration time.Time
+	if !skip_expiration && s.expiration > 0 {
+		expiration = time.Now().Add(s.expiration)
+	}
+
+	return s.SetEntry(Entry{Key: key, Value: value, Expiration: expiration})
+}
+
+// Get returns the object content, objects past their expiration are deleted
+// To avoid copying objects on every read, expiration is refreshed only
+// after half of the lifetime has passed.
+func (s *S3Storage) Get(key string, skip_expiration bool) (string, error) {
+	var nsk *types.NoSuchKey
+
+	ctx := context.Background() // TODO: Add timeout control
+
+	out, err := s.svc.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    aws.String(s.prefix + key),
+	})
+	if errors.As(err, &nsk) {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+	defer out.Body.Close()
+
+	expiration := s3Expiration(out.Metadata)
+	if !expiration.IsZero() && !expiration.After(time.Now()) {
+		_, err := s.svc.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: &s.bucket,
+			Key:    aws.String(s.prefix + key),
+		})
+		if err != nil {
+			return "", err
+		}
+
+		return "", ErrNotFound
+	}
+
+	value, err := io.ReadAll(out.Body)
+	if err != nil {
+		return "", err
+	}
+
+	// Update expiration
+	ttl := entryTTL(s3TTL(out.Metadata), s.expiration)
+	if !skip_expiration && !expiration.IsZero() && ttl > 0 && time.Until(expiration) < ttl/2 {
+		_, err := s.svc.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:               &s.bucket,
+			Key:                  aws.String(s.prefix + key),
+			CopySource:           aws.String(s.bucket + "/" + url.PathEscape(s.prefix+key)),
+			MetadataDirective:    types.MetadataDirectiveReplace,
+			Metadata:             s3Metadata(time.Now().Add(ttl), s3TTL(out.Metadata)),
+			ContentType:          out.ContentType,
+			ServerSideEncryption: s.sse,
+			SSEKMSKeyId:          s.sseKMSKey,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return string(value), nil
+}
+
+// GetRange returns a range of the object content, objects past their expiration are not found
+func (s *S3Storage) GetRange(key string, offset int64, length int64) (string, error) {
+	var nsk *types.NoSuchKey
+	var apiErr smithy.APIError
+
+	if length == 0 {
+		// Empty ranges can't be requested, the object still has to exist
+		_, err := s.Get(key, true)
+		return "", err
+	}
+
+	ctx := context.Background() // TODO: Add timeout control
+
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange += strconv.FormatInt(offset+length-1, 10)
+	}
+
+	out, err := s.svc.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    aws.String(s.prefix + key),
+		Range:  &byteRange,
+	})
+	if errors.As(err, &nsk) {
+		return "", ErrNotFound
+	} else if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRange" {
+		// The offset is past the end of the object
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer out.Body.Close()
+
+	if expiration := s3Expiration(out.Metadata); !expiration.IsZero() && !expiration.After(time.Now()) {
+		return "", ErrNotFound
+	}
+
+	value, err := io.ReadAll(out.Body)
+	return string(value), err
+}
+
+func (s *S3Storage) Iterate(fn func(entry Entry) error) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	input := &s3.ListObjectsV2Input{Bucket: &s.bucket}
+	if s.prefix != "" {
+		input.Prefix = aws.String(s.prefix)
+	}
+
+	paginator := s3.NewListObjectsV2Paginator(s.svc, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, object := range page.Contents {
+			key := strings.TrimPrefix(*object.Key, s.prefix)
+
+			out, err := s.svc.GetObject(ctx, &s3.GetObjectInput{
+				Bucket: &s.bucket,
+				Key:    object.Key,
+			})
+
+			var nsk *types.NoSuchKey
+			if errors.As(err, &nsk) {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			expiration := s3Expiration(out.Metadata)
+			if !expiration.IsZero() && !expiration.After(time.Now()) {
+				out.Body.Close()
+				continue
+			}
+
+			value, err := io.ReadAll(out.Body)
+			out.Body.Close()
+			if err != nil {
+				return err
+			}
+
+			entry := Entry{Key: key, Value: string(value), Expiration: expiration, TTL: s3TTL(out.Metadata)}
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *S3Storage) SetEntry(entry Entry) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	input := &s3.PutObjectInput{
+		Bucket:               &s.bucket,
+		Key:                  aws.String(s.prefix + entry.Key),
+		Body:                 bytes.NewReader([]byte(entry.Value)),
+		ContentType:          aws.String("text/plain; charset=UTF-8"),
+		ServerSideEncryption: s.sse,
+		SSEKMSKeyId:          s.sseKMSKey,
+	}
+
+	if !entry.Expiration.IsZero() {
+		input.Metadata = s3Metadata(entry.Expiration, entry.TTL)
+	}
+
+	_, err := s.uploader.Upload(ctx, input)
+	return err
+}
+
+func (s *S3Storage) Delete(key string) error {
+	ctx := context.Background() // TODO: Add timeout control
+
+	_, err := s.svc.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &s.bucket,
+		Key:    aws.String(s.prefix + key),
+	})
+	return err
+}
+
+func (s *S3Storage) Close() error {
+	return nil
+}
+
+func s3Metadata(expiration time.Time, ttl time.Duration) map[string]string {
+	metadata := map[string]string{s3ExpiresAtKey: strconv.FormatInt(expiration.Unix(), 10)}
+	if ttl > 0 {
+		metadata[s3TTLKey] = strconv.FormatInt(int64(ttl/time.Second), 10)
+	}
+
+	return metadata
+}
+
+// Returns expiration stored in object metadata, zero time means no expiration
+func s3Expiration(metadata map[string]string) time.Time {
+	value, ok := metadata[s3ExpiresAtKey]
+	if !ok {
+		return time.Time{}
+	}
+
+	unix, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(unix, 0)
+}
+
+// Returns TTL stored in object metadata, 0 means the storage-wide expiration
+func s3TTL(metadata map[string]string) time.Duration {
+	seconds, err := strconv.ParseInt(metadata[s3TTLKey], 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testcontainers/testcontainers-go/modules/minio"
+)
+
+const (
+	minioUser   string = "minio-user"
+	minioPass   string = "minio-password"
+	minioRegion string = "us-east-1"
+	minioBucket string = "test-bucket"
+)
+
+func setupMinio(t *testing.T) (string, int, func()) {
+	ctx := context.Background()
+
+	c, err := minio.Run(ctx,
+		"docker.io/minio/minio",
+		minio.WithUsername(minioUser),
+		minio.WithPassword(minioPass),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	host, err := c.Host(ctx)
+	require.NoError(t, err)
+
+	fmt.Println(c.ConnectionString(ctx))
+
+	port, err := c.MappedPort(ctx, "9000")
+	require.NoError(t, err)
+
+	return host, port.Int(), func() {
+		c.Terminate(ctx)
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	host, port, cleanup := setupMinio(t)
+	defer cleanup()
+
+	store := NewS3Storage(S3Options{
+		Endpoint:     "http://" + host + ":" + strconv.Itoa(port),
+		UsePathStyle: true,
+		Region:       minioRegion,
+		Bucket:       minioBucket,
+		AccessKey:    minioUser,
+		SecretKey:    minioPass,
+	})
+
+	// Test Set
+	err := store.Set("testKey", "testValue", false)
+	require.NoError(t, err)
+
+	// Test Get
+	val, err := store.Get("testKey", false)
+	require.NoError(t, err)
+	require.Equal(t, "testValue", val)
+
+	// Test Get not existing key
+	val, err = store.Get("nonExistingKey", false)
+	require.ErrorIs(t, ErrNotFound, err)
+	require.Equal(t, "", val)
+
+	require.NoError(t, store.Close())
+}
+
+func TestS3StorageExpirationAndPrefix(t *testing.T) {
+	host, port, cleanup := setupMinio(t)
+	defer cleanup()
+
+	opts := S3Options{
+		Endpoint:     "http://" + host + ":" + strconv.Itoa(port),
+		UsePathStyle: true,
+		Region:       minioRegion,
+		Bucket:       minioBucket,
+		AccessKey:    minioUser,
+		SecretKey:    minioPass,
+		Prefix:       "pastes/",
+		Expiration:   2 * time.Second,
+	}
+	NewS3Storage(opts).Close()
+
+	// Creating storage again must not fail on the existing bucket
+	store := NewS3Storage(opts)
+
+	require.NoError(t, store.Set("testKey", "testValue", false))
+	require.NoError(t, store.Set("persistentKey", "persistentValue", true))
+
+	val, err := store.Get("testKey", false)
+	require.NoError(t, err)
+	require.Equal(t, "testValue", val)
+
+	keys := []string{}
+	err = store.Iterate(func(entry Entry) error {
+		keys = append(keys, entry.Key)
+		return nil
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"testKey", "persistentKey"}, keys)
+
+	time.Sleep(3 * time.Second)
+
+	_, err = store.Get("testKey", false)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	val, err = store.Get("persistentKey", false)
+	require.NoError(t, err)
+	require.Equal(t, "persistentValue", val)
+
+	require.NoError(t, store.Close())
+}
@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ShardNode is a single named node of sharded storage
+// The name is the identity of the node for hashing, so it must stay stable.
+type ShardNode struct {
+	Name    string
+	Storage Storage
+}
+
+// ShardedStorage spreads keys across multiple storages using rendezvous hashing
+// Adding or removing a node only moves keys owned by that node, Rebalance moves
+// existing keys to their new owners.
+type ShardedStorage struct {
+	nodes []ShardNode
+}
+
+var (
+	_ Storage      = (*ShardedStorage)(nil)
+	_ Iterator     = (*ShardedStorage)(nil)
+	_ EntrySetter  = (*ShardedStorage)(nil)
+	_ Deleter      = (*ShardedStorage)(nil)
+	_ ViewConsumer = (*ShardedStorage)(nil)
+	_ RangeReader  = (*ShardedStorage)(nil)
+	_ Appender     = (*ShardedStorage)(nil)
+)
+
+// ShardedConfig is the configuration block of "sharded" storage
+type ShardedConfig struct {
+	Nodes []ShardNodeConfig `yaml:"nodes"`
+}
+
+// ShardNodeConfig is the configuration block of a single node of "sharded" storage
+// The whole block is kept, so it can be decoded by the backend of the node.
+type ShardNodeConfig struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+
+	raw *yaml.Node
+}
+
+// UnmarshalYAML keeps the raw configuration block of the node
+func (c *ShardNodeConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain ShardNodeConfig
+	if err := node.Decode((*plain)(c)); err != nil {
+		return err
+	}
+
+	c.raw = node
+	return nil
+}
+
+// Decode decodes the configuration block of the node into v
+func (c ShardNodeConfig) Decode(v any) error {
+	if c.raw == nil {
+		return nil
+	}
+
+	return c.raw.Decode(v)
+}
+
+func init() {
+	Register("sharded", func(cfg ShardedConfig, opts Options) (Storage, error) {
+		if len(cfg.Nodes) == 0 {
+			return nil, errors.New("sharded storage requires at least one node")
+		}
+
+		nodes := make([]ShardNode, 0, len(cfg.Nodes))
+		for i, nodeCfg := range cfg.Nodes {
+			name := nodeCfg.Name
+			if name == "" {
+				name = "node" + strconv.Itoa(i)
+			}
+
+			node, err := New(nodeCfg.Type, nodeCfg.Decode, opts)
+			if err != nil {
+				return nil, fmt.Errorf("node %s: %w", name, err)
+			}
+			nodes = append(nodes, ShardNode{Name: name, Storage: node})
+		}
+
+		return NewShardedStorage(nodes), nil
+	})
+}
+
+func NewShardedStorage(nodes []ShardNode) *ShardedStorage {
+	return &ShardedStorage{nodes: nodes}
+}
+
+// Node returns the node owning the key
+func (s *ShardedStorage) Node(key string) ShardNode {
+	var owner ShardNode
+	var best uint64
+
+	for i, node := range s.nodes {
+		if score := rendezvousScore(node.Name, key); i == 0 || score > best {
+			owner, best = node, score
+		}
+	}
+
+	return owner
+}
+
+func rendezvousScore(node string, key string) uint64 {
+	sum := md5.Sum([]byte(node + "\x00" + key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+func (s *ShardedStorage) Set(key string, value string, skip_expiration bool) error {
+	return s.Node(key).Storage.Set(key, value, skip_expiration)
+}
+
+func (s *ShardedStorage) Get(key string, skip_expiration bool) (string, error) {
+	return s.Node(key).Storage.Get(key, skip_expiration)
+}
+
+// Iterate walks entries of all nodes, every node has to support iteration
+func (s *ShardedStorage) Iterate(fn func(entry Entry) error) error {
+	for _, node := range s.nodes {
+		iterator, ok := node.Storage.(Iterator)
+		if !ok {
+			return fmt.Errorf("shard %q doesn't support iteration", node.Name)
+		}
+
+		if err := iterator.Iterate(fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ShardedStorage) SetEntry(entry Entry) error {
+	node := s.Node(entry.Key)
+
+	setter, ok := node.Storage.(EntrySetter)
+	if !ok {
+		return fmt.Errorf("shard %q doesn't support setting entries", node.Name)
+	}
+
+	if err := checkViews(node.Storage, entry); err != nil {
+		return err
+	}
+
+	return setter.SetEntry(entry)
+}
+
+func (s *ShardedStorage) Delete(key string) error {
+	node := s.Node(key)
+
+	deleter, ok := node.Storage.(Deleter)
+	if !ok {
+		return fmt.Errorf("shard %q doesn't support deletion", node.Name)
+	}
+
+	return deleter.Delete(key)
+}
+
+func (s *ShardedStorage) Consume(key string) (string, int, error) {
+	node := s.Node(key)
+
+	consumer, ok := node.Storage.(ViewConsumer)
+	if !ok {
+		return "", 0, fmt.Errorf("shard %q doesn't support view limits: %w", node.Name, errors.ErrUnsupported)
+	}
+
+	return consumer.Consume(key)
+}
+
+func (s *ShardedStorage) GetRange(key string, offset int64, length int64) (string, error) {
+	node := s.Node(key)
+
+	reader, ok := node.Storage.(RangeReader)
+	if !ok {
+		return "", fmt.Errorf("shard %q doesn't support ranged reads: %w", node.Name, errors.ErrUnsupported)
+	}
+
+	return reader.GetRange(key, offset, length)
+}
+
+func (s *ShardedStorage) Append(key string, value string) error {
+	node := s.Node(key)
+
+	appender, ok := node.Storage.(Appender)
+	if !ok {
+		return fmt.Errorf("shard %q doesn't support appending: %w", node.Name, errors.ErrUnsupported)
+	}
+
+	return appender.Append(key, value)
+}
+
+// Rebalance moves every entry which is not stored on its owner node
+// It returns the number of moved entries. Nodes have to support iteration,
+// setting entries and deletion.
+func (s *ShardedStorage) Rebalance() (int, error) {
+	moved := 0
+
+	for _, node := range s.nodes {
+		iterator, ok := node.Storage.(Iterator)
+		if !ok {
+			return moved, fmt.Errorf("shard %q doesn't support iteration", node.Name)
+		}
+
+		deleter, ok := node.Storage.(Deleter)
+		if !ok {
+			return moved, fmt.Errorf("shard %q doesn't support deletion", node.Name)
+		}
+
+		err := iterator.Iterate(func(entry Entry) error {
+			if s.Node(entry.Key).Name == node.Name {
+				return nil
+			}
+
+			if err := s.SetEntry(entry); err != nil {
+				return err
+			}
+
+			if err := deleter.Delete(entry.Key); err != nil {
+				return err
+			}
+
+			moved++
+			return nil
+		})
+		if err != nil {
+			return moved, err
+		}
+	}
+
+	return moved, nil
+}
+
+func (s *ShardedStorage) Close() error {
+	var errs []error
+	for _, node := range s.nodes {
+		if err := node.Storage.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("shard %q: %w", node.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
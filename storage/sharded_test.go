@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setupShards(t *testing.T, names ...string) []ShardNode {
+	nodes := make([]ShardNode, 0, len(names))
+	for _, name := range names {
+		nodes = append(nodes, ShardNode{Name: name, Storage: NewFileStorage(t.TempDir(), 0)})
+	}
+	return nodes
+}
+
+func TestShardedStorage(t *testing.T) {
+	nodes := setupShards(t, "first", "second", "third")
+	store := NewShardedStorage(nodes)
+
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("key%d", i)
+		require.NoError(t, store.Set(key, "value"+key, false))
+	}
+
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("key%d", i)
+
+		val, err := store.Get(key, false)
+		require.NoError(t, err)
+		require.Equal(t, "value"+key, val)
+
+		// Key is stored only on its owner
+		val, err = store.Node(key).Storage.Get(key, false)
+		require.NoError(t, err)
+		require.Equal(t, "value"+key, val)
+	}
+
+	// Every node gets a fair share of keys
+	for _, node := range nodes {
+		count := 0
+		require.NoError(t, node.Storage.(Iterator).Iterate(func(Entry) error {
+			count++
+			return nil
+		}))
+		require.Greater(t, count, 50, node.Name)
+	}
+
+	require.NoError(t, store.Close())
+}
+
+func TestShardedStorageRebalance(t *testing.T) {
+	nodes := setupShards(t, "first", "second")
+	store := NewShardedStorage(nodes)
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		require.NoError(t, store.Set(key, "value"+key, false))
+	}
+
+	// Add a node, keys which it owns now have to be moved
+	nodes = append(nodes, setupShards(t, "third")...)
+	store = NewShardedStorage(nodes)
+
+	expected := 0
+	for i := 0; i < 100; i++ {
+		if store.Node(fmt.Sprintf("key%d", i)).Name == "third" {
+			expected++
+		}
+	}
+	require.Greater(t, expected, 0)
+
+	moved, err := store.Rebalance()
+	require.NoError(t, err)
+	require.Equal(t, expected, moved)
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+
+		val, err := store.Get(key, false)
+		require.NoError(t, err)
+		require.Equal(t, "value"+key, val)
+	}
+
+	// Nothing left to move
+	moved, err = store.Rebalance()
+	require.NoError(t, err)
+	require.Zero(t, moved)
+
+	require.NoError(t, store.Close())
+}
@@ -0,0 +1,644 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+// spoolFileSuffix is the suffix of spooled documents
+const spoolFileSuffix = ".spool"
+
+// DefaultSpoolReplayInterval is the time between replay attempts when none is configured
+const DefaultSpoolReplayInterval = 10 * time.Second
+
+// spoolGuardStripes is the number of guards keys of the spool are spread over
+const spoolGuardStripes = 64
+
+// ErrSpoolFull is returned by Set when the backend is unavailable and the spool has no room left
+var ErrSpoolFull = errors.New("spool is full")
+
+var (
+	spoolDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "hastebin_spool_depth",
+		Help: "The number of documents waiting in the spool",
+	})
+
+	spoolBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "hastebin_spool_bytes",
+		Help: "The total size of documents waiting in the spool",
+	})
+
+	spoolReplayed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "hastebin_spool_replayed",
+		Help: "The total number of spooled documents written to the storage",
+	})
+)
+
+// SpoolOptions configures the spool
+type SpoolOptions struct {
+	// Path is the directory spooled documents are kept in
+	Path string
+
+	// MaxSize is the maximum total size of spooled documents in bytes, 0 means no limit
+	MaxSize int64
+
+	// ReplayInterval is the time between attempts to write spooled documents into the storage
+	// 0 means DefaultSpoolReplayInterval.
+	ReplayInterval time.Duration
+}
+
+// SpoolStorage keeps documents on local disk when the wrapped storage fails to store them
+// Spooled documents are served from the spool and written to the storage in the
+// background once it recovers. Expiration of a document spooled by Set starts when it is
+// replayed, entries spooled by SetEntry keep their own.
+type SpoolStorage struct {
+	Storage
+
+	path    string
+	maxSize int64
+
+	mu      sync.Mutex
+	entries map[string]spoolEntry
+	size    int64
+	seq     int64
+
+	// guards serialize writes of a key with its replay by hashes of keys, so replay never
+	// overwrites a document stored in the meantime
+	guards [spoolGuardStripes]sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type spoolEntry struct {
+	file string
+	size int64
+}
+
+// spoolHeader is the first line of a spooled document, raw content follows it
+type spoolHeader struct {
+	Key            string `json:"key"`
+	SkipExpiration bool   `json:"skip_expiration"`
+
+	// Entry is set for documents spooled by SetEntry, they keep their own expiration
+	Entry bool `json:"entry,omitempty"`
+
+	// ExpiresAt is the expiration unix timestamp of an entry, 0 means no expiration
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+
+	// TTL is the TTL of an entry in seconds
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+// Returns the entry of a document spooled by SetEntry
+func (h spoolHeader) entry(value string) Entry {
+	entry := Entry{Key: h.Key, Value: value, TTL: time.Duration(h.TTL) * time.Second}
+	if h.ExpiresAt != 0 {
+		entry.Expiration = time.Unix(h.ExpiresAt, 0)
+	}
+
+	return entry
+}
+
+// Reports whether the document was spooled by SetEntry and has expired since
+func (h spoolHeader) expired(now time.Time) bool {
+	return h.Entry && h.ExpiresAt != 0 && now.Unix() >= h.ExpiresAt
+}
+
+var (
+	_ Storage      = (*SpoolStorage)(nil)
+	_ Iterator     = (*SpoolStorage)(nil)
+	_ EntrySetter  = (*SpoolStorage)(nil)
+	_ Deleter      = (*SpoolStorage)(nil)
+	_ ViewConsumer = (*SpoolStorage)(nil)
+	_ RangeReader  = (*SpoolStorage)(nil)
+	_ Appender     = (*SpoolStorage)(nil)
+)
+
+// NewSpoolStorage wraps storage with a spool, documents left in the spool by a previous run are replayed too
+func NewSpoolStorage(storage Storage, opts SpoolOptions) *SpoolStorage {
+	if err := os.MkdirAll(opts.Path, 0700); err != nil {
+		log.Fatal().Err(err).Str("path", opts.Path).Msg("Failed to create spool directory")
+	}
+
+	s := &SpoolStorage{
+		Storage: storage,
+		path:    opts.Path,
+		maxSize: opts.MaxSize,
+		entries: map[string]spoolEntry{},
+		seq:     time.Now().UnixNano(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	if err := s.load(); err != nil {
+		log.Fatal().Err(err).Str("path", opts.Path).Msg("Failed to load spool")
+	}
+
+	interval := opts.ReplayInterval
+	if interval <= 0 {
+		interval = DefaultSpoolReplayInterval
+	}
+
+	go s.run(interval)
+
+	return s
+}
+
+// Locks writes of the key and returns the function unlocking them
+func (s *SpoolStorage) guard(key string) func() {
+	sum := md5.Sum([]byte(key))
+	mu := &s.guards[binary.BigEndian.Uint16(sum[:])%spoolGuardStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+func (s *SpoolStorage) Set(key string, value string, skip_expiration bool) error {
+	defer s.guard(key)()
+
+	err := s.Storage.Set(key, value, skip_expiration)
+	if err == nil {
+		// A stored document is newer than a spooled one
+		s.remove(key, "")
+		return nil
+	}
+
+	log.Warn().Err(err).Str("key", key).Msg("Failed to store document, spooling it")
+
+	if spoolErr := s.spool(spoolHeader{Key: key, SkipExpiration: skip_expiration}, value); spoolErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to spool document: %w", spoolErr))
+	}
+
+	return nil
+}
+
+// SetEntry stores entry in the storage, or spools it with its expiration when the storage fails
+func (s *SpoolStorage) SetEntry(entry Entry) error {
+	setter, ok := s.Storage.(EntrySetter)
+	if !ok {
+		return fmt.Errorf("storage %T doesn't support setting entries", s.Storage)
+	}
+
+	if err := checkViews(s.Storage, entry); err != nil {
+		return err
+	}
+
+	defer s.guard(entry.Key)()
+
+	err := setter.SetEntry(entry)
+	if err == nil {
+		s.remove(entry.Key, "")
+		return nil
+	}
+
+	// Entries limited by views are secrets which must not be left on local disk
+	if entry.Views > 0 {
+		return err
+	}
+
+	log.Warn().Err(err).Str("key", entry.Key).Msg("Failed to store document, spooling it")
+
+	header := spoolHeader{Key: entry.Key, Entry: true, TTL: int64(entry.TTL / time.Second)}
+	if !entry.Expiration.IsZero() {
+		header.ExpiresAt = entry.Expiration.Unix()
+	}
+
+	if spoolErr := s.spool(header, entry.Value); spoolErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to spool document: %w", spoolErr))
+	}
+
+	return nil
+}
+
+func (s *SpoolStorage) Get(key string, skip_expiration bool) (string, error) {
+	value, spooled, err := s.spooled(key)
+	if spooled || err != nil {
+		return value, err
+	}
+
+	return s.Storage.Get(key, skip_expiration)
+}
+
+// Reads the spooled document of the key, false means it is not spooled
+func (s *SpoolStorage) spooled(key string) (string, bool, error) {
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	s.mu.Unlock()
+
+	if !ok {
+		return "", false, nil
+	}
+
+	header, value, err := s.read(entry.file)
+	if err == nil && header.expired(time.Now()) {
+		s.remove(key, entry.file)
+		return "", true, ErrNotFound
+	} else if err == nil {
+		return value, true, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", true, err
+	}
+
+	// Replayed in the meantime
+	return "", false, nil
+}
+
+// GetRange reads a range of the spooled document of the key, or of the document in the storage
+func (s *SpoolStorage) GetRange(key string, offset int64, length int64) (string, error) {
+	value, spooled, err := s.spooled(key)
+	if !spooled {
+		return getRange(s.Storage, key, offset, length)
+	} else if err != nil {
+		return "", err
+	}
+
+	value = value[min(offset, int64(len(value))):]
+	if length >= 0 {
+		value = value[:min(length, int64(len(value)))]
+	}
+
+	return value, nil
+}
+
+// Append appends to the spooled document of the key, or to the document in the storage
+func (s *SpoolStorage) Append(key string, value string) error {
+	defer s.guard(key)()
+
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	s.mu.Unlock()
+
+	if ok {
+		header, current, err := s.read(entry.file)
+		if err == nil {
+			return s.spool(header, current+value)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return appendTo(s.Storage, key, value)
+}
+
+// Iterate walks the storage and then spooled documents, which replace documents of their keys
+func (s *SpoolStorage) Iterate(fn func(entry Entry) error) error {
+	iterator, ok := s.Storage.(Iterator)
+	if !ok {
+		return fmt.Errorf("storage %T doesn't support iteration: %w", s.Storage, errors.ErrUnsupported)
+	}
+
+	s.mu.Lock()
+	files := make(map[string]string, len(s.entries))
+	for key, entry := range s.entries {
+		files[key] = entry.file
+	}
+	s.mu.Unlock()
+
+	err := iterator.Iterate(func(entry Entry) error {
+		if _, ok := files[entry.Key]; ok {
+			return nil
+		}
+
+		return fn(entry)
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, file := range files {
+		header, value, err := s.read(file)
+		if errors.Is(err, os.ErrNotExist) {
+			// Replayed in the meantime, after the storage was walked
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if header.expired(now) {
+			continue
+		}
+
+		entry := header.entry(value)
+		if !header.Entry {
+			entry = Entry{Key: header.Key, Value: value}
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Consume takes a view of the key, spooled documents are never limited by views
+func (s *SpoolStorage) Consume(key string) (string, int, error) {
+	s.mu.Lock()
+	_, ok := s.entries[key]
+	s.mu.Unlock()
+
+	if ok {
+		value, err := s.Get(key, true)
+		return value, -1, err
+	}
+
+	return consume(s.Storage, key)
+}
+
+func (s *SpoolStorage) Delete(key string) error {
+	defer s.guard(key)()
+
+	s.remove(key, "")
+
+	deleter, ok := s.Storage.(Deleter)
+	if !ok {
+		return fmt.Errorf("storage %T doesn't support delete", s.Storage)
+	}
+
+	return deleter.Delete(key)
+}
+
+// Depth returns the number of spooled documents
+func (s *SpoolStorage) Depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries)
+}
+
+// Replay writes spooled documents into the storage in the order they were spooled
+// It stops at the first failure, the remaining documents are retried later.
+func (s *SpoolStorage) Replay() (int, error) {
+	s.mu.Lock()
+	files := make([]string, 0, len(s.entries))
+	for _, entry := range s.entries {
+		files = append(files, entry.file)
+	}
+	s.mu.Unlock()
+
+	// File names start with a sequence number
+	slices.Sort(files)
+
+	replayed := 0
+	for _, file := range files {
+		ok, err := s.replayFile(file)
+		if err != nil {
+			return replayed, err
+		}
+
+		if ok {
+			spoolReplayed.Inc()
+			replayed++
+		}
+	}
+
+	return replayed, nil
+}
+
+// Writes the spooled document into the storage unless it was replaced since, and removes it
+// from the spool. False means there was nothing to write.
+func (s *SpoolStorage) replayFile(file string) (bool, error) {
+	header, value, err := s.read(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	defer s.guard(header.Key)()
+
+	// Documents stored or spooled again while the file was read are newer
+	s.mu.Lock()
+	current := s.entries[header.Key].file == file
+	s.mu.Unlock()
+
+	if !current {
+		return false, nil
+	}
+
+	if header.expired(time.Now()) {
+		s.remove(header.Key, file)
+		return false, nil
+	}
+
+	if err := s.replay(header, value); err != nil {
+		return false, err
+	}
+
+	s.remove(header.Key, file)
+	return true, nil
+}
+
+// Close stops replaying and closes the wrapped storage, spooled documents stay on disk
+func (s *SpoolStorage) Close() error {
+	close(s.stop)
+	<-s.done
+
+	return s.Storage.Close()
+}
+
+func (s *SpoolStorage) run(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		if s.Depth() == 0 {
+			continue
+		}
+
+		replayed, err := s.Replay()
+		if replayed > 0 {
+			log.Info().Int("count", replayed).Int("remaining", s.Depth()).Msg("Replayed spooled documents")
+		}
+		if err != nil {
+			log.Warn().Err(err).Int("remaining", s.Depth()).Msg("Failed to replay spooled documents")
+		}
+	}
+}
+
+// Writes spooled document into the storage
+func (s *SpoolStorage) replay(header spoolHeader, value string) error {
+	if !header.Entry {
+		return s.Storage.Set(header.Key, value, header.SkipExpiration)
+	}
+
+	setter, ok := s.Storage.(EntrySetter)
+	if !ok {
+		return fmt.Errorf("storage %T doesn't support setting entries", s.Storage)
+	}
+
+	return setter.SetEntry(header.entry(value))
+}
+
+// Writes document into the spool, replacing previously spooled document with the same key
+func (s *SpoolStorage) spool(header spoolHeader, value string) error {
+	key := header.Key
+
+	line, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, 0, len(line)+1+len(value))
+	data = append(data, line...)
+	data = append(data, '\n')
+	data = append(data, value...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, replaced := s.entries[key]
+	size := s.size + int64(len(data))
+	if replaced {
+		size -= previous.size
+	}
+
+	if s.maxSize > 0 && size > s.maxSize {
+		return ErrSpoolFull
+	}
+
+	s.seq++
+	file := filepath.Join(s.path, fmt.Sprintf("%020d-%s%s", s.seq, md5Hex(key), spoolFileSuffix))
+
+	// Write into a temporary file first, so a crash never leaves a partial document behind
+	if err := os.WriteFile(file+".tmp", data, 0600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(file+".tmp", file); err != nil {
+		os.Remove(file + ".tmp")
+		return err
+	}
+
+	if replaced {
+		os.Remove(previous.file)
+	}
+
+	s.entries[key] = spoolEntry{file: file, size: int64(len(data))}
+	s.size = size
+	s.updateMetrics()
+
+	return nil
+}
+
+// Removes spooled document of the key, only when it is still the given file if it is not empty
+func (s *SpoolStorage) remove(key string, file string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || (file != "" && entry.file != file) {
+		return
+	}
+
+	if err := os.Remove(entry.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Error().Err(err).Str("file", entry.file).Msg("Failed to remove spooled document")
+	}
+
+	delete(s.entries, key)
+	s.size -= entry.size
+	s.updateMetrics()
+}
+
+func (s *SpoolStorage) read(file string) (spoolHeader, string, error) {
+	var header spoolHeader
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return header, "", err
+	}
+
+	line, value, ok := bytes.Cut(data, []byte{'\n'})
+	if !ok {
+		return header, "", fmt.Errorf("malformed spooled document %s", file)
+	}
+
+	if err := json.Unmarshal(line, &header); err != nil {
+		return header, "", fmt.Errorf("malformed spooled document %s: %w", file, err)
+	}
+
+	return header, string(value), nil
+}
+
+// Loads documents spooled by a previous run
+func (s *SpoolStorage) load() error {
+	files, err := os.ReadDir(s.path)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, spoolFileSuffix) {
+			continue
+		}
+
+		path := filepath.Join(s.path, name)
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		var header spoolHeader
+		line, err := bufio.NewReader(f).ReadBytes('\n')
+		if err == nil {
+			err = json.Unmarshal(line, &header)
+		}
+
+		info, statErr := f.Stat()
+		f.Close()
+
+		if err != nil || statErr != nil {
+			log.Warn().Str("file", path).Msg("Skipping malformed spooled document")
+			continue
+		}
+
+		// Keep sequence numbers growing across restarts
+		if seq, err := strconv.ParseInt(strings.SplitN(name, "-", 2)[0], 10, 64); err == nil && seq > s.seq {
+			s.seq = seq
+		}
+
+		// Files are listed in spool order, so a later document of the same key wins
+		if previous, ok := s.entries[header.Key]; ok {
+			os.Remove(previous.file)
+			s.size -= previous.size
+		}
+
+		s.entries[header.Key] = spoolEntry{file: path, size: info.Size()}
+		s.size += info.Size()
+	}
+
+	s.updateMetrics()
+	return nil
+}
+
+func (s *SpoolStorage) updateMetrics() {
+	spoolDepth.Set(float64(len(s.entries)))
+	spoolBytes.Set(float64(s.size))
+}
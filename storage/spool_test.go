@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flakyStorage fails every write while it is down
+type flakyStorage struct {
+	Storage
+
+	mu      sync.Mutex
+	down    bool
+	entries []Entry
+}
+
+func (s *flakyStorage) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func (s *flakyStorage) Set(key string, value string, skip_expiration bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.down {
+		return errors.New("storage is down")
+	}
+	return s.Storage.Set(key, value, skip_expiration)
+}
+
+func (s *flakyStorage) SetEntry(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.down {
+		return errors.New("storage is down")
+	}
+
+	s.entries = append(s.entries, entry)
+	return s.Storage.(EntrySetter).SetEntry(entry)
+}
+
+func (s *flakyStorage) Iterate(fn func(entry Entry) error) error {
+	return s.Storage.(Iterator).Iterate(fn)
+}
+
+func TestSpoolStorage(t *testing.T) {
+	backend := &flakyStorage{Storage: NewFileStorage(t.TempDir(), 0), down: true}
+	spoolDir := t.TempDir()
+
+	store := NewSpoolStorage(backend, SpoolOptions{Path: spoolDir, ReplayInterval: time.Hour})
+
+	// Writes are spooled and served from the spool while the backend is down
+	require.NoError(t, store.Set("first", "first value", false))
+	require.NoError(t, store.Set("second", "\x00binary\xff", true))
+	require.NoError(t, store.Set("first", "first value updated", false))
+	require.Equal(t, 2, store.Depth())
+
+	val, err := store.Get("first", false)
+	require.NoError(t, err)
+	require.Equal(t, "first value updated", val)
+
+	_, err = backend.Storage.Get("first", false)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Replay fails while the backend is still down
+	replayed, err := store.Replay()
+	require.Error(t, err)
+	require.Equal(t, 0, replayed)
+	require.Equal(t, 2, store.Depth())
+
+	backend.setDown(false)
+
+	replayed, err = store.Replay()
+	require.NoError(t, err)
+	require.Equal(t, 2, replayed)
+	require.Equal(t, 0, store.Depth())
+
+	val, err = backend.Storage.Get("first", false)
+	require.NoError(t, err)
+	require.Equal(t, "first value updated", val)
+
+	val, err = backend.Storage.Get("second", false)
+	require.NoError(t, err)
+	require.Equal(t, "\x00binary\xff", val)
+
+	files, err := os.ReadDir(spoolDir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	require.NoError(t, store.Close())
+}
+
+func TestSpoolStorageMaxSize(t *testing.T) {
+	backend := &flakyStorage{Storage: NewFileStorage(t.TempDir(), 0), down: true}
+	store := NewSpoolStorage(backend, SpoolOptions{Path: t.TempDir(), MaxSize: 64, ReplayInterval: time.Hour})
+
+	require.NoError(t, store.Set("small", "value", false))
+
+	err := store.Set("large", string(make([]byte, 64)), false)
+	require.ErrorIs(t, err, ErrSpoolFull)
+
+	_, err = store.Get("large", false)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, store.Close())
+}
+
+func TestSpoolStorageRestart(t *testing.T) {
+	backend := &flakyStorage{Storage: NewFileStorage(t.TempDir(), 0), down: true}
+	spoolDir := t.TempDir()
+
+	store := NewSpoolStorage(backend, SpoolOptions{Path: spoolDir, ReplayInterval: time.Hour})
+	require.NoError(t, store.Set("first", "first value", false))
+	require.NoError(t, store.Close())
+
+	// Spooled documents survive restart and are replayed in the background
+	backend.setDown(false)
+	store = NewSpoolStorage(backend, SpoolOptions{Path: spoolDir, ReplayInterval: 10 * time.Millisecond})
+	require.Eventually(t, func() bool { return store.Depth() == 0 }, time.Second, 10*time.Millisecond)
+
+	val, err := backend.Storage.Get("first", false)
+	require.NoError(t, err)
+	require.Equal(t, "first value", val)
+
+	require.NoError(t, store.Close())
+}
+
+func TestSpoolStorageSetEntry(t *testing.T) {
+	backend := &flakyStorage{Storage: NewFileStorage(t.TempDir(), 0), down: true}
+	store := NewSpoolStorage(backend, SpoolOptions{Path: t.TempDir(), ReplayInterval: time.Hour})
+
+	expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.NoError(t, store.SetEntry(Entry{Key: "own", Value: "own ttl", Expiration: expiration, TTL: time.Hour}))
+	require.NoError(t, store.SetEntry(Entry{Key: "expired", Value: "expired", Expiration: time.Now().Add(-time.Second)}))
+	require.Equal(t, 2, store.Depth())
+
+	val, err := store.Get("own", false)
+	require.NoError(t, err)
+	require.Equal(t, "own ttl", val)
+
+	// Entries expiring in the spool are dropped
+	_, err = store.Get("expired", false)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Equal(t, 1, store.Depth())
+
+	// Replayed entries keep their expiration and TTL
+	backend.setDown(false)
+
+	replayed, err := store.Replay()
+	require.NoError(t, err)
+	require.Equal(t, 1, replayed)
+	require.Equal(t, []Entry{{Key: "own", Value: "own ttl", Expiration: expiration, TTL: time.Hour}}, backend.entries)
+
+	require.NoError(t, store.Close())
+}
+
+func TestSpoolStorageOptionalInterfaces(t *testing.T) {
+	backend := &flakyStorage{Storage: NewFileStorage(t.TempDir(), 0)}
+	store := NewSpoolStorage(backend, SpoolOptions{Path: t.TempDir(), ReplayInterval: time.Hour})
+
+	require.NoError(t, store.Set("stored", "stored value", false))
+
+	backend.setDown(true)
+	require.NoError(t, store.Set("spooled", "spooled value", false))
+
+	// Spooled documents are read and appended in the spool
+	val, err := store.GetRange("spooled", 8, 3)
+	require.NoError(t, err)
+	require.Equal(t, "val", val)
+
+	val, err = store.GetRange("spooled", 8, -1)
+	require.NoError(t, err)
+	require.Equal(t, "value", val)
+
+	val, err = store.GetRange("spooled", 100, -1)
+	require.NoError(t, err)
+	require.Empty(t, val)
+
+	require.NoError(t, store.Append("spooled", " appended"))
+
+	val, err = store.Get("spooled", false)
+	require.NoError(t, err)
+	require.Equal(t, "spooled value appended", val)
+
+	var entries []Entry
+	require.NoError(t, store.Iterate(func(entry Entry) error {
+		entries = append(entries, Entry{Key: entry.Key, Value: entry.Value})
+		return nil
+	}))
+	require.ElementsMatch(t, []Entry{
+		{Key: "stored", Value: "stored value"},
+		{Key: "spooled", Value: "spooled value appended"},
+	}, entries)
+
+	// Other documents are left to the storage, which fails them by itself
+	_, err = store.GetRange("stored", 0, 6)
+	require.ErrorIs(t, err, errors.ErrUnsupported)
+
+	err = store.Append("stored", " appended")
+	require.ErrorIs(t, err, errors.ErrUnsupported)
+
+	require.NoError(t, store.Close())
+}
+
+func TestSpoolStorageForwarding(t *testing.T) {
+	store := NewSpoolStorage(NewFileStorage(t.TempDir(), 0), SpoolOptions{Path: t.TempDir(), ReplayInterval: time.Hour})
+
+	require.NoError(t, store.Set("stored", "stored value", false))
+	require.NoError(t, store.Append("stored", " appended"))
+
+	val, err := store.GetRange("stored", 7, 5)
+	require.NoError(t, err)
+	require.Equal(t, "value", val)
+
+	val, err = store.Get("stored", false)
+	require.NoError(t, err)
+	require.Equal(t, "stored value appended", val)
+
+	require.ErrorIs(t, store.Append("missing", "value"), ErrNotFound)
+
+	require.NoError(t, store.Close())
+}
+
+func TestSpoolStorageReplayRace(t *testing.T) {
+	backend := &flakyStorage{Storage: NewFileStorage(t.TempDir(), 0)}
+	store := NewSpoolStorage(backend, SpoolOptions{Path: t.TempDir(), ReplayInterval: time.Hour})
+
+	for i := range 200 {
+		backend.setDown(true)
+		require.NoError(t, store.Set("key", "spooled", false))
+		backend.setDown(false)
+
+		// A document stored while the spooled one is replayed is newer and must survive
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.Replay()
+		}()
+
+		stored := "stored " + strconv.Itoa(i)
+		require.NoError(t, store.Set("key", stored, false))
+		wg.Wait()
+
+		val, err := backend.Storage.Get("key", false)
+		require.NoError(t, err)
+		require.Equal(t, stored, val)
+		require.Equal(t, 0, store.Depth())
+	}
+
+	require.NoError(t, store.Close())
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned by Get when the key doesn't exist or has expired
+var ErrNotFound = errors.New("not found")
+
+type Storage interface {
+	Set(key string, value string, skip_expiration bool) error
+	Get(key string, skip_expiration bool) (string, error)
+	Close() error
+}
+
+// Entry is a single stored document together with its metadata
+type Entry struct {
+	Key   string
+	Value string
+
+	// Expiration is the point in time when the entry expires
+	// Zero value means the entry never expires.
+	Expiration time.Time
+
+	// TTL is the lifetime the expiration is extended to when the entry is read
+	// 0 means the storage-wide expiration. Entries which never expire ignore it.
+	TTL time.Duration
+
+	// Views is the number of reads left through ViewConsumer, 0 means unlimited
+	// Storages which don't implement ViewConsumer ignore it, storages wrapping others
+	// reject it with errors.ErrUnsupported when the wrapped one can't limit views.
+	Views int
+}
+
+// Returns the lifetime an expiring entry is extended to, 0 means it is not extended
+func entryTTL(ttl time.Duration, expiration time.Duration) time.Duration {
+	if ttl > 0 {
+		return ttl
+	}
+
+	return expiration
+}
+
+// Iterator is implemented by storages which are able to enumerate all stored entries
+type Iterator interface {
+	// Iterate calls fn for every entry which has not expired yet
+	// Iteration stops at the first error returned by fn.
+	Iterate(fn func(entry Entry) error) error
+}
+
+// EntrySetter is implemented by storages which are able to store an entry
+// with an explicit expiration and TTL instead of the storage-wide one
+type EntrySetter interface {
+	SetEntry(entry Entry) error
+}
+
+// Deleter is implemented by storages which are able to remove an entry
+// Deleting a key which doesn't exist is not an error.
+type Deleter interface {
+	Delete(key string) error
+}
+
+// ViewConsumer is implemented by storages which are able to limit the number of reads of an entry
+type ViewConsumer interface {
+	// Consume reads the entry and atomically takes one of its views, the entry is removed
+	// together with its last view, so concurrent readers never see more views than stored.
+	// It returns the views left, -1 for entries stored without a limit. Consume doesn't
+	// extend expiration. Storages wrapping others return errors.ErrUnsupported when the
+	// wrapped one can't limit views.
+	Consume(key string) (string, int, error)
+}
+
+// RangeReader is implemented by storages which are able to read a part of an entry without
+// loading all of it
+type RangeReader interface {
+	// GetRange returns length bytes of the entry starting at offset, negative length reads
+	// to the end of the entry and offsets past the end return an empty value. Ranged reads
+	// don't extend expiration. Storages wrapping others return errors.ErrUnsupported when
+	// the wrapped one can't read ranges.
+	GetRange(key string, offset int64, length int64) (string, error)
+}
+
+// Appender is implemented by storages which are able to append to an entry without rewriting it
+type Appender interface {
+	// Append appends value to the existing entry, keeping its expiration. Appending to a
+	// missing entry returns ErrNotFound. Storages wrapping others return errors.ErrUnsupported
+	// when the wrapped one can't append.
+	Append(key string, value string) error
+}
+
+// Appends to the key in a storage which may not implement Appender
+func appendTo(store Storage, key string, value string) error {
+	appender, ok := store.(Appender)
+	if !ok {
+		return fmt.Errorf("storage %T doesn't support appending: %w", store, errors.ErrUnsupported)
+	}
+
+	return appender.Append(key, value)
+}
+
+// Reads a range of the key from a storage which may not implement RangeReader
+func getRange(store Storage, key string, offset int64, length int64) (string, error) {
+	reader, ok := store.(RangeReader)
+	if !ok {
+		return "", fmt.Errorf("storage %T doesn't support ranged reads: %w", store, errors.ErrUnsupported)
+	}
+
+	return reader.GetRange(key, offset, length)
+}
+
+// Takes a view of the key from a storage which may not implement ViewConsumer
+func consume(store Storage, key string) (string, int, error) {
+	consumer, ok := store.(ViewConsumer)
+	if !ok {
+		return "", 0, fmt.Errorf("storage %T doesn't support view limits: %w", store, errors.ErrUnsupported)
+	}
+
+	return consumer.Consume(key)
+}
+
+// Rejects entries limited by views for a storage which would store them without the limit
+func checkViews(store Storage, entry Entry) error {
+	if _, ok := store.(ViewConsumer); entry.Views > 0 && !ok {
+		return fmt.Errorf("storage %T doesn't support view limits: %w", store, errors.ErrUnsupported)
+	}
+
+	return nil
+}
@@ -0,0 +1,528 @@
+// Package storagetest implements a behavioural test suite for storage.Storage implementations
+//
+// Every in-tree backend runs the suite, third-party backends registered with
+// storage.Register should run it too:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T, expiration time.Duration) storage.Storage {
+//			return NewPrivateStorage(expiration)
+//		}, storagetest.Capabilities{Expiration: true, SlidingExpiration: true})
+//	}
+package storagetest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/armbian/ansi-hastebin/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// Expiration is the storage-wide expiration used by expiry tests
+// Several backends keep expiration with one second precision, so it spans a few seconds.
+const Expiration = 3 * time.Second
+
+// DefaultMaxValueSize is the size of the large value test, it matches the default maximum paste length
+const DefaultMaxValueSize = 4000000
+
+// Factory creates the storage under test with the given storage-wide expiration, 0 means no expiration
+// Storages created by one factory may share the same backend, every test uses its own keys.
+type Factory func(t *testing.T, expiration time.Duration) storage.Storage
+
+// Capabilities describe optional behaviour of the storage under test
+type Capabilities struct {
+	// Expiration is set for storages which expire entries
+	Expiration bool
+
+	// SlidingExpiration is set for storages which extend lifetime of an entry when it is read
+	SlidingExpiration bool
+
+	// MaxValueSize is the size of the large value test, 0 means DefaultMaxValueSize
+	MaxValueSize int
+}
+
+// Run runs the whole suite against storages created by factory
+func Run(t *testing.T, factory Factory, caps Capabilities) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, factory Factory, caps Capabilities)
+		skip bool
+	}{
+		{name: "SetGet", fn: testSetGet},
+		{name: "MissingKey", fn: testMissingKey},
+		{name: "Delete", fn: testDelete},
+		{name: "LargeValue", fn: testLargeValue},
+		{name: "BinaryContent", fn: testBinaryContent},
+		{name: "Concurrency", fn: testConcurrency},
+		{name: "NoExpiration", fn: testNoExpiration},
+		{name: "Expiry", fn: testExpiry, skip: !caps.Expiration},
+		{name: "SkipExpiration", fn: testSkipExpiration, skip: !caps.Expiration},
+		{name: "SlidingRefresh", fn: testSlidingRefresh, skip: !caps.SlidingExpiration},
+		{name: "EntryTTL", fn: testEntryTTL, skip: !caps.SlidingExpiration},
+		{name: "Views", fn: testViews},
+		{name: "ViewsConcurrency", fn: testViewsConcurrency},
+		{name: "Range", fn: testRange},
+		{name: "Append", fn: testAppend},
+	}
+
+	// Tests mostly wait for entries to expire, so run them in parallel. The group
+	// returns once all of them finish, before the caller releases the backend.
+	t.Run("group", func(t *testing.T) {
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				if test.skip {
+					t.Skip("not supported by the storage")
+				}
+
+				t.Parallel()
+				test.fn(t, factory, caps)
+			})
+		}
+	})
+}
+
+// Returns a key unique to the test, so tests may share the backend
+func key(t *testing.T, name string) string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+
+	test := t.Name()
+	test = test[strings.LastIndex(test, "/")+1:]
+
+	return fmt.Sprintf("%s-%s-%s", test, name, hex.EncodeToString(suffix))
+}
+
+// Creates the storage and closes it at the end of the test
+func open(t *testing.T, factory Factory, expiration time.Duration) storage.Storage {
+	store := factory(t, expiration)
+	require.NotNil(t, store)
+
+	t.Cleanup(func() {
+		require.NoError(t, store.Close())
+	})
+
+	return store
+}
+
+func testSetGet(t *testing.T, factory Factory, _ Capabilities) {
+	store := open(t, factory, 0)
+	k := key(t, "key")
+
+	require.NoError(t, store.Set(k, "value", false))
+
+	val, err := store.Get(k, false)
+	require.NoError(t, err)
+	require.Equal(t, "value", val)
+
+	// Setting an existing key replaces its value
+	require.NoError(t, store.Set(k, "other value", false))
+
+	val, err = store.Get(k, false)
+	require.NoError(t, err)
+	require.Equal(t, "other value", val)
+
+	val, err = store.Get(k, true)
+	require.NoError(t, err)
+	require.Equal(t, "other value", val)
+}
+
+func testMissingKey(t *testing.T, factory Factory, _ Capabilities) {
+	store := open(t, factory, 0)
+
+	val, err := store.Get(key(t, "missing"), false)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	require.Empty(t, val)
+
+	val, err = store.Get(key(t, "missing"), true)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	require.Empty(t, val)
+}
+
+func testDelete(t *testing.T, factory Factory, _ Capabilities) {
+	store := open(t, factory, 0)
+
+	deleter, ok := store.(storage.Deleter)
+	if !ok {
+		t.Skip("storage doesn't implement storage.Deleter")
+	}
+
+	k := key(t, "key")
+	require.NoError(t, store.Set(k, "value", false))
+	require.NoError(t, deleter.Delete(k))
+
+	_, err := store.Get(k, false)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	// Deleting a missing key is not an error
+	require.NoError(t, deleter.Delete(k))
+}
+
+func testLargeValue(t *testing.T, factory Factory, caps Capabilities) {
+	store := open(t, factory, 0)
+
+	size := caps.MaxValueSize
+	if size == 0 {
+		size = DefaultMaxValueSize
+	}
+
+	value := strings.Repeat("\x1b[32mlarge\x1b[0m value\n", size/20+1)[:size]
+	k := key(t, "key")
+
+	require.NoError(t, store.Set(k, value, true))
+
+	val, err := store.Get(k, true)
+	require.NoError(t, err)
+	require.Len(t, val, size)
+	require.Equal(t, value, val)
+}
+
+func testBinaryContent(t *testing.T, factory Factory, _ Capabilities) {
+	store := open(t, factory, 0)
+
+	// Every byte value, including NUL and invalid UTF-8 sequences
+	var value strings.Builder
+	for i := 0; i < 256; i++ {
+		value.WriteByte(byte(i))
+	}
+	value.WriteString("\xff\xfe\xc3\x28 \x1b[1;31mbold red\x1b[0m é中\U0001F600")
+
+	k := key(t, "key")
+	require.NoError(t, store.Set(k, value.String(), false))
+
+	val, err := store.Get(k, false)
+	require.NoError(t, err)
+	require.Equal(t, value.String(), val)
+}
+
+func testConcurrency(t *testing.T, factory Factory, _ Capabilities) {
+	store := open(t, factory, 0)
+
+	const workers = 8
+	const iterations = 8
+
+	shared := key(t, "shared")
+	values := map[string]bool{}
+	errs := make(chan error, workers*iterations*3)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		own := key(t, fmt.Sprintf("worker%d", w))
+		for i := 0; i < iterations; i++ {
+			values[fmt.Sprintf("worker %d iteration %d", w, i)] = true
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				value := fmt.Sprintf("worker %d iteration %d", w, i)
+
+				if err := store.Set(own, value, false); err != nil {
+					errs <- err
+					continue
+				}
+
+				if val, err := store.Get(own, false); err != nil {
+					errs <- err
+				} else if val != value {
+					errs <- fmt.Errorf("key %s: got %q, want %q", own, val, value)
+				}
+
+				if err := store.Set(shared, value, false); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// The last write wins, whichever it was
+	val, err := store.Get(shared, false)
+	require.NoError(t, err)
+	require.True(t, values[val], "unexpected value %q of shared key", val)
+}
+
+func testNoExpiration(t *testing.T, factory Factory, _ Capabilities) {
+	store := open(t, factory, 0)
+	k := key(t, "key")
+
+	require.NoError(t, store.Set(k, "value", false))
+
+	time.Sleep(1500 * time.Millisecond)
+
+	for range 2 {
+		val, err := store.Get(k, false)
+		require.NoError(t, err)
+		require.Equal(t, "value", val)
+	}
+}
+
+func testExpiry(t *testing.T, factory Factory, _ Capabilities) {
+	store := open(t, factory, Expiration)
+	k := key(t, "key")
+
+	require.NoError(t, store.Set(k, "value", false))
+
+	val, err := store.Get(k, false)
+	require.NoError(t, err)
+	require.Equal(t, "value", val)
+
+	time.Sleep(Expiration + 1500*time.Millisecond)
+
+	val, err = store.Get(k, false)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	require.Empty(t, val)
+}
+
+func testSkipExpiration(t *testing.T, factory Factory, _ Capabilities) {
+	store := open(t, factory, Expiration)
+	k := key(t, "key")
+
+	require.NoError(t, store.Set(k, "value", true))
+
+	// Reading the entry the usual way must not make it expire
+	val, err := store.Get(k, false)
+	require.NoError(t, err)
+	require.Equal(t, "value", val)
+
+	time.Sleep(Expiration + 1500*time.Millisecond)
+
+	val, err = store.Get(k, true)
+	require.NoError(t, err)
+	require.Equal(t, "value", val)
+
+	val, err = store.Get(k, false)
+	require.NoError(t, err)
+	require.Equal(t, "value", val)
+}
+
+func testSlidingRefresh(t *testing.T, factory Factory, _ Capabilities) {
+	store := open(t, factory, Expiration)
+	k := key(t, "key")
+
+	require.NoError(t, store.Set(k, "value", false))
+
+	// Each read happens before the entry expires, the last one after its original expiration
+	for range 2 {
+		time.Sleep(Expiration - time.Second)
+
+		val, err := store.Get(k, false)
+		require.NoError(t, err)
+		require.Equal(t, "value", val)
+	}
+
+	// Reading without refresh doesn't extend the lifetime
+	time.Sleep(time.Second)
+	_, err := store.Get(k, true)
+	require.NoError(t, err)
+
+	time.Sleep(Expiration)
+	_, err = store.Get(k, true)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testEntryTTL(t *testing.T, factory Factory, _ Capabilities) {
+	// The storage-wide expiration must not replace the own TTL of the entry
+	store := open(t, factory, time.Hour)
+
+	setter, ok := store.(storage.EntrySetter)
+	if !ok {
+		t.Skip("storage doesn't implement storage.EntrySetter")
+	}
+
+	k := key(t, "key")
+	require.NoError(t, setter.SetEntry(storage.Entry{Key: k, Value: "value", Expiration: time.Now().Add(Expiration), TTL: Expiration}))
+
+	// Reads extend the lifetime by the TTL of the entry
+	for range 2 {
+		time.Sleep(Expiration - time.Second)
+
+		val, err := store.Get(k, false)
+		require.NoError(t, err)
+		require.Equal(t, "value", val)
+	}
+
+	time.Sleep(time.Second)
+	_, err := store.Get(k, true)
+	require.NoError(t, err)
+
+	time.Sleep(Expiration)
+	_, err = store.Get(k, true)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+// Returns the storage as a view consumer, skipping the test when it doesn't limit views
+func consumer(t *testing.T, store storage.Storage) (storage.EntrySetter, storage.ViewConsumer) {
+	setter, ok := store.(storage.EntrySetter)
+	if !ok {
+		t.Skip("storage doesn't implement storage.EntrySetter")
+	}
+
+	consumer, ok := store.(storage.ViewConsumer)
+	if !ok {
+		t.Skip("storage doesn't implement storage.ViewConsumer")
+	}
+
+	return setter, consumer
+}
+
+// Stores an entry limited by views, skipping the test when a wrapped storage can't limit them
+func setViews(t *testing.T, setter storage.EntrySetter, entry storage.Entry) {
+	err := setter.SetEntry(entry)
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("wrapped storage doesn't implement storage.ViewConsumer")
+	}
+
+	require.NoError(t, err)
+}
+
+func testViews(t *testing.T, factory Factory, _ Capabilities) {
+	store := open(t, factory, 0)
+	setter, consumer := consumer(t, store)
+
+	k := key(t, "limited")
+	setViews(t, setter, storage.Entry{Key: k, Value: "value", Views: 2})
+
+	// Get doesn't take views
+	val, err := store.Get(k, false)
+	require.NoError(t, err)
+	require.Equal(t, "value", val)
+
+	for _, left := range []int{1, 0} {
+		val, views, err := consumer.Consume(k)
+		require.NoError(t, err)
+		require.Equal(t, "value", val)
+		require.Equal(t, left, views)
+	}
+
+	_, _, err = consumer.Consume(k)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	_, err = store.Get(k, false)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	// Entries without a limit are never removed by reading them
+	unlimited := key(t, "unlimited")
+	require.NoError(t, store.Set(unlimited, "value", false))
+
+	for range 2 {
+		val, views, err := consumer.Consume(unlimited)
+		require.NoError(t, err)
+		require.Equal(t, "value", val)
+		require.Equal(t, -1, views)
+	}
+
+	_, _, err = consumer.Consume(key(t, "missing"))
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testViewsConcurrency(t *testing.T, factory Factory, _ Capabilities) {
+	store := open(t, factory, 0)
+	setter, consumer := consumer(t, store)
+
+	const readers = 8
+
+	k := key(t, "key")
+	setViews(t, setter, storage.Entry{Key: k, Value: "value", Views: 1})
+
+	var wg sync.WaitGroup
+	results := make(chan error, readers)
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, _, err := consumer.Consume(k)
+			results <- err
+		}()
+	}
+
+	wg.Wait()
+	close(results)
+
+	// Exactly one reader sees a single view entry
+	seen := 0
+	for err := range results {
+		if err == nil {
+			seen++
+		} else {
+			require.ErrorIs(t, err, storage.ErrNotFound)
+		}
+	}
+
+	require.Equal(t, 1, seen)
+}
+
+func testRange(t *testing.T, factory Factory, _ Capabilities) {
+	store := open(t, factory, 0)
+	reader, ok := store.(storage.RangeReader)
+	if !ok {
+		t.Skip("storage doesn't implement storage.RangeReader")
+	}
+
+	k := key(t, "key")
+	require.NoError(t, store.Set(k, "first\nsecond\nthird\n", false))
+
+	val, err := reader.GetRange(k, 6, 7)
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("wrapped storage doesn't implement storage.RangeReader")
+	}
+	require.NoError(t, err)
+	require.Equal(t, "second\n", val)
+
+	val, err = reader.GetRange(k, 13, -1)
+	require.NoError(t, err)
+	require.Equal(t, "third\n", val)
+
+	val, err = reader.GetRange(k, 13, 100)
+	require.NoError(t, err)
+	require.Equal(t, "third\n", val)
+
+	val, err = reader.GetRange(k, 100, -1)
+	require.NoError(t, err)
+	require.Empty(t, val)
+
+	_, err = reader.GetRange(key(t, "missing"), 0, -1)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testAppend(t *testing.T, factory Factory, _ Capabilities) {
+	store := open(t, factory, 0)
+	appender, ok := store.(storage.Appender)
+	if !ok {
+		t.Skip("storage doesn't implement storage.Appender")
+	}
+
+	k := key(t, "key")
+	require.NoError(t, store.Set(k, "first\n", false))
+
+	err := appender.Append(k, "second\n")
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("wrapped storage doesn't implement storage.Appender")
+	}
+	require.NoError(t, err)
+	require.NoError(t, appender.Append(k, "third\n"))
+
+	val, err := store.Get(k, false)
+	require.NoError(t, err)
+	require.Equal(t, "first\nsecond\nthird\n", val)
+
+	missing := key(t, "missing")
+	require.ErrorIs(t, appender.Append(missing, "value"), storage.ErrNotFound)
+
+	_, err = store.Get(missing, false)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
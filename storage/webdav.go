@@ -0,0 +1,367 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// webdavMetaSuffix is the suffix of sidecar files holding document expiration
+const webdavMetaSuffix = ".meta"
+
+// WebDAVOptions configures WebDAV storage
+type WebDAVOptions struct {
+	// Endpoint is the URL of the collection where documents are stored
+	Endpoint string
+
+	// Username and Password are used for basic authentication, empty username disables it
+	Username string
+	Password string
+
+	// TLSCAFile is a PEM file with additional certificate authorities to trust
+	TLSCAFile string
+
+	// TLSSkipVerify disables verification of the server certificate
+	TLSSkipVerify bool
+
+	// Expiration is the lifetime of documents, 0 means no expiration
+	Expiration time.Duration
+}
+
+type WebDAVStorage struct {
+	client     *http.Client
+	endpoint   string
+	username   string
+	password   string
+	expiration time.Duration
+}
+
+type webdavMeta struct {
+	// ExpiresAt is the expiration unix timestamp, 0 means no expiration
+	ExpiresAt int64 `json:"expires_at"`
+
+	// TTL is the own lifetime of the document in seconds, 0 means the storage-wide expiration
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+type webdavMultistatus struct {
+	Responses []struct {
+		Href string `xml:"href"`
+	} `xml:"response"`
+}
+
+var (
+	_ Storage     = (*WebDAVStorage)(nil)
+	_ Iterator    = (*WebDAVStorage)(nil)
+	_ EntrySetter = (*WebDAVStorage)(nil)
+	_ Deleter     = (*WebDAVStorage)(nil)
+)
+
+// WebDAVConfig is the configuration block of "webdav" storage
+type WebDAVConfig struct {
+	Endpoint      string `yaml:"endpoint"`
+	Username      string `yaml:"username"`
+	Password      string `yaml:"password"`
+	TLSCAFile     string `yaml:"tls_ca_file"`
+	TLSSkipVerify bool   `yaml:"tls_skip_verify"`
+}
+
+func init() {
+	Register("webdav", func(cfg WebDAVConfig, opts Options) (Storage, error) {
+		return NewWebDAVStorage(WebDAVOptions{
+			Endpoint:      cfg.Endpoint,
+			Username:      cfg.Username,
+			Password:      cfg.Password,
+			TLSCAFile:     cfg.TLSCAFile,
+			TLSSkipVerify: cfg.TLSSkipVerify,
+			Expiration:    opts.Expiration,
+		}), nil
+	})
+}
+
+func NewWebDAVStorage(opts WebDAVOptions) *WebDAVStorage {
+	tlsConfig := &tls.Config{InsecureSkipVerify: opts.TLSSkipVerify}
+	if opts.TLSCAFile != "" {
+		pem, err := os.ReadFile(opts.TLSCAFile)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", opts.TLSCAFile).Msg("Failed to read CA file")
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			log.Fatal().Str("path", opts.TLSCAFile).Msg("Failed to parse CA file")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	s := &WebDAVStorage{
+		client:     &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		endpoint:   strings.TrimSuffix(opts.Endpoint, "/") + "/",
+		username:   opts.Username,
+		password:   opts.Password,
+		expiration: opts.Expiration,
+	}
+
+	// Check if connection is established and create collection if not exists
+	resp, err := s.do("PROPFIND", "", nil, map[string]string{"Depth": "0"})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to WebDAV")
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp, err := s.do("MKCOL", "", nil, nil)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create WebDAV collection")
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			log.Fatal().Int("status", resp.StatusCode).Msg("Failed to create WebDAV collection")
+		}
+	case resp.StatusCode != http.StatusMultiStatus:
+		log.Fatal().Int("status", resp.StatusCode).Msg("Failed to connect to WebDAV")
+	}
+
+	return s
+}
+
+func (s *WebDAVStorage) Set(key string, value string, skip_expiration bool) error {
+	var expiration time.Time
+	if !skip_expiration && s.expiration > 0 {
+		expiration = time.Now().Add(s.expiration)
+	}
+
+	return s.SetEntry(Entry{Key: key, Value: value, Expiration: expiration})
+}
+
+func (s *WebDAVStorage) Get(key string, skip_expiration bool) (string, error) {
+	name := url.PathEscape(key)
+
+	expiration, ttl, err := s.readExpiration(name)
+	if err != nil {
+		return "", err
+	}
+
+	if !expiration.IsZero() && !expiration.After(time.Now()) {
+		if err := s.delete(name); err != nil {
+			return "", err
+		}
+
+		return "", ErrNotFound
+	}
+
+	value, err := s.get(name)
+	if err != nil {
+		return "", err
+	}
+
+	// Update expiration
+	if refresh := entryTTL(ttl, s.expiration); !skip_expiration && !expiration.IsZero() && refresh > 0 {
+		if err := s.writeExpiration(name, time.Now().Add(refresh), ttl); err != nil {
+			return "", err
+		}
+	}
+
+	return string(value), nil
+}
+
+func (s *WebDAVStorage) Iterate(fn func(entry Entry) error) error {
+	resp, err := s.do("PROPFIND", "", strings.NewReader(`<?xml version="1.0" encoding="utf-8"?><propfind xmlns="DAV:"><prop><resourcetype/></prop></propfind>`), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml",
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return fmt.Errorf("webdav: unexpected status %d", resp.StatusCode)
+	}
+
+	var ms webdavMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, r := range ms.Responses {
+		// Skip the collection itself, nested collections and sidecar files
+		if strings.HasSuffix(r.Href, "/") || strings.HasSuffix(r.Href, webdavMetaSuffix) {
+			continue
+		}
+
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			return err
+		}
+
+		name := path.Base(href.EscapedPath())
+		key, err := url.PathUnescape(name)
+		if err != nil {
+			return err
+		}
+
+		expiration, ttl, err := s.readExpiration(name)
+		if err != nil {
+			return err
+		}
+
+		if !expiration.IsZero() && !expiration.After(now) {
+			continue
+		}
+
+		value, err := s.get(name)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := fn(Entry{Key: key, Value: string(value), Expiration: expiration, TTL: ttl}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *WebDAVStorage) SetEntry(entry Entry) error {
+	name := url.PathEscape(entry.Key)
+
+	if err := s.put(name, []byte(entry.Value)); err != nil {
+		return err
+	}
+
+	return s.writeExpiration(name, entry.Expiration, entry.TTL)
+}
+
+func (s *WebDAVStorage) Delete(key string) error {
+	return s.delete(url.PathEscape(key))
+}
+
+func (s *WebDAVStorage) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func (s *WebDAVStorage) do(method string, name string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.endpoint+name, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	return s.client.Do(req)
+}
+
+func (s *WebDAVStorage) get(name string) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, fmt.Errorf("webdav: unexpected status %d for GET %s", resp.StatusCode, name)
+	}
+}
+
+func (s *WebDAVStorage) put(name string, data []byte) error {
+	resp, err := s.do(http.MethodPut, name, bytes.NewReader(data), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webdav: unexpected status %d for PUT %s", resp.StatusCode, name)
+	}
+
+	return nil
+}
+
+func (s *WebDAVStorage) delete(name string) error {
+	for _, target := range []string{name, name + webdavMetaSuffix} {
+		resp, err := s.do(http.MethodDelete, target, nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("webdav: unexpected status %d for DELETE %s", resp.StatusCode, target)
+		}
+	}
+
+	return nil
+}
+
+// Reads expiration and TTL from the sidecar file, documents without one never expire
+func (s *WebDAVStorage) readExpiration(name string) (time.Time, time.Duration, error) {
+	data, err := s.get(name + webdavMetaSuffix)
+	if err == ErrNotFound {
+		return time.Time{}, 0, nil
+	} else if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	var meta webdavMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return time.Time{}, 0, err
+	}
+
+	if meta.ExpiresAt == 0 {
+		return time.Time{}, 0, nil
+	}
+
+	return time.Unix(meta.ExpiresAt, 0), time.Duration(meta.TTL) * time.Second, nil
+}
+
+func (s *WebDAVStorage) writeExpiration(name string, expiration time.Time, ttl time.Duration) error {
+	var meta webdavMeta
+	if !expiration.IsZero() {
+		meta.ExpiresAt = expiration.Unix()
+		meta.TTL = int64(ttl / time.Second)
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	return s.put(name+webdavMetaSuffix, data)
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+)
+
+const (
+	webdavUser string = "webdav-user"
+	webdavPass string = "webdav-password"
+)
+
+func newWebDAVHandler() http.Handler {
+	dav := &webdav.Handler{
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != webdavUser || pass != webdavPass {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		dav.ServeHTTP(w, r)
+	})
+}
+
+func TestWebDAVStorage(t *testing.T) {
+	server := httptest.NewServer(newWebDAVHandler())
+	defer server.Close()
+
+	store := NewWebDAVStorage(WebDAVOptions{
+		Endpoint:   server.URL + "/pastes",
+		Username:   webdavUser,
+		Password:   webdavPass,
+		Expiration: 2 * time.Second,
+	})
+
+	// Test Set
+	err := store.Set("testKey", "testValue", false)
+	require.NoError(t, err)
+
+	// Test Get
+	val, err := store.Get("testKey", false)
+	require.NoError(t, err)
+	require.Equal(t, "testValue", val)
+
+	// Test Get not existing key
+	val, err = store.Get("nonExistingKey", false)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Empty(t, val)
+
+	// Test expiration mechanism
+	time.Sleep(3 * time.Second)
+	val, err = store.Get("testKey", false)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Empty(t, val)
+
+	require.NoError(t, store.Close())
+}
+
+func TestWebDAVStorageSkipExpiration(t *testing.T) {
+	server := httptest.NewServer(newWebDAVHandler())
+	defer server.Close()
+
+	store := NewWebDAVStorage(WebDAVOptions{
+		Endpoint:   server.URL + "/pastes/",
+		Username:   webdavUser,
+		Password:   webdavPass,
+		Expiration: time.Second,
+	})
+
+	err := store.Set("persistent key", "persistentValue", true)
+	require.NoError(t, err)
+
+	time.Sleep(2 * time.Second)
+
+	val, err := store.Get("persistent key", true)
+	require.NoError(t, err)
+	require.Equal(t, "persistentValue", val)
+
+	entries := map[string]string{}
+	err = store.Iterate(func(entry Entry) error {
+		entries[entry.Key] = entry.Value
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"persistent key": "persistentValue"}, entries)
+
+	require.NoError(t, store.Close())
+}
+
+func TestWebDAVStorageTLS(t *testing.T) {
+	server := httptest.NewTLSServer(newWebDAVHandler())
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0600))
+
+	store := NewWebDAVStorage(WebDAVOptions{
+		Endpoint:  server.URL,
+		Username:  webdavUser,
+		Password:  webdavPass,
+		TLSCAFile: caFile,
+	})
+
+	require.NoError(t, store.Set("testKey", "testValue", false))
+
+	val, err := store.Get("testKey", false)
+	require.NoError(t, err)
+	require.Equal(t, "testValue", val)
+
+	require.NoError(t, store.Close())
+}